@@ -0,0 +1,208 @@
+// Package config provides loading of the JSON configuration file
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// duration is a time.Duration written in JSON as a string like "10s" or "5m"
+type duration time.Duration
+
+// UnmarshalJSON parses a duration string
+// data is the JSON value
+// Returns an error if the value is not a valid duration string
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// fileConfig is the layout of the JSON configuration file, see config/example.config.json
+type fileConfig struct {
+	Server struct {
+		Address         string   `json:"address"`
+		BaseURL         string   `json:"base_url"`
+		AdminAddress    string   `json:"admin_address"`
+		ReadTimeout     duration `json:"read_timeout"`
+		WriteTimeout    duration `json:"write_timeout"`
+		ShutdownTimeout duration `json:"shutdown_timeout"`
+		ShutdownDelay   duration `json:"shutdown_delay"`
+	} `json:"server"`
+	Database struct {
+		DSN             string   `json:"dsn"`
+		MaxOpenConns    int      `json:"max_open_conns"`
+		MaxIdleConns    int      `json:"max_idle_conns"`
+		ConnMaxLifetime duration `json:"conn_max_lifetime"`
+		SkipMigrations  bool     `json:"skip_migrations"`
+	} `json:"database"`
+	Storage struct {
+		Mode     string `json:"mode"`
+		FilePath string `json:"file_path"`
+	} `json:"storage"`
+	TLS struct {
+		CertFile   string `json:"cert_file"`
+		KeyFile    string `json:"key_file"`
+		SelfSigned bool   `json:"self_signed"`
+	} `json:"tls"`
+	Auth struct {
+		Mode          string   `json:"mode"`
+		JWTSecret     string   `json:"jwt_secret"`
+		TokenLifetime duration `json:"token_lifetime"`
+	} `json:"auth"`
+	Logging struct {
+		Level  string `json:"level"`
+		Format string `json:"format"`
+	} `json:"logging"`
+	Tracing struct {
+		Exporter    string  `json:"exporter"`
+		Endpoint    string  `json:"endpoint"`
+		File        string  `json:"file"`
+		SampleRatio float64 `json:"sample_ratio"`
+	} `json:"tracing"`
+	RateLimit struct {
+		Redirect RateLimit `json:"redirect"`
+		Shorten  RateLimit `json:"shorten"`
+		API      RateLimit `json:"api"`
+		Client   RateLimit `json:"client"`
+		Store    string    `json:"store"`
+	} `json:"rate_limit"`
+	Alias struct {
+		Strategy string `json:"strategy"`
+		Length   int    `json:"length"`
+		Alphabet string `json:"alphabet"`
+		Salt     string `json:"salt"`
+	} `json:"alias"`
+	Delete struct {
+		Workers       int      `json:"workers"`
+		BatchSize     int      `json:"batch_size"`
+		FlushInterval duration `json:"flush_interval"`
+		QueueLimit    int      `json:"queue_limit"`
+	} `json:"delete"`
+	Restore struct {
+		GracePeriod duration `json:"grace_period"`
+	} `json:"restore"`
+	Purge struct {
+		After       duration `json:"after"`
+		Interval    duration `json:"interval"`
+		AliasPolicy string   `json:"alias_policy"`
+	} `json:"purge"`
+}
+
+// LoadFile applies values of the JSON configuration file, keys missing in the file keep their current values
+// path is the path to the configuration file
+// Returns an error if the file could not be read or contains unknown keys
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Start from the current values so that only keys present in the file change them
+	var fc fileConfig
+	fc.Server.Address = c.ServerAddress
+	fc.Server.BaseURL = c.ResponseAddress
+	fc.Server.AdminAddress = c.AdminAddress
+	fc.Server.ReadTimeout = duration(c.ServerReadTimeout)
+	fc.Server.WriteTimeout = duration(c.ServerWriteTimeout)
+	fc.Server.ShutdownTimeout = duration(c.ShutdownTimeout)
+	fc.Server.ShutdownDelay = duration(c.ShutdownDelay)
+	fc.Database.DSN = c.DBDSN
+	fc.Database.MaxOpenConns = c.DBMaxConns
+	fc.Database.MaxIdleConns = c.DBMinConns
+	fc.Database.ConnMaxLifetime = duration(c.DBConnMaxLifetime)
+	fc.Database.SkipMigrations = c.SkipMigrations
+	fc.Storage.Mode = c.StorageMode
+	fc.Storage.FilePath = c.FileStorePath
+	fc.TLS.CertFile = c.TLSCertFile
+	fc.TLS.KeyFile = c.TLSKeyFile
+	fc.TLS.SelfSigned = c.TLSSelfSigned
+	fc.Auth.Mode = c.AuthMode
+	fc.Auth.JWTSecret = c.JWTSecret
+	fc.Auth.TokenLifetime = duration(c.TokenLifetime)
+	fc.Logging.Level = c.LogLevel
+	fc.Logging.Format = c.LogFormat
+	fc.Tracing.Exporter = c.TracingExporter
+	fc.Tracing.Endpoint = c.TracingEndpoint
+	fc.Tracing.File = c.TracingFile
+	fc.Tracing.SampleRatio = c.TracingSampleRatio
+	fc.RateLimit.Redirect = c.RateLimitRedirect
+	fc.RateLimit.Shorten = c.RateLimitShorten
+	fc.RateLimit.API = c.RateLimitAPI
+	fc.RateLimit.Client = c.RateLimitClient
+	fc.RateLimit.Store = c.RateLimitStore
+	fc.Alias.Strategy = c.AliasStrategy
+	fc.Alias.Length = c.AliasLength
+	fc.Alias.Alphabet = c.AliasAlphabet
+	fc.Alias.Salt = c.AliasSalt
+	fc.Delete.Workers = c.DeleteWorkers
+	fc.Delete.BatchSize = c.DeleteBatchSize
+	fc.Delete.FlushInterval = duration(c.DeleteFlushInterval)
+	fc.Delete.QueueLimit = c.DeleteQueueLimit
+	fc.Restore.GracePeriod = duration(c.RestoreGracePeriod)
+	fc.Purge.After = duration(c.PurgeAfter)
+	fc.Purge.Interval = duration(c.PurgeInterval)
+	fc.Purge.AliasPolicy = c.PurgeAliasPolicy
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&fc); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	c.ServerAddress = fc.Server.Address
+	c.ResponseAddress = fc.Server.BaseURL
+	c.AdminAddress = fc.Server.AdminAddress
+	c.ServerReadTimeout = time.Duration(fc.Server.ReadTimeout)
+	c.ServerWriteTimeout = time.Duration(fc.Server.WriteTimeout)
+	c.ShutdownTimeout = time.Duration(fc.Server.ShutdownTimeout)
+	c.ShutdownDelay = time.Duration(fc.Server.ShutdownDelay)
+	c.DBDSN = fc.Database.DSN
+	c.DBMaxConns = fc.Database.MaxOpenConns
+	c.DBMinConns = fc.Database.MaxIdleConns
+	c.DBConnMaxLifetime = time.Duration(fc.Database.ConnMaxLifetime)
+	c.SkipMigrations = fc.Database.SkipMigrations
+	c.StorageMode = fc.Storage.Mode
+	c.FileStorePath = fc.Storage.FilePath
+	c.TLSCertFile = fc.TLS.CertFile
+	c.TLSKeyFile = fc.TLS.KeyFile
+	c.TLSSelfSigned = fc.TLS.SelfSigned
+	c.AuthMode = fc.Auth.Mode
+	c.JWTSecret = fc.Auth.JWTSecret
+	c.TokenLifetime = time.Duration(fc.Auth.TokenLifetime)
+	c.LogLevel = fc.Logging.Level
+	c.LogFormat = fc.Logging.Format
+	c.TracingExporter = fc.Tracing.Exporter
+	c.TracingEndpoint = fc.Tracing.Endpoint
+	c.TracingFile = fc.Tracing.File
+	c.TracingSampleRatio = fc.Tracing.SampleRatio
+	c.RateLimitRedirect = fc.RateLimit.Redirect
+	c.RateLimitShorten = fc.RateLimit.Shorten
+	c.RateLimitAPI = fc.RateLimit.API
+	c.RateLimitClient = fc.RateLimit.Client
+	c.RateLimitStore = fc.RateLimit.Store
+	c.AliasStrategy = fc.Alias.Strategy
+	c.AliasLength = fc.Alias.Length
+	c.AliasAlphabet = fc.Alias.Alphabet
+	c.AliasSalt = fc.Alias.Salt
+	c.DeleteWorkers = fc.Delete.Workers
+	c.DeleteBatchSize = fc.Delete.BatchSize
+	c.DeleteFlushInterval = time.Duration(fc.Delete.FlushInterval)
+	c.DeleteQueueLimit = fc.Delete.QueueLimit
+	c.RestoreGracePeriod = time.Duration(fc.Restore.GracePeriod)
+	c.PurgeAfter = time.Duration(fc.Purge.After)
+	c.PurgeInterval = time.Duration(fc.Purge.Interval)
+	c.PurgeAliasPolicy = fc.Purge.AliasPolicy
+	c.ConfigFile = path
+	return nil
+}
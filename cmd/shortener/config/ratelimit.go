@@ -0,0 +1,127 @@
+// Package config provides parsing of rate limit settings
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Route groups with their own rate limits
+const (
+	// RateGroupRedirect is the group of redirects by short alias
+	RateGroupRedirect = "redirect"
+
+	// RateGroupShorten is the group of short URL creation
+	RateGroupShorten = "shorten"
+
+	// RateGroupAPI is the group of the other API routes
+	RateGroupAPI = "api"
+
+	// RateGroupClient is the group of all requests, it is limited per client IP before authorization,
+	// so that requests with invalid credentials are limited too
+	RateGroupClient = "client"
+)
+
+// Rate limit stores
+const (
+	// RateLimitMemory keeps rate limit state of every instance in its memory
+	RateLimitMemory = "memory"
+
+	// RateLimitDB shares rate limit state between instances through PostgreSQL
+	RateLimitDB = "db"
+)
+
+// RateLimit is a token bucket limit of Requests per Period
+// The bucket holds up to Requests tokens and is refilled evenly over Period, zero Requests disables the limit
+type RateLimit struct {
+	// Requests is the number of requests allowed per period, it is also the burst size
+	Requests int
+
+	// Period is the time in which the whole bucket is refilled
+	Period time.Duration
+}
+
+// ParseRateLimit parses a limit in the form "<requests>/<period>", for example "100/1m" or "10/s"
+// The period is a duration, a bare unit means one unit, an empty string or "0" disables the limit
+// s is the limit string
+// Returns the limit and an error if the string is invalid
+func ParseRateLimit(s string) (RateLimit, error) {
+	if s == "" || s == "0" {
+		return RateLimit{}, nil
+	}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: expected <requests>/<period>", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: requests must be a non-negative number", s)
+	}
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q: period must be a positive duration", s)
+	}
+	return RateLimit{Requests: n, Period: d}, nil
+}
+
+// UnmarshalText parses the limit from environment variables and the configuration file
+func (l *RateLimit) UnmarshalText(text []byte) error {
+	limit, err := ParseRateLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = limit
+	return nil
+}
+
+// String returns the limit in the form accepted by ParseRateLimit
+func (l RateLimit) String() string {
+	if !l.Enabled() {
+		return "0"
+	}
+	period := l.Period.String()
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{{time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}} {
+		if l.Period%unit.d == 0 {
+			period = strconv.FormatInt(int64(l.Period/unit.d), 10) + unit.name
+			break
+		}
+	}
+	return strconv.Itoa(l.Requests) + "/" + period
+}
+
+// Enabled reports whether requests are limited
+func (l RateLimit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// Rate returns the number of tokens added to the bucket per second
+func (l RateLimit) Rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// RateLimit returns the limit of a route group
+// group is one of RateGroup* constants
+// Returns the limit, unknown groups are not limited
+func (c *Config) RateLimit(group string) RateLimit {
+	switch group {
+	case RateGroupRedirect:
+		return c.RateLimitRedirect
+	case RateGroupShorten:
+		return c.RateLimitShorten
+	case RateGroupAPI:
+		return c.RateLimitAPI
+	case RateGroupClient:
+		return c.RateLimitClient
+	default:
+		return RateLimit{}
+	}
+}
@@ -0,0 +1,50 @@
+// Package config provides merging of a reloaded configuration into the running one
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// reloadable lists environment names of settings that can be changed without a restart
+var reloadable = map[string]bool{
+	"BASE_URL":              true,
+	"LOG_LEVEL":             true,
+	"RESTORE_GRACE_PERIOD":  true,
+	"DELETE_BATCH_SIZE":     true,
+	"DELETE_FLUSH_INTERVAL": true,
+	"DELETE_QUEUE_LIMIT":    true,
+	"RATE_LIMIT_REDIRECT":   true,
+	"RATE_LIMIT_SHORTEN":    true,
+	"RATE_LIMIT_API":        true,
+	"RATE_LIMIT_CLIENT":     true,
+}
+
+// Reload builds the configuration to use after a reload, settings that require a restart keep their current values
+// next is the newly loaded configuration
+// Returns the merged configuration, environment names of applied and ignored changes,
+// and an error if the merged configuration is invalid
+func (c *Config) Reload(next *Config) (merged *Config, applied, ignored []string, err error) {
+	result := *c
+	current := reflect.ValueOf(c).Elem()
+	updated := reflect.ValueOf(next).Elem()
+	target := reflect.ValueOf(&result).Elem()
+
+	for i := 0; i < current.NumField(); i++ {
+		if reflect.DeepEqual(current.Field(i).Interface(), updated.Field(i).Interface()) {
+			continue
+		}
+		name := current.Type().Field(i).Tag.Get("env")
+		if !reloadable[name] {
+			ignored = append(ignored, name)
+			continue
+		}
+		target.Field(i).Set(updated.Field(i))
+		applied = append(applied, name)
+	}
+
+	if err := result.Validate(); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return &result, applied, ignored, nil
+}
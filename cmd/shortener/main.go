@@ -3,30 +3,44 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
 	"github.com/vitalykrupin/url-shortener/cmd/shortener/router"
 	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/health"
+	"github.com/vitalykrupin/url-shortener/internal/app/metrics"
+	appMiddleware "github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/as"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/cs"
 	"github.com/vitalykrupin/url-shortener/internal/app/services/ds"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/es"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ps"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ts"
 	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"github.com/vitalykrupin/url-shortener/internal/app/tracing"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 const (
-	// DeleteWorkers is the number of workers for URL deletion
-	DeleteWorkers = 10
+	// ExpireInterval is the interval between sweeps of expired URLs
+	ExpireInterval = time.Minute
 
-	// ShutdownTimeout is the timeout for graceful server shutdown
-	ShutdownTimeout = 10 * time.Second
-
-	// ServerTimeout is the timeout for reading and writing HTTP requests
-	ServerTimeout = 10 * time.Second
+	// CertReloadInterval is the interval between checks of TLS certificate files for changes
+	CertReloadInterval = 10 * time.Second
 )
 
 // main is the entry point of the application
@@ -56,14 +70,77 @@ func run(logger *zap.SugaredLogger) error {
 		return err
 	}
 
+	// Replace the startup logger with the configured one
+	configured, level, err := newLogger(conf.LogLevel, conf.LogFormat)
+	if err != nil {
+		logger.Errorw("Failed to initialize logger", "error", err)
+		return err
+	}
+	defer func() {
+		_ = configured.Sync()
+	}()
+	zap.ReplaceGlobals(configured)
+	defer zap.RedirectStdLog(configured)()
+	logger = configured.Sugar()
+	for _, warning := range conf.Warnings() {
+		logger.Warnw("Suspicious configuration", "warning", warning)
+	}
+
+	// Pass the configured secret to the JWT middleware that reads it from the environment
+	if conf.JWTSecret != "" {
+		if err := os.Setenv("JWT_SECRET", conf.JWTSecret); err != nil {
+			return err
+		}
+	}
+
+	// Run subcommand instead of the server if requested
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			return runMigrate(logger, conf, args[1:])
+		case "purge":
+			return runPurge(logger, conf, args[1:])
+		default:
+			return fmt.Errorf("unknown command: %s", args[0])
+		}
+	}
+
+	// Set up tracing, spans are dropped unless an exporter is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), conf)
+	if err != nil {
+		logger.Errorw("Failed to set up tracing", "error", err)
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Errorw("Failed to flush traces", "error", err)
+		}
+	}()
+
 	// Create storage
 	store, err := storage.NewStorage(conf)
 	if err != nil {
 		logger.Errorw("Failed to create storage", "error", err)
 		return err
 	}
+	db, _ := store.(*storage.DB)
+	if conf.TracingExporter != config.TracingOff {
+		store = tracing.InstrumentStorage(store)
+	}
+
+	// Create metrics, they are exposed only by the admin server
+	var appMetrics *metrics.Metrics
+	if conf.AdminAddress != "" {
+		appMetrics = metrics.New()
+		if db != nil {
+			appMetrics.RegisterPool(db.PoolStats)
+		}
+		store = appMetrics.InstrumentStorage(store)
+	}
 	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
 		defer cancel()
 		if err := store.CloseStorage(ctx); err != nil {
 			logger.Errorw("Failed to close storage", "error", err)
@@ -71,47 +148,180 @@ func run(logger *zap.SugaredLogger) error {
 	}()
 
 	// Create delete service
-	deleteSvc := ds.NewDeleteService(store)
-	deleteSvc.Start(DeleteWorkers)
-	defer deleteSvc.Stop()
+	deleteSvc := ds.NewDeleteService(store, logger.Desugar())
+	deleteSvc.SetBatching(conf.DeleteBatchSize, conf.DeleteFlushInterval)
+	deleteSvc.Start(conf.DeleteWorkers)
+	if appMetrics != nil {
+		appMetrics.RegisterDeleteQueue(deleteSvc.Stats)
+	}
+	defer func() {
+		deleteSvc.Stop()
+		stats := deleteSvc.Stats()
+		logger.Infow("Delete service stopped",
+			"processed", stats.Processed,
+			"failures", stats.Failures,
+			"dead_letters", stats.DeadLetters,
+		)
+	}()
+
+	// Create expire service
+	expireSvc := es.NewExpireService(store, logger.Desugar())
+	expireSvc.Start(ExpireInterval)
+	defer expireSvc.Stop()
+
+	// Create purge service, without an interval deleted URLs are only purged by the purge command
+	if conf.PurgeInterval > 0 {
+		purgeSvc := ps.NewPurgeService(store, conf.PurgeAfter, conf.PurgeAliasPolicy == config.PurgeReleaseAliases, logger.Desugar())
+		purgeSvc.Start(conf.PurgeInterval)
+		defer purgeSvc.Stop()
+	}
+
+	// Create click service
+	clickSvc := cs.NewClickService(store, logger.Desugar())
+	clickSvc.Start()
+	defer clickSvc.Stop()
 
 	// Create application
 	application := app.NewApp(store, conf, deleteSvc)
+	application.ClickService = clickSvc
+	application.Metrics = appMetrics
+	application.Logger = configured
+
+	// Create auth service, in the external mode users register and log in via auth-service
+	if conf.AuthMode == config.AuthLocal {
+		authSvc, err := as.NewAuthService(store, conf.JWTSecret, conf.TokenLifetime)
+		if err != nil {
+			logger.Errorw("Failed to create auth service", "error", err)
+			return err
+		}
+		application.AuthService = authSvc
+	}
+
+	// Create rate limiter, only the database store shares limits between instances
+	var rateLimits appMiddleware.RateLimitStore = appMiddleware.NewMemoryRateLimitStore()
+	if conf.RateLimitStore == config.RateLimitDB {
+		rateLimits = db.RateLimits()
+	}
+	application.RateLimiter = appMiddleware.NewRateLimiter(rateLimits, func(group string) config.RateLimit {
+		return application.Config().RateLimit(group)
+	})
+
+	// Register readiness checks in addition to the storage one
+	application.Health.Register("delete_queue", health.DeleteQueue(deleteSvc.Stats, func() int {
+		return application.Config().DeleteQueueLimit
+	}))
+	if db != nil {
+		migrator, err := db.Migrator()
+		if err != nil {
+			logger.Errorw("Failed to load migrations", "error", err)
+			return err
+		}
+		application.Health.Register("migrations", health.Migrations(migrator))
+	}
 
 	// Create router
 	h := router.Build(application)
 
 	// Create HTTP server
 	srv := &http.Server{
-		Addr:         application.Config.ServerAddress,
+		Addr:         conf.ServerAddress,
 		Handler:      h,
-		ReadTimeout:  ServerTimeout,
-		WriteTimeout: ServerTimeout,
+		ReadTimeout:  conf.ServerReadTimeout,
+		WriteTimeout: conf.ServerWriteTimeout,
+		ErrorLog:     zap.NewStdLog(configured.Named("http")),
+	}
+
+	// Configure TLS, certificate files are checked for changes while the server runs
+	switch {
+	case conf.TLSSelfSigned:
+		cert, err := ts.SelfSigned(tlsHosts(conf))
+		if err != nil {
+			logger.Errorw("Failed to generate self-signed certificate", "error", err)
+			return err
+		}
+		logger.Warnw("Using self-signed TLS certificate, do not use it in production", "hosts", cert.Leaf.DNSNames, "ips", cert.Leaf.IPAddresses)
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	case conf.TLSCertFile != "":
+		certSvc, err := ts.NewCertificateService(conf.TLSCertFile, conf.TLSKeyFile, logger.Desugar())
+		if err != nil {
+			logger.Errorw("Failed to load TLS certificate", "error", err)
+			return err
+		}
+		certSvc.Start(CertReloadInterval)
+		defer certSvc.Stop()
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certSvc.GetCertificate}
 	}
 
 	// Channels for handling errors and signals
-	errCh := make(chan error, 1)
+	errCh := make(chan error, 2)
 	go func() {
-		logger.Infow("Starting server", "address", application.Config.ServerAddress)
+		logger.Infow("Starting server", "address", conf.ServerAddress, "tls", conf.TLSEnabled())
+		if srv.TLSConfig != nil {
+			errCh <- srv.ListenAndServeTLS("", "")
+			return
+		}
 		errCh <- srv.ListenAndServe()
 	}()
 
+	// Start admin server on its own address, so that metrics are not public
+	if appMetrics != nil {
+		adminMux := http.NewServeMux()
+		adminMux.Handle("/metrics", appMetrics.Handler())
+		adminSrv := &http.Server{
+			Addr:              conf.AdminAddress,
+			Handler:           adminMux,
+			ReadHeaderTimeout: conf.ServerReadTimeout,
+		}
+		go func() {
+			logger.Infow("Starting admin server", "address", conf.AdminAddress)
+			if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errCh <- fmt.Errorf("admin server: %w", err)
+			}
+		}()
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+			defer cancel()
+			if err := adminSrv.Shutdown(ctx); err != nil {
+				logger.Errorw("Admin server shutdown failed", "error", err)
+			}
+		}()
+	}
+
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-
-	// Wait for completion
-	select {
-	case sig := <-sigCh:
-		logger.Infow("Received signal, shutting down...", "signal", sig)
-	case err := <-errCh:
-		if err != nil && err != http.ErrServerClosed {
-			logger.Errorw("Server error", "error", err)
-			return err
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	// Wait for completion, reloading configuration on SIGHUP
+wait:
+	for {
+		select {
+		case sig := <-sigCh:
+			if sig == syscall.SIGHUP {
+				reloadConfig(logger, application, deleteSvc, level)
+				continue
+			}
+			logger.Infow("Received signal, shutting down...", "signal", sig)
+
+			// Report not ready while still serving, so that load balancers stop sending traffic first
+			application.Health.Shutdown()
+			if conf.ShutdownDelay > 0 {
+				logger.Infow("Draining before shutdown", "delay", conf.ShutdownDelay)
+				select {
+				case <-time.After(conf.ShutdownDelay):
+				case <-sigCh: // A second signal skips draining
+				}
+			}
+			break wait
+		case err := <-errCh:
+			if err != nil && err != http.ErrServerClosed {
+				logger.Errorw("Server error", "error", err)
+				return err
+			}
+			break wait
 		}
 	}
 
 	// Graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
@@ -122,3 +332,162 @@ func run(logger *zap.SugaredLogger) error {
 	logger.Info("Server shutdown completed")
 	return nil
 }
+
+// reloadConfig re-reads the configuration and applies the settings that can be changed at runtime
+// The current configuration is kept if the new one is invalid
+// logger is the logger for writing application logs
+// application is the application whose configuration is replaced
+// deleteSvc is the delete service whose batching is updated
+// level is the level of the application logger
+func reloadConfig(logger *zap.SugaredLogger, application *app.App, deleteSvc *ds.DeleteService, level zap.AtomicLevel) {
+	next := config.NewConfig()
+	if err := next.Load(os.Args[1:]); err != nil {
+		logger.Errorw("Failed to reload configuration, keeping the current one", "error", err)
+		return
+	}
+	merged, applied, ignored, err := application.Config().Reload(next)
+	if err != nil {
+		logger.Errorw("Failed to reload configuration, keeping the current one", "error", err)
+		return
+	}
+
+	// The level is validated, so parsing can not fail here
+	if lvl, err := zapcore.ParseLevel(merged.LogLevel); err == nil {
+		level.SetLevel(lvl)
+	}
+	deleteSvc.SetBatching(merged.DeleteBatchSize, merged.DeleteFlushInterval)
+	application.SetConfig(merged)
+
+	logger.Infow("Configuration reloaded", "applied", applied, "restart_required", ignored)
+	for _, warning := range merged.Warnings() {
+		logger.Warnw("Suspicious configuration", "warning", warning)
+	}
+}
+
+// tlsHosts lists the hosts a self-signed certificate is generated for
+// conf is the application configuration
+// Returns local hosts and the hosts of the server address and the base URL
+func tlsHosts(conf *config.Config) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if host, _, err := net.SplitHostPort(conf.ServerAddress); err == nil && host != "" {
+		hosts = append(hosts, host)
+	}
+	if u, err := url.Parse(conf.ResponseAddress); err == nil && u.Hostname() != "" {
+		hosts = append(hosts, u.Hostname())
+	}
+	slices.Sort(hosts)
+	return slices.Compact(hosts)
+}
+
+// runMigrate runs the migrate subcommand
+// logger is the logger for writing application logs
+// conf is the application configuration
+// args are the subcommand arguments: up, down [steps] or status
+// Returns an error if migrations failed
+func runMigrate(logger *zap.SugaredLogger, conf *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down [steps]|status")
+	}
+	if conf.DBDSN == "" {
+		return fmt.Errorf("migrate requires database DSN")
+	}
+
+	ctx := context.Background()
+	db, err := storage.NewDB(conf)
+	if err != nil {
+		logger.Errorw("Failed to connect to database", "error", err)
+		return err
+	}
+	defer func() {
+		_ = db.CloseStorage(ctx)
+	}()
+
+	migrator, err := db.Migrator()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		count, err := migrator.Up(ctx)
+		logger.Infow("Migrations applied", "count", count)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		count, err := migrator.Down(ctx, steps)
+		logger.Infow("Migrations reverted", "count", count)
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			if s.AppliedAt != nil {
+				fmt.Printf("%03d_%s\tapplied at %s\n", s.Version, s.Name, s.AppliedAt.Format(time.RFC3339))
+			} else {
+				fmt.Printf("%03d_%s\tpending\n", s.Version, s.Name)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command: %s", args[0])
+	}
+}
+
+// runPurge runs the purge subcommand that permanently removes old deleted URLs once
+// logger is the logger for writing application logs
+// conf is the application configuration
+// args are the subcommand arguments, none are accepted
+// Returns an error if purging failed
+func runPurge(logger *zap.SugaredLogger, conf *config.Config, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: purge")
+	}
+
+	store, err := storage.NewStorage(conf)
+	if err != nil {
+		logger.Errorw("Failed to create storage", "error", err)
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
+		defer cancel()
+		if err := store.CloseStorage(ctx); err != nil {
+			logger.Errorw("Failed to close storage", "error", err)
+		}
+	}()
+
+	release := conf.PurgeAliasPolicy == config.PurgeReleaseAliases
+	count, err := ps.NewPurgeService(store, conf.PurgeAfter, release, logger.Desugar()).Purge(context.Background(), time.Now())
+	if err != nil {
+		return err
+	}
+	logger.Infow("Deleted URLs purged", "count", count, "older_than", conf.PurgeAfter, "release_aliases", release)
+	return nil
+}
+
+// newLogger creates the application logger
+// level is the minimum level of written records
+// format is the record format: json or console
+// Returns the logger, its level that can be changed at runtime and an error if the settings are invalid
+func newLogger(level, format string) (*zap.Logger, zap.AtomicLevel, error) {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return nil, zap.AtomicLevel{}, err
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.Level = zap.NewAtomicLevelAt(lvl)
+	cfg.Encoding = format
+	if format == config.LogConsole {
+		cfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	}
+	logger, err := cfg.Build()
+	return logger, cfg.Level, err
+}
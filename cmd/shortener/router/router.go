@@ -7,9 +7,12 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
 	"github.com/vitalykrupin/url-shortener/internal/app"
 	"github.com/vitalykrupin/url-shortener/internal/app/handlers"
 	appMiddleware "github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ks"
+	"github.com/vitalykrupin/url-shortener/internal/app/tracing"
 )
 
 // Build creates and configures the HTTP request router
@@ -18,34 +21,74 @@ import (
 func Build(app *app.App) http.Handler {
 	r := chi.NewRouter()
 
-	// Standard middleware from chi
+	// Standard middleware from chi, requests are logged before panics are recovered
 	r.Use(chiMiddleware.RequestID)                 // Adds unique ID to each request
 	r.Use(chiMiddleware.RealIP)                    // Determines real client IP address
-	r.Use(chiMiddleware.Logger)                    // Logs HTTP requests
+	r.Use(tracing.Middleware)                      // Starts a span for each request
+	r.Use(appMiddleware.Logging(app.Logger))       // Logs requests with request ID, user ID and route
 	r.Use(chiMiddleware.Recoverer)                 // Recovers from panics in handlers
 	r.Use(chiMiddleware.Timeout(60 * time.Second)) // Sets timeout for requests
 
 	// Custom middleware
-	r.Use(appMiddleware.Logging)        // Custom logging
+	r.Use(app.Metrics.Middleware)       // Request metrics by route
 	r.Use(appMiddleware.GzipMiddleware) // Gzip compression support
-	r.Use(appMiddleware.JWTMiddleware)  // JWT authorization via auth-service
 
-	// Routes for getting URLs
-	r.Handle(`/{id}`, handlers.NewGetHandler(app)) // Get original URL by short alias
+	// Routes for probes, they are called by load balancers without authorization
+	r.Method(http.MethodGet, `/healthz`, handlers.NewHealthzHandler(app)) // Check that the process is alive
+	r.Method(http.MethodGet, `/readyz`, handlers.NewReadyzHandler(app))   // Check that dependencies are usable
 
-	// Routes for health checks
-	r.Method(http.MethodGet, `/ping`, handlers.NewGetPingHandler(app)) // Check database connection
+	r.Group(func(r chi.Router) {
+		r.Use(app.RateLimiter.LimitIP(config.RateGroupClient)) // Limits all requests per client IP, including ones with invalid credentials
 
-	// Routes for working with user URLs
-	r.Method(http.MethodGet, `/api/user/urls`, handlers.NewGetAllUserURLs(app)) // Get all user URLs
+		// Routes for built-in authentication, only in the local auth mode
+		if app.AuthService != nil {
+			auth := r.With(app.RateLimiter.Limit(config.RateGroupAPI))
+			auth.Method(http.MethodPost, `/api/auth/register`, handlers.NewRegisterHandler(app)) // Register user
+			auth.Method(http.MethodPost, `/api/auth/login`, handlers.NewLoginHandler(app))       // Log in user
+		}
 
-	// Routes for creating short URLs
-	r.Handle(`/`, handlers.NewPostHandler(app))                                        // Create short URL from request body
-	r.Method(http.MethodPost, `/api/shorten`, handlers.NewPostHandler(app))            // Create short URL from JSON
-	r.Method(http.MethodPost, `/api/shorten/batch`, handlers.NewPostBatchHandler(app)) // Create multiple short URLs
+		r.Group(func(r chi.Router) {
+			r.Use(appMiddleware.Authorization(app.KeyService, app.AuthService)) // API key or JWT authorization
 
-	// Routes for deleting URLs
-	r.Method(http.MethodDelete, `/api/user/urls`, handlers.NewDeleteHandler(app)) // Delete user URLs
+			// Route groups with their own rate limits per user
+			redirect := r.With(app.RateLimiter.Limit(config.RateGroupRedirect))
+			shorten := r.With(app.RateLimiter.Limit(config.RateGroupShorten), appMiddleware.RequireScope(ks.ScopeShorten))
+			api := r.With(app.RateLimiter.Limit(config.RateGroupAPI))
+
+			// API routes by the scope an API key needs, keys are managed with JWT only
+			read := api.With(appMiddleware.RequireScope(ks.ScopeRead))
+			edit := api.With(appMiddleware.RequireScope(ks.ScopeShorten))
+			remove := api.With(appMiddleware.RequireScope(ks.ScopeDelete))
+			keys := api.With(appMiddleware.DenyAPIKeys)
+
+			// Routes for getting URLs
+			redirect.Handle(`/{id}`, handlers.NewGetHandler(app)) // Get original URL by short alias
+
+			// Routes for health checks
+			read.Method(http.MethodGet, `/ping`, handlers.NewGetPingHandler(app)) // Check database connection
+
+			// Routes for working with user URLs
+			read.Method(http.MethodGet, `/api/user/urls`, handlers.NewGetAllUserURLs(app))                    // Get all user URLs
+			read.Method(http.MethodGet, `/api/user/urls/{id}/stats`, handlers.NewStatsHandler(app))           // Get click statistics of user URL
+			edit.Method(http.MethodPatch, `/api/user/urls/{id}`, handlers.NewPatchUserURLHandler(app))        // Edit user URL
+			read.Method(http.MethodGet, `/api/user/urls/{id}/history`, handlers.NewGetURLHistoryHandler(app)) // Get edit history of user URL
+
+			// Routes for creating short URLs
+			shorten.Handle(`/`, handlers.NewPostHandler(app))                                        // Create short URL from request body
+			shorten.Method(http.MethodPost, `/api/shorten`, handlers.NewPostHandler(app))            // Create short URL from JSON
+			shorten.Method(http.MethodPost, `/api/shorten/batch`, handlers.NewPostBatchHandler(app)) // Create multiple short URLs
+
+			// Routes for deleting URLs
+			remove.Method(http.MethodDelete, `/api/user/urls`, handlers.NewDeleteHandler(app))                // Delete user URLs
+			read.Method(http.MethodGet, `/api/user/delete-jobs/{id}`, handlers.NewGetDeleteJobHandler(app))   // Get status of delete job
+			remove.Method(http.MethodPost, `/api/user/urls/restore`, handlers.NewRestoreUserURLsHandler(app)) // Restore deleted user URLs
+
+			// Routes for API keys
+			keys.Method(http.MethodPost, `/api/user/keys`, handlers.NewPostAPIKeyHandler(app))          // Create API key
+			keys.Method(http.MethodGet, `/api/user/keys`, handlers.NewGetAPIKeysHandler(app))           // Get all user API keys
+			keys.Method(http.MethodDelete, `/api/user/keys/{id}`, handlers.NewDeleteAPIKeyHandler(app)) // Revoke API key
+		})
+	})
 
 	return r
 }
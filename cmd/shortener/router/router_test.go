@@ -1,21 +1,32 @@
 package router
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
 	"github.com/vitalykrupin/url-shortener/internal/app"
+	appMiddleware "github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/as"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ds"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ks"
 	"github.com/vitalykrupin/url-shortener/internal/app/storage"
 )
 
 // mockDeleteService for testing
 type mockDeleteService struct{}
 
-func (m *mockDeleteService) Add(userID string, urls []string) {}
-func (m *mockDeleteService) Start(workers int)                {}
-func (m *mockDeleteService) Stop()                            {}
+func (m *mockDeleteService) Add(ctx context.Context, userID string, urls []string) (string, error) {
+	return "", nil
+}
+func (m *mockDeleteService) Start(workers int) {}
+func (m *mockDeleteService) Stop()             {}
+func (m *mockDeleteService) Stats() ds.Stats   { return ds.Stats{} }
 
 func TestBuild(t *testing.T) {
 	conf := config.NewConfig()
@@ -177,3 +188,169 @@ func TestBuild_LoggingMiddleware(t *testing.T) {
 		t.Errorf("Expected status 401, got %d", res.StatusCode)
 	}
 }
+
+func TestBuild_ProbesWithoutAuthorization(t *testing.T) {
+	conf := config.NewConfig()
+	store, err := storage.NewStorage(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	application := app.NewApp(store, conf, &mockDeleteService{})
+	handler := Build(application)
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for %s, got %d", path, w.Code)
+		}
+	}
+
+	// Readiness fails while draining, liveness does not
+	application.Health.Shutdown()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 while shutting down, got %d", w.Code)
+	}
+}
+
+func TestBuild_APIKeyAuthorization(t *testing.T) {
+	conf := config.NewConfig()
+	store, err := storage.NewStorage(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	application := app.NewApp(store, conf, &mockDeleteService{})
+	handler := Build(application)
+
+	key, _, err := application.KeyService.Create(context.Background(), "user123", "ci", []string{ks.ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		key      string
+		wantCode int
+	}{
+		{name: "scope allows route", method: http.MethodGet, path: "/api/user/urls", key: key, wantCode: http.StatusNoContent},
+		{name: "scope does not allow route", method: http.MethodPost, path: "/api/shorten", key: key, wantCode: http.StatusForbidden},
+		{name: "keys are not managed with keys", method: http.MethodGet, path: "/api/user/keys", key: key, wantCode: http.StatusForbidden},
+		{name: "unknown key", method: http.MethodGet, path: "/api/user/urls", key: ks.KeyPrefix + "unknown", wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "ApiKey "+tt.key)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestBuild_LocalAuth(t *testing.T) {
+	conf := config.NewConfig()
+	store, err := storage.NewStorage(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the local auth mode users are registered by auth-service
+	w := httptest.NewRecorder()
+	Build(app.NewApp(store, conf, &mockDeleteService{})).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/register", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected no register route in the external auth mode, got %d", w.Code)
+	}
+
+	application := app.NewApp(store, conf, &mockDeleteService{})
+	application.AuthService, err = as.NewAuthService(store, "supersecretkey", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Build(application)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/register", strings.NewReader(`{"login":"alice","password":"correct horse"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d on register, got %d", http.StatusCreated, w.Code)
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+	}{
+		{name: "issued token", token: resp.Token, wantCode: http.StatusNoContent},
+		{name: "no token", wantCode: http.StatusUnauthorized},
+		{name: "forged token", token: "invalid.token.here", wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d", tt.wantCode, w.Code)
+			}
+		})
+	}
+}
+
+func TestBuild_RateLimitBeforeAuthorization(t *testing.T) {
+	conf := config.NewConfig()
+	conf.RateLimitClient = config.RateLimit{Requests: 2, Period: time.Minute}
+	store, err := storage.NewStorage(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	application := app.NewApp(store, conf, &mockDeleteService{})
+	application.RateLimiter = appMiddleware.NewRateLimiter(appMiddleware.NewMemoryRateLimitStore(), conf.RateLimit)
+	handler := Build(application)
+
+	// Requests with invalid credentials use up the limit of the client IP
+	codes := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("Authorization", "ApiKey "+ks.KeyPrefix+"guess")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Errorf("Expected statuses %v, got %v", want, codes)
+			break
+		}
+	}
+
+	// Probes are not limited
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected probe to pass, got %d", w.Code)
+	}
+}
@@ -2,9 +2,21 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"sync/atomic"
+
 	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+	"github.com/vitalykrupin/url-shortener/internal/app/health"
+	"github.com/vitalykrupin/url-shortener/internal/app/metrics"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/alias"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/as"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/cs"
 	"github.com/vitalykrupin/url-shortener/internal/app/services/ds"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ks"
 	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
 )
 
 // App is the main application structure
@@ -12,11 +24,35 @@ type App struct {
 	// Store is the interface for working with data storage
 	Store storage.Storage
 
-	// Config is the application configuration
-	Config *config.Config
+	// config is the current application configuration, it is replaced as a whole on reload
+	config atomic.Pointer[config.Config]
 
 	// DeleteService is the service for deleting URLs
 	DeleteService ds.DeleteServiceInterface
+
+	// AliasGenerator is the generator of short aliases
+	AliasGenerator alias.Generator
+
+	// KeyService issues API keys and resolves them to their users
+	KeyService ks.KeyServiceInterface
+
+	// AuthService registers users and issues tokens, nil keeps users in auth-service
+	AuthService as.AuthServiceInterface
+
+	// ClickService records redirects for statistics, nil disables recording
+	ClickService cs.ClickServiceInterface
+
+	// Metrics records application metrics, nil disables recording
+	Metrics *metrics.Metrics
+
+	// RateLimiter limits requests per user or client IP, nil disables limiting
+	RateLimiter *middleware.RateLimiter
+
+	// Logger is the shared application logger, requests log through its copy with the request ID
+	Logger *zap.Logger
+
+	// Health runs the readiness checks, the storage check is registered by NewApp
+	Health *health.Checker
 }
 
 // NewApp creates a new application instance
@@ -25,9 +61,46 @@ type App struct {
 // deleteService is the service for deleting URLs
 // Returns a pointer to App
 func NewApp(store storage.Storage, conf *config.Config, deleteService ds.DeleteServiceInterface) *App {
-	return &App{
-		Store:         store,
-		Config:        conf,
-		DeleteService: deleteService,
+	logger := zap.L()
+	generator, err := alias.NewGenerator(conf)
+	if err != nil {
+		// Configuration is validated on parsing, so this happens only for hand-made configs
+		logger.Warn("Invalid alias settings, using random aliases", zap.Error(err))
+		generator = alias.NewRandom(alias.Base62Alphabet, alias.DefaultLength)
+	}
+
+	app := &App{
+		Store:          store,
+		DeleteService:  deleteService,
+		AliasGenerator: generator,
+		KeyService:     ks.NewKeyService(store),
+		Logger:         logger,
+		Health:         health.New(),
+	}
+	app.config.Store(conf)
+	app.Health.Register("storage", app.pingStorage)
+	return app
+}
+
+// Config returns the current application configuration
+// The returned configuration must not be modified, handlers should read it once per request
+// Returns a pointer to Config
+func (a *App) Config() *config.Config {
+	return a.config.Load()
+}
+
+// SetConfig atomically replaces the application configuration
+// conf is the new configuration
+func (a *App) SetConfig(conf *config.Config) {
+	a.config.Store(conf)
+}
+
+// pingStorage checks that the storage is reachable
+// ctx is the check context
+// Returns an error if the storage is missing or not reachable
+func (a *App) pingStorage(ctx context.Context) error {
+	if a.Store == nil {
+		return errors.New("storage is not configured")
 	}
+	return a.Store.PingStorage(ctx)
 }
@@ -20,3 +20,21 @@ func TestNewApp(t *testing.T) {
 		t.Error("Expected config to be created, but got nil")
 	}
 }
+
+func TestApp_SetConfig(t *testing.T) {
+	conf := config.NewConfig()
+	app := NewApp(nil, conf, nil)
+	if app.Config() != conf {
+		t.Fatal("Expected Config to return the initial configuration")
+	}
+
+	next := config.NewConfig()
+	next.ResponseAddress = "http://short.example"
+	app.SetConfig(next)
+	if got := app.Config().ResponseAddress; got != "http://short.example" {
+		t.Errorf("Expected reloaded ResponseAddress, got '%s'", got)
+	}
+	if conf.ResponseAddress != "http://localhost:8080" {
+		t.Errorf("Expected initial configuration to stay unchanged, got '%s'", conf.ResponseAddress)
+	}
+}
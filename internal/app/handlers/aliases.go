@@ -0,0 +1,63 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/services/alias"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+)
+
+// shortenURLs stores URLs under newly generated aliases
+// Aliases that are already taken are regenerated for the colliding URLs only,
+// the generator gets the attempt number to change or grow the alias
+// ctx is the request context
+// store is the data storage
+// generator is the alias generator
+// urls is the list of original URLs
+// expiresAt is the expiration time of the new URLs, nil if they never expire
+// Returns a map of OriginalURL -> alias, true if at least one URL already existed, and an error if storing failed
+func shortenURLs(ctx context.Context, store storage.Storage, generator alias.Generator, urls []storage.OriginalURL, expiresAt *time.Time) (map[storage.OriginalURL]storage.Alias, bool, error) {
+	result := make(map[storage.OriginalURL]storage.Alias, len(urls))
+	conflict := false
+	pending := urls
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt == aliasAttempts {
+			return nil, false, fmt.Errorf("can not generate free aliases for %d URLs", len(pending))
+		}
+
+		batch := make(map[storage.Alias]storage.OriginalURL, len(pending))
+		for _, url := range pending {
+			a, err := generator.Generate(string(url), attempt)
+			if err != nil {
+				return nil, false, err
+			}
+			// Deterministic generators may return the same alias for different URLs of one batch,
+			// such URLs and reserved aliases are retried on the next attempt
+			if _, ok := batch[storage.Alias(a)]; !ok && !alias.IsReserved(a) {
+				batch[storage.Alias(a)] = url
+			}
+		}
+
+		stored, err := store.AddOrGet(ctx, batch, expiresAt)
+		if errors.Is(err, storage.ErrConflict) {
+			conflict = true
+		} else if err != nil {
+			return nil, false, err
+		}
+
+		next := make([]storage.OriginalURL, 0)
+		for _, url := range pending {
+			if alias, ok := stored[url]; ok {
+				result[url] = alias
+			} else {
+				next = append(next, url)
+			}
+		}
+		pending = next
+	}
+	return result, conflict, nil
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/services/alias"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+)
+
+// collidingStorage reports the aliases of the first calls as taken
+type collidingStorage struct {
+	storage.Storage
+	collisions int
+	sizes      []int
+}
+
+func (s *collidingStorage) AddOrGet(ctx context.Context, batch map[storage.Alias]storage.OriginalURL, expiresAt *time.Time) (map[storage.OriginalURL]storage.Alias, error) {
+	for alias := range batch {
+		s.sizes = append(s.sizes, len(alias))
+	}
+	if s.collisions > 0 {
+		s.collisions--
+		return map[storage.OriginalURL]storage.Alias{}, nil
+	}
+	return s.Storage.AddOrGet(ctx, batch, expiresAt)
+}
+
+func TestShortenURLs_RetriesCollisions(t *testing.T) {
+	store := &collidingStorage{Storage: storage.NewMemoryStorage(), collisions: alias.GrowAfter}
+	generator := alias.NewRandom(alias.Base62Alphabet, alias.DefaultLength)
+
+	stored, conflict, err := shortenURLs(context.Background(), store, generator, []storage.OriginalURL{"https://example.com"}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if conflict {
+		t.Error("expected no conflict for a new URL")
+	}
+	a, ok := stored["https://example.com"]
+	if !ok {
+		t.Fatal("expected alias for URL")
+	}
+	if len(a) != alias.DefaultLength+1 {
+		t.Errorf("expected alias to grow to %d characters, got %q", alias.DefaultLength+1, a)
+	}
+	if len(store.sizes) != alias.GrowAfter+1 {
+		t.Errorf("expected %d attempts, got %d", alias.GrowAfter+1, len(store.sizes))
+	}
+}
+
+func TestShortenURLs_GivesUp(t *testing.T) {
+	store := &collidingStorage{Storage: storage.NewMemoryStorage(), collisions: aliasAttempts}
+	generator := alias.NewRandom(alias.Base62Alphabet, alias.DefaultLength)
+
+	if _, _, err := shortenURLs(context.Background(), store, generator, []storage.OriginalURL{"https://example.com"}, nil); err == nil {
+		t.Error("expected error when all aliases collide")
+	}
+}
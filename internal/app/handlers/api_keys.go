@@ -0,0 +1,191 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ks"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// apiKeyRequest represents the request for a new API key
+type apiKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// apiKeyResponse represents an API key, Key is set only in the response to its creation
+type apiKeyResponse struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key,omitempty"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// newAPIKeyResponse returns the response of a stored API key
+func newAPIKeyResponse(key storage.APIKey) apiKeyResponse {
+	return apiKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
+
+// PostAPIKeyHandler handles POST requests for creating API keys
+type PostAPIKeyHandler struct {
+	BaseHandler
+}
+
+// NewPostAPIKeyHandler is the constructor for PostAPIKeyHandler
+func NewPostAPIKeyHandler(app *app.App) *PostAPIKeyHandler {
+	return &PostAPIKeyHandler{
+		BaseHandler: BaseHandler{app},
+	}
+}
+
+// ServeHTTP handles the HTTP request for creating an API key of the user
+// The key is returned only in this response, the storage keeps its hash
+func (handler *PostAPIKeyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), ctxTimeout)
+	defer cancel()
+
+	if req.Method != http.MethodPost {
+		middleware.Logger(req.Context()).Debug("Only POST requests are allowed")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	if userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	defer req.Body.Close()
+	var body apiKeyRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		middleware.Logger(req.Context()).Debug("Can not parse body", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	key, info, err := handler.app.KeyService.Create(ctx, userID, body.Name, body.Scopes)
+	if errors.Is(err, ks.ErrInvalidName) || errors.Is(err, ks.ErrInvalidScopes) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger(req.Context()).Error("Can not create API key", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := newAPIKeyResponse(info)
+	resp.Key = key
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// GetAPIKeysHandler handles GET requests for the list of API keys
+type GetAPIKeysHandler struct {
+	BaseHandler
+}
+
+// NewGetAPIKeysHandler is the constructor for GetAPIKeysHandler
+func NewGetAPIKeysHandler(app *app.App) *GetAPIKeysHandler {
+	return &GetAPIKeysHandler{
+		BaseHandler: BaseHandler{app},
+	}
+}
+
+// ServeHTTP handles the HTTP request for the API keys of the user including revoked ones
+func (handler *GetAPIKeysHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), ctxTimeout)
+	defer cancel()
+
+	if req.Method != http.MethodGet {
+		middleware.Logger(req.Context()).Debug("Only GET requests are allowed")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	if userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := handler.app.KeyService.List(ctx, userID)
+	if err != nil {
+		middleware.Logger(req.Context()).Error("Can not get API keys", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]apiKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		resp = append(resp, newAPIKeyResponse(key))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// DeleteAPIKeyHandler handles DELETE requests for revoking API keys
+type DeleteAPIKeyHandler struct {
+	BaseHandler
+}
+
+// NewDeleteAPIKeyHandler is the constructor for DeleteAPIKeyHandler
+func NewDeleteAPIKeyHandler(app *app.App) *DeleteAPIKeyHandler {
+	return &DeleteAPIKeyHandler{
+		BaseHandler: BaseHandler{app},
+	}
+}
+
+// ServeHTTP handles the HTTP request for revoking an API key of the user
+// Revoked keys stay in the list, keys of other users are reported as not found
+func (handler *DeleteAPIKeyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), ctxTimeout)
+	defer cancel()
+
+	if req.Method != http.MethodDelete {
+		middleware.Logger(req.Context()).Debug("Only DELETE requests are allowed")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	if userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	_, err := handler.app.KeyService.Revoke(ctx, userID, chi.URLParam(req, idParam))
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		writeError(w, http.StatusNotFound, "api key not found")
+		return
+	}
+	if err != nil {
+		middleware.Logger(req.Context()).Error("Can not revoke API key", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+)
+
+func TestAPIKeyHandlers(t *testing.T) {
+	ap := app.NewApp(storage.NewMemoryStorage(), config.NewConfig(), nil)
+
+	r := chi.NewRouter()
+	r.Method(http.MethodPost, "/api/user/keys", NewPostAPIKeyHandler(ap))
+	r.Method(http.MethodGet, "/api/user/keys", NewGetAPIKeysHandler(ap))
+	r.Method(http.MethodDelete, "/api/user/keys/{id}", NewDeleteAPIKeyHandler(ap))
+
+	serve := func(method, path, userID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if userID != "" {
+			req = req.WithContext(middleware.SetUserID(req.Context(), userID))
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, "/api/user/keys", "", `{"name":"ci","scopes":["read"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/user/keys", "user123", `{"name":"ci"`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/user/keys", "user123", `{"name":"ci","scopes":["admin"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, "/api/user/keys", "user123", `{"scopes":["read"]}`).Code)
+
+	w := serve(http.MethodPost, "/api/user/keys", "user123", `{"name":"ci","scopes":["shorten","read"]}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var created apiKeyResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.NotEmpty(t, created.ID)
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+	assert.Equal(t, []string{"read", "shorten"}, created.Scopes)
+
+	userID, _, err := ap.KeyService.Authenticate(t.Context(), created.Key)
+	require.NoError(t, err)
+	assert.Equal(t, "user123", userID)
+
+	// The key itself is never listed
+	w = serve(http.MethodGet, "/api/user/keys", "user123", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Key)
+	var list []apiKeyResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	require.Len(t, list, 1)
+	assert.Equal(t, created.ID, list[0].ID)
+	assert.Nil(t, list[0].RevokedAt)
+
+	w = serve(http.MethodGet, "/api/user/keys", "other", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/api/user/keys/"+created.ID, "other", "").Code)
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/api/user/keys/"+created.ID, "user123", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/api/user/keys/missing", "user123", "").Code)
+
+	w = serve(http.MethodGet, "/api/user/keys", "user123", "")
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	require.Len(t, list, 1)
+	assert.NotNil(t, list[0].RevokedAt)
+}
@@ -0,0 +1,142 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/as"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// credentialsRequest represents the request for registration or login, it is the format of auth-service
+type credentialsRequest struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// tokenResponse represents the response with the token of a user, it is the format of auth-service
+type tokenResponse struct {
+	UserID string `json:"user_id"`
+	Token  string `json:"token"`
+}
+
+// RegisterHandler handles POST requests for registering users in the local auth mode
+type RegisterHandler struct {
+	BaseHandler
+}
+
+// NewRegisterHandler is the constructor for RegisterHandler
+func NewRegisterHandler(app *app.App) *RegisterHandler {
+	return &RegisterHandler{
+		BaseHandler: BaseHandler{app},
+	}
+}
+
+// ServeHTTP handles the HTTP request for registering a user
+// The response has the token of the new user, so that it does not have to log in
+func (handler *RegisterHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), ctxTimeout)
+	defer cancel()
+
+	if req.Method != http.MethodPost {
+		middleware.Logger(req.Context()).Debug("Only POST requests are allowed")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, ok := readCredentials(w, req)
+	if !ok {
+		return
+	}
+
+	userID, token, err := handler.app.AuthService.Register(ctx, body.Login, body.Password)
+	if errors.Is(err, as.ErrInvalidLogin) || errors.Is(err, as.ErrInvalidPassword) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, storage.ErrUserExists) {
+		writeError(w, http.StatusConflict, "login is already taken")
+		return
+	}
+	if err != nil {
+		middleware.Logger(req.Context()).Error("Can not register user", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeToken(w, http.StatusCreated, userID, token)
+}
+
+// LoginHandler handles POST requests for logging in users in the local auth mode
+type LoginHandler struct {
+	BaseHandler
+}
+
+// NewLoginHandler is the constructor for LoginHandler
+func NewLoginHandler(app *app.App) *LoginHandler {
+	return &LoginHandler{
+		BaseHandler: BaseHandler{app},
+	}
+}
+
+// ServeHTTP handles the HTTP request for logging in a user
+// Unknown logins and wrong passwords get the same response
+func (handler *LoginHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), ctxTimeout)
+	defer cancel()
+
+	if req.Method != http.MethodPost {
+		middleware.Logger(req.Context()).Debug("Only POST requests are allowed")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, ok := readCredentials(w, req)
+	if !ok {
+		return
+	}
+
+	userID, token, err := handler.app.AuthService.Login(ctx, body.Login, body.Password)
+	if errors.Is(err, as.ErrInvalidCredentials) {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		middleware.Logger(req.Context()).Error("Can not log in user", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeToken(w, http.StatusOK, userID, token)
+}
+
+// readCredentials parses the credentials of a request and writes the error response if they are malformed
+// w is the HTTP response writer
+// req is the HTTP request
+// Returns the credentials and whether they were parsed
+func readCredentials(w http.ResponseWriter, req *http.Request) (credentialsRequest, bool) {
+	defer req.Body.Close()
+	var body credentialsRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		middleware.Logger(req.Context()).Debug("Can not parse body", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return body, false
+	}
+	return body, true
+}
+
+// writeToken writes the response with the token of a user
+// w is the HTTP response writer
+// code is the HTTP status code
+// userID is the user identifier
+// token is the issued token
+func writeToken(w http.ResponseWriter, code int, userID, token string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(tokenResponse{UserID: userID, Token: token})
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/as"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+)
+
+func TestAuthHandlers(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	ap := app.NewApp(store, config.NewConfig(), nil)
+	authService, err := as.NewAuthService(store, "supersecretkey", time.Hour)
+	require.NoError(t, err)
+	ap.AuthService = authService
+
+	serve := func(h http.Handler, method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/api/auth", strings.NewReader(body)))
+		return w
+	}
+	register := NewRegisterHandler(ap)
+	login := NewLoginHandler(ap)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(register, http.MethodGet, "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(register, http.MethodPost, `{"login":"alice"`).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(register, http.MethodPost, `{"login":"alice","password":"short"}`).Code)
+
+	w := serve(register, http.MethodPost, `{"login":"alice","password":"correct horse"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var registered tokenResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&registered))
+	assert.NotEmpty(t, registered.UserID)
+	userID, err := authService.ValidateToken(registered.Token)
+	require.NoError(t, err)
+	assert.Equal(t, registered.UserID, userID)
+
+	assert.Equal(t, http.StatusConflict, serve(register, http.MethodPost, `{"login":"alice","password":"another password"}`).Code)
+
+	w = serve(login, http.MethodPost, `{"login":"alice","password":"correct horse"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var loggedIn tokenResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&loggedIn))
+	assert.Equal(t, registered.UserID, loggedIn.UserID)
+	assert.NotEmpty(t, loggedIn.Token)
+
+	// Unknown logins and wrong passwords are not told apart
+	wrong := serve(login, http.MethodPost, `{"login":"alice","password":"wrong password"}`)
+	unknown := serve(login, http.MethodPost, `{"login":"bob","password":"correct horse"}`)
+	assert.Equal(t, http.StatusUnauthorized, wrong.Code)
+	assert.Equal(t, http.StatusUnauthorized, unknown.Code)
+	assert.Equal(t, wrong.Body.String(), unknown.Body.String())
+}
@@ -2,9 +2,12 @@
 package handlers
 
 import (
+	"encoding/json"
+	"net/http"
 	"time"
 
 	"github.com/vitalykrupin/url-shortener/internal/app"
+	"go.uber.org/zap"
 )
 
 const (
@@ -14,8 +17,8 @@ const (
 	// idParam is the URL parameter name for ID
 	idParam = "id"
 	
-	// aliasSize is the default alias size
-	aliasSize = 8
+	// aliasAttempts is the maximum number of attempts to generate free aliases
+	aliasAttempts = 10
 )
 
 // BaseHandler is the base structure for all handlers
@@ -27,3 +30,20 @@ type BaseHandler struct {
 func NewBaseHandler(app *app.App) *BaseHandler {
 	return &BaseHandler{app: app}
 }
+
+// errorResponse represents the JSON error response
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeError writes a JSON error response
+// w is the HTTP response writer
+// code is the HTTP status code
+// message is the error description for the client
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(errorResponse{Error: message}); err != nil {
+		zap.L().Warn("Can not write error response", zap.Error(err))
+	}
+}
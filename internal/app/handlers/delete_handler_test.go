@@ -12,14 +12,16 @@ import (
 	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
 	"github.com/vitalykrupin/url-shortener/internal/app"
 	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ds"
 	"github.com/vitalykrupin/url-shortener/internal/app/storage"
 )
 
 // mockDeleteService is a mock implementation for testing
 type mockDeleteService struct{}
 
-func (m *mockDeleteService) Add(userID string, urls []string) {
+func (m *mockDeleteService) Add(ctx context.Context, userID string, urls []string) (string, error) {
 	// Mock implementation - do nothing
+	return "job1", nil
 }
 
 func (m *mockDeleteService) Start(workers int) {
@@ -30,6 +32,10 @@ func (m *mockDeleteService) Stop() {
 	// Mock implementation - do nothing
 }
 
+func (m *mockDeleteService) Stats() ds.Stats {
+	return ds.Stats{}
+}
+
 func TestDeleteHandler_ValidRequest(t *testing.T) {
 	conf := config.NewConfig()
 	conf.ResponseAddress = "http://localhost:8080"
@@ -58,6 +64,9 @@ func TestDeleteHandler_ValidRequest(t *testing.T) {
 	if res.StatusCode != http.StatusAccepted {
 		t.Fatalf("expected 202 status, got %d", res.StatusCode)
 	}
+	if location := res.Header.Get("Location"); location != "http://localhost:8080/api/user/delete-jobs/job1" {
+		t.Fatalf("expected job status URL in Location, got %q", location)
+	}
 }
 
 func TestDeleteHandler_NoUserID(t *testing.T) {
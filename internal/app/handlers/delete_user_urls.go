@@ -2,12 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
-	"log"
 	"net/http"
 
 	"github.com/vitalykrupin/url-shortener/internal/app"
 	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ds"
+	"go.uber.org/zap"
 )
 
 type NewDeleteUserURLs struct {
@@ -22,7 +24,7 @@ func NewDeleteHandler(app *app.App) *NewDeleteUserURLs {
 
 func (handler *NewDeleteUserURLs) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodDelete {
-		log.Println("Only DELETE requests are allowed!")
+		middleware.Logger(req.Context()).Debug("Only DELETE requests are allowed")
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
@@ -37,15 +39,27 @@ func (handler *NewDeleteUserURLs) ServeHTTP(w http.ResponseWriter, req *http.Req
 	var aliases []string
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
-		log.Println("Can not read body")
+		middleware.Logger(req.Context()).Debug("Can not read body")
 		return
 	}
 	if err := json.Unmarshal(body, &aliases); err != nil {
-		log.Println("Can not unmarshal body")
+		middleware.Logger(req.Context()).Debug("Can not unmarshal body")
 		return
 	}
 
-	handler.app.DeleteService.Add(userUUID, aliases)
+	// The job is persisted before the response, so accepted deletions survive a restart
+	jobID, err := handler.app.DeleteService.Add(req.Context(), userUUID, aliases)
+	if err != nil {
+		middleware.Logger(req.Context()).Error("Can not queue deletion", zap.Error(err))
+		if errors.Is(err, ds.ErrStopped) {
+			writeError(w, http.StatusServiceUnavailable, "service is shutting down")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "can not queue deletion")
+		return
+	}
+
+	w.Header().Set("Location", handler.app.Config().ResponseAddress+deleteJobsPath+jobID)
 
 	w.WriteHeader(http.StatusAccepted)
 }
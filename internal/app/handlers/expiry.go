@@ -0,0 +1,38 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxExpiresIn is the maximum link lifetime in seconds accepted in expires_in, 100 years
+// Larger values would overflow time.Duration, links that should live longer are created without expiration
+const maxExpiresIn = 100 * 365 * 24 * 60 * 60
+
+// parseExpiry converts the expiration fields of a create request to the expiration time
+// expiresIn is the link lifetime in seconds, zero if not set
+// expiresAt is the absolute expiration time, nil if not set
+// now is the request time
+// Returns the expiration time, nil for links without expiration, and an error if the fields are invalid
+func parseExpiry(expiresIn int64, expiresAt *time.Time, now time.Time) (*time.Time, error) {
+	switch {
+	case expiresIn != 0 && expiresAt != nil:
+		return nil, errors.New("only one of expires_in and expires_at can be set")
+	case expiresIn < 0:
+		return nil, errors.New("expires_in must be positive")
+	case expiresIn > maxExpiresIn:
+		return nil, fmt.Errorf("expires_in must not exceed %d seconds", maxExpiresIn)
+	case expiresIn > 0:
+		t := now.Add(time.Duration(expiresIn) * time.Second).UTC()
+		return &t, nil
+	case expiresAt != nil:
+		if !expiresAt.After(now) {
+			return nil, errors.New("expires_at must be in the future")
+		}
+		t := expiresAt.UTC()
+		return &t, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	future := now.Add(24 * time.Hour)
+	past := now.Add(-time.Second)
+
+	tests := []struct {
+		name      string
+		expiresIn int64
+		expiresAt *time.Time
+		want      *time.Time
+		wantErr   bool
+	}{
+		{name: "no expiration"},
+		{name: "expires in", expiresIn: 3600, want: ptr(now.Add(time.Hour))},
+		{name: "expires at", expiresAt: &future, want: &future},
+		{name: "both", expiresIn: 60, expiresAt: &future, wantErr: true},
+		{name: "negative expires in", expiresIn: -1, wantErr: true},
+		{name: "maximum expires in", expiresIn: maxExpiresIn, want: ptr(now.Add(maxExpiresIn * time.Second))},
+		{name: "too large expires in", expiresIn: maxExpiresIn + 1, wantErr: true},
+		{name: "overflowing expires in", expiresIn: 1 << 62, wantErr: true},
+		{name: "expires at in the past", expiresAt: &past, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExpiry(tt.expiresIn, tt.expiresAt, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseExpiry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("parseExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
@@ -4,8 +4,8 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
 	"net/http"
+	"time"
 
 	"github.com/vitalykrupin/url-shortener/internal/app"
 	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
@@ -18,8 +18,10 @@ type GetAllUserURLs struct {
 
 // getUserURLsResponseUnit represents a single unit in the user URLs response
 type getUserURLsResponseUnit struct {
-	Alias       string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	Alias       string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Expired     bool       `json:"expired,omitempty"`
 }
 
 // NewGetAllUserURLs is the constructor for GetAllUserURLs
@@ -35,7 +37,7 @@ func (handler *GetAllUserURLs) ServeHTTP(w http.ResponseWriter, req *http.Reques
 	defer cancel()
 
 	if req.Method != http.MethodGet {
-		log.Println("Only GET requests are allowed!")
+		middleware.Logger(req.Context()).Debug("Only GET requests are allowed")
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
@@ -53,16 +55,20 @@ func (handler *GetAllUserURLs) ServeHTTP(w http.ResponseWriter, req *http.Reques
 	}
 
 	if len(urls) == 0 {
-		log.Println(userUUIDAny)
+		middleware.Logger(req.Context()).Debug("User has no URLs")
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
+	now := time.Now()
+	baseURL := handler.app.Config().ResponseAddress
 	result := make([]getUserURLsResponseUnit, 0, len(urls))
-	for alias, originalURL := range urls {
+	for _, url := range urls {
 		result = append(result, getUserURLsResponseUnit{
-			Alias:       handler.app.Config.ResponseAddress + "/" + string(alias),
-			OriginalURL: string(originalURL),
+			Alias:       baseURL + "/" + string(url.Alias),
+			OriginalURL: string(url.URL),
+			ExpiresAt:   url.ExpiresAt,
+			Expired:     url.Expired(now),
 		})
 	}
 
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
 	"github.com/vitalykrupin/url-shortener/internal/app"
@@ -41,9 +43,15 @@ func TestGetAllUserURLs_WithURLs(t *testing.T) {
 	h.ServeHTTP(w, req)
 	res := w.Result()
 	defer res.Body.Close()
-	// File storage doesn't support GetUserURLs, so it returns 400
-	if res.StatusCode != http.StatusBadRequest {
-		t.Fatalf("expected 400 status (file storage doesn't support GetUserURLs), got %d", res.StatusCode)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 status, got %d", res.StatusCode)
+	}
+	var body []getUserURLsResponseUnit
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != 2 {
+		t.Fatalf("expected 2 URLs, got %d", len(body))
 	}
 }
 
@@ -68,9 +76,8 @@ func TestGetAllUserURLs_NoURLs(t *testing.T) {
 	h.ServeHTTP(w, req)
 	res := w.Result()
 	defer res.Body.Close()
-	// File storage doesn't support GetUserURLs, so it returns 400
-	if res.StatusCode != http.StatusBadRequest {
-		t.Fatalf("expected 400 status (file storage doesn't support GetUserURLs), got %d", res.StatusCode)
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 status, got %d", res.StatusCode)
 	}
 }
 
@@ -125,3 +132,40 @@ func TestGetAllUserURLs_WrongMethod(t *testing.T) {
 		t.Fatalf("expected 405 status, got %d", res.StatusCode)
 	}
 }
+
+func TestGetAllUserURLs_Expired(t *testing.T) {
+	conf := config.NewConfig()
+	conf.ResponseAddress = "http://localhost:8080"
+	store := storage.NewMemoryStorage()
+	ap := app.NewApp(store, conf, nil)
+
+	ctx := middleware.SetUserID(context.Background(), "user123")
+	past := time.Now().Add(-time.Minute)
+	_, _ = store.AddOrGet(ctx, map[storage.Alias]storage.OriginalURL{"promo": "https://promo.com"}, &past)
+	_, _ = store.AddOrGet(ctx, map[storage.Alias]storage.OriginalURL{"forever": "https://forever.com"}, nil)
+	_, _ = store.DeleteExpiredURLs(ctx, time.Now())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	req = req.WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	NewGetAllUserURLs(ap).ServeHTTP(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 status, got %d", res.StatusCode)
+	}
+	var body []getUserURLsResponseUnit
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != 2 {
+		t.Fatalf("expected 2 URLs, got %d", len(body))
+	}
+	if body[0].Expired || body[0].ExpiresAt != nil {
+		t.Errorf("expected URL without expiration first, got %+v", body[0])
+	}
+	if !body[1].Expired || body[1].ExpiresAt == nil {
+		t.Errorf("expected expired URL, got %+v", body[1])
+	}
+}
@@ -0,0 +1,100 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// deleteJobsPath is the path prefix of delete job status URLs
+const deleteJobsPath = "/api/user/delete-jobs/"
+
+// GetDeleteJobHandler handles GET requests for the status of a delete job
+type GetDeleteJobHandler struct {
+	BaseHandler
+}
+
+// deleteJobAliasResult represents the result of a single alias of a delete job
+type deleteJobAliasResult struct {
+	Alias  string `json:"alias"`
+	Result string `json:"result"`
+}
+
+// deleteJobResponse represents the delete job status response
+type deleteJobResponse struct {
+	ID        string                 `json:"id"`
+	Status    string                 `json:"status"`
+	Attempts  int                    `json:"attempts"`
+	Error     string                 `json:"error,omitempty"`
+	Results   []deleteJobAliasResult `json:"results"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// NewGetDeleteJobHandler is the constructor for GetDeleteJobHandler
+func NewGetDeleteJobHandler(app *app.App) *GetDeleteJobHandler {
+	return &GetDeleteJobHandler{
+		BaseHandler: BaseHandler{app},
+	}
+}
+
+// ServeHTTP handles the HTTP request for the status of a delete job
+// Jobs of other users are reported as not found
+func (handler *GetDeleteJobHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), ctxTimeout)
+	defer cancel()
+
+	if req.Method != http.MethodGet {
+		middleware.Logger(req.Context()).Debug("Only GET requests are allowed")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	if userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	job, err := handler.app.Store.GetDeleteJob(ctx, chi.URLParam(req, idParam))
+	if err != nil && !errors.Is(err, storage.ErrJobNotFound) {
+		middleware.Logger(req.Context()).Error("Can not get delete job", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err != nil || job.UserID != userID {
+		writeError(w, http.StatusNotFound, "delete job not found")
+		return
+	}
+
+	resp := deleteJobResponse{
+		ID:        job.ID,
+		Status:    job.Status,
+		Attempts:  job.Attempts,
+		Error:     job.LastError,
+		Results:   make([]deleteJobAliasResult, 0, len(job.Aliases)),
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+	for _, alias := range job.Aliases {
+		// Aliases of unfinished jobs have no result yet and share the job status
+		result, ok := job.Results[alias]
+		if !ok {
+			result = job.Status
+		}
+		resp.Results = append(resp.Results, deleteJobAliasResult{Alias: alias, Result: result})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ds"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"github.com/vitalykrupin/url-shortener/internal/app/utils"
+	"go.uber.org/zap"
+)
+
+func TestGetDeleteJobHandler_ServeHTTP(t *testing.T) {
+	conf := config.NewConfig()
+	conf.ResponseAddress = "http://localhost:8080"
+	conf.FileStorePath = filepath.Join(t.TempDir(), "testfile.json")
+	store, err := storage.NewStorage(conf)
+	require.NoError(t, err)
+	defer func() {
+		_ = store.CloseStorage(context.Background())
+	}()
+
+	ctx := middleware.SetUserID(context.Background(), "user123")
+	require.NoError(t, store.Add(ctx, map[storage.Alias]storage.OriginalURL{"mine": "https://mine.com"}))
+	otherCtx := middleware.SetUserID(context.Background(), "user456")
+	require.NoError(t, store.Add(otherCtx, map[storage.Alias]storage.OriginalURL{"theirs": "https://theirs.com"}))
+
+	deleteSvc := ds.NewDeleteService(store, zap.NewNop())
+	ap := app.NewApp(store, conf, deleteSvc)
+
+	body, _ := json.Marshal([]string{"mine", "theirs"})
+	req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", bytes.NewReader(body))
+	req = req.WithContext(ctx)
+	w := httptest.NewRecorder()
+	NewDeleteHandler(ap).ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	jobID := path.Base(w.Header().Get("Location"))
+
+	getJob := func(userID string) *httptest.ResponseRecorder {
+		req := utils.AddChiContext(httptest.NewRequest(http.MethodGet, deleteJobsPath+jobID, nil), map[string]string{idParam: jobID})
+		if userID != "" {
+			req = req.WithContext(middleware.SetUserID(req.Context(), userID))
+		}
+		w := httptest.NewRecorder()
+		NewGetDeleteJobHandler(ap).ServeHTTP(w, req)
+		return w
+	}
+
+	// The job is persisted but not processed until the service is started
+	w = getJob("user123")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp deleteJobResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, jobID, resp.ID)
+	assert.Equal(t, storage.DeleteJobPending, resp.Status)
+	assert.Equal(t, []deleteJobAliasResult{
+		{Alias: "mine", Result: storage.DeleteJobPending},
+		{Alias: "theirs", Result: storage.DeleteJobPending},
+	}, resp.Results)
+
+	deleteSvc.Start(1)
+	deleteSvc.Stop()
+
+	w = getJob("user123")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, storage.DeleteJobDone, resp.Status)
+	assert.Equal(t, 1, resp.Attempts)
+	assert.Equal(t, []deleteJobAliasResult{
+		{Alias: "mine", Result: storage.DeleteResultDeleted},
+		{Alias: "theirs", Result: storage.DeleteResultNotOwner},
+	}, resp.Results)
+
+	assert.Equal(t, http.StatusUnauthorized, getJob("").Code)
+	assert.Equal(t, http.StatusNotFound, getJob("user456").Code)
+	jobID = "missing"
+	assert.Equal(t, http.StatusNotFound, getJob("user123").Code)
+}
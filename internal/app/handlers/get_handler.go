@@ -4,12 +4,16 @@ package handlers
 import (
 	"context"
 	"errors"
-	"log"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/metrics"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
 	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
 )
 
 // GetHandler handles GET requests for URL redirection
@@ -30,27 +34,62 @@ func (handler *GetHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	defer cancel()
 
 	if req.Method != http.MethodGet {
-		log.Println("Only GET requests are allowed!")
+		middleware.Logger(req.Context()).Debug("Only GET requests are allowed")
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 	alias := chi.URLParam(req, idParam)
 	if alias == "" {
-		log.Println("Get query require Id")
+		middleware.Logger(req.Context()).Debug("Get query require Id")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	if URL, err := handler.app.Store.GetURL(ctx, storage.Alias(alias)); err != nil {
+		if errors.Is(err, storage.ErrExpired) {
+			handler.app.Metrics.Redirect(metrics.RedirectGone)
+			writeError(w, http.StatusGone, "link expired")
+			return
+		}
 		if errors.Is(err, storage.ErrDeleted) {
+			handler.app.Metrics.Redirect(metrics.RedirectGone)
 			w.WriteHeader(http.StatusGone)
 			return
 		}
-		log.Println("URL by alias " + alias + " is not exists")
+		handler.app.Metrics.Redirect(metrics.RedirectMiss)
+		middleware.Logger(req.Context()).Debug("URL by alias is not exists", zap.String("alias", alias))
 		w.WriteHeader(http.StatusNotFound)
 		return
 	} else {
+		handler.app.Metrics.Redirect(metrics.RedirectHit)
+		handler.recordClick(req, storage.Alias(alias))
 		w.Header().Add("Location", string(URL))
 		w.WriteHeader(http.StatusTemporaryRedirect)
 		return
 	}
 }
+
+// recordClick queues the redirect for statistics if click recording is enabled
+// req is the redirect request
+// alias is the short URL alias
+func (handler *GetHandler) recordClick(req *http.Request, alias storage.Alias) {
+	if handler.app.ClickService == nil {
+		return
+	}
+	handler.app.ClickService.Add(storage.Click{
+		Alias:     alias,
+		Time:      time.Now(),
+		Referrer:  req.Referer(),
+		UserAgent: req.UserAgent(),
+		IP:        clientIP(req),
+	})
+}
+
+// clientIP returns the client address without port
+// RemoteAddr is already replaced with the real client IP by the RealIP middleware
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
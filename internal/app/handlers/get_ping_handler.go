@@ -3,10 +3,11 @@ package handlers
 
 import (
 	"context"
-	"log"
 	"net/http"
 
 	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"go.uber.org/zap"
 )
 
 // GetPingHandler handles GET requests for ping endpoint
@@ -29,7 +30,8 @@ func (handler *GetPingHandler) ServeHTTP(w http.ResponseWriter, req *http.Reques
 	if handler.app.Store != nil {
 		err := handler.app.Store.PingStorage(ctx)
 		if err != nil {
-			log.Println("Can not connect to database")
+			middleware.Logger(req.Context()).Error("Can not connect to database", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 		w.WriteHeader(http.StatusOK)
@@ -0,0 +1,90 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// GetURLHistoryHandler handles GET requests for the edit history of a user URL
+type GetURLHistoryHandler struct {
+	BaseHandler
+}
+
+// urlEditResponse represents a previous state of a user URL
+type urlEditResponse struct {
+	OriginalURL string     `json:"original_url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	EditedAt    time.Time  `json:"edited_at"`
+}
+
+// NewGetURLHistoryHandler is the constructor for GetURLHistoryHandler
+func NewGetURLHistoryHandler(app *app.App) *GetURLHistoryHandler {
+	return &GetURLHistoryHandler{
+		BaseHandler: BaseHandler{app},
+	}
+}
+
+// ServeHTTP handles the HTTP request for the edit history of a user URL
+// Only the owner of the short URL can see its history
+func (handler *GetURLHistoryHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), ctxTimeout)
+	defer cancel()
+
+	if req.Method != http.MethodGet {
+		middleware.Logger(req.Context()).Debug("Only GET requests are allowed")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	if userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	alias := storage.Alias(chi.URLParam(req, idParam))
+	record, err := handler.app.Store.GetURLRecord(ctx, alias)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "link not found")
+			return
+		}
+		middleware.Logger(req.Context()).Error("Can not get URL record", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if record.UserID != userID {
+		writeError(w, http.StatusForbidden, "link belongs to another user")
+		return
+	}
+
+	history, err := handler.app.Store.GetURLHistory(ctx, alias)
+	if err != nil {
+		middleware.Logger(req.Context()).Error("Can not get URL history", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]urlEditResponse, 0, len(history))
+	for _, edit := range history {
+		result = append(result, urlEditResponse{
+			OriginalURL: string(edit.URL),
+			ExpiresAt:   edit.ExpiresAt,
+			EditedAt:    edit.EditedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(result)
+}
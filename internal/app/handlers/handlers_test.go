@@ -14,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
 	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
 	"github.com/vitalykrupin/url-shortener/internal/app/storage"
 	"github.com/vitalykrupin/url-shortener/internal/app/utils"
 )
@@ -47,6 +48,15 @@ func TestGetHandler_ServeHTTP(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	userCtx := middleware.SetUserID(context.Background(), "user123")
+	err = store.Add(userCtx, map[storage.Alias]storage.OriginalURL{"delDEL": "https://ya.ru"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.DeleteUserURLs(userCtx, "user123", []string{"delDEL"})
+	if err != nil {
+		t.Fatal(err)
+	}
 	newApp := app.NewApp(store, conf, nil)
 	tests := []struct {
 		name string
@@ -75,6 +85,17 @@ func TestGetHandler_ServeHTTP(t *testing.T) {
 				location: "",
 			},
 		},
+		{
+			name: "deleted GET handler test",
+			args: args{
+				w:   httptest.NewRecorder(),
+				req: utils.AddChiContext(httptest.NewRequest(http.MethodGet, "/delDEL", nil), map[string]string{idParam: "delDEL"}),
+			},
+			want: want{
+				code:     http.StatusGone,
+				location: "",
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
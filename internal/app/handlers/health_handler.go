@@ -0,0 +1,80 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/health"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"go.uber.org/zap"
+)
+
+// HealthzHandler handles GET requests for the liveness probe
+type HealthzHandler struct {
+	BaseHandler
+}
+
+// NewHealthzHandler is the constructor for HealthzHandler
+func NewHealthzHandler(app *app.App) *HealthzHandler {
+	return &HealthzHandler{
+		BaseHandler: BaseHandler{app},
+	}
+}
+
+// ServeHTTP handles the HTTP request for the liveness probe
+// The process is alive as long as it answers, dependencies are not checked
+func (handler *HealthzHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		middleware.Logger(req.Context()).Debug("Only GET requests are allowed")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	writeReport(w, req, health.Report{Status: health.StatusOK}, http.StatusOK)
+}
+
+// ReadyzHandler handles GET requests for the readiness probe
+type ReadyzHandler struct {
+	BaseHandler
+}
+
+// NewReadyzHandler is the constructor for ReadyzHandler
+func NewReadyzHandler(app *app.App) *ReadyzHandler {
+	return &ReadyzHandler{
+		BaseHandler: BaseHandler{app},
+	}
+}
+
+// ServeHTTP handles the HTTP request for the readiness probe
+// The response reports every check with its latency, 503 means the instance should not get traffic
+func (handler *ReadyzHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		middleware.Logger(req.Context()).Debug("Only GET requests are allowed")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := handler.app.Health.Check(req.Context())
+	code := http.StatusOK
+	if !report.Ready() {
+		code = http.StatusServiceUnavailable
+		middleware.Logger(req.Context()).Warn("Not ready", zap.String("status", report.Status), zap.Any("checks", report.Checks))
+	}
+	writeReport(w, req, report, code)
+}
+
+// writeReport writes a JSON health report
+// w is the HTTP response writer
+// req is the HTTP request
+// report is the health report
+// code is the HTTP status code
+func writeReport(w http.ResponseWriter, req *http.Request, report health.Report, code int) {
+	// Probes must see the current state, not a cached one
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		middleware.Logger(req.Context()).Warn("Can not write health report", zap.Error(err))
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/health"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+)
+
+func TestHealthzHandler_ServeHTTP(t *testing.T) {
+	ap := app.NewApp(storage.NewMemoryStorage(), config.NewConfig(), nil)
+	// Liveness does not depend on readiness
+	ap.Health.Shutdown()
+
+	w := httptest.NewRecorder()
+	NewHealthzHandler(ap).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadyzHandler_ServeHTTP(t *testing.T) {
+	ap := app.NewApp(storage.NewMemoryStorage(), config.NewConfig(), nil)
+	readyz := func() (int, health.Report) {
+		w := httptest.NewRecorder()
+		NewReadyzHandler(ap).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		var report health.Report
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, report
+	}
+
+	code, report := readyz()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusOK, report.Checks["storage"].Status)
+
+	ap.Health.Register("delete_queue", func(ctx context.Context) error { return errors.New("queue is full") })
+	code, report = readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusFail, report.Status)
+	assert.Equal(t, "queue is full", report.Checks["delete_queue"].Error)
+
+	ap.Health.Shutdown()
+	code, report = readyz()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, health.StatusShuttingDown, report.Status)
+}
+
+func TestReadyzHandler_NoStorage(t *testing.T) {
+	ap := app.NewApp(nil, config.NewConfig(), nil)
+
+	w := httptest.NewRecorder()
+	NewReadyzHandler(ap).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -0,0 +1,126 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// PatchUserURLHandler handles PATCH requests for editing a user URL
+type PatchUserURLHandler struct {
+	BaseHandler
+}
+
+// patchURLRequest represents the JSON request structure for editing a user URL, omitted fields are left unchanged
+type patchURLRequest struct {
+	URL       *string    `json:"url,omitempty"`
+	ExpiresIn int64      `json:"expires_in,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	NoExpiry  bool       `json:"no_expiry,omitempty"`
+}
+
+// NewPatchUserURLHandler is the constructor for PatchUserURLHandler
+func NewPatchUserURLHandler(app *app.App) *PatchUserURLHandler {
+	return &PatchUserURLHandler{
+		BaseHandler: BaseHandler{app},
+	}
+}
+
+// ServeHTTP handles the HTTP request for editing the destination or expiration of a user URL
+// Only the owner of the short URL can edit it
+func (handler *PatchUserURLHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), ctxTimeout)
+	defer cancel()
+
+	if req.Method != http.MethodPatch {
+		middleware.Logger(req.Context()).Debug("Only PATCH requests are allowed")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	if userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	defer req.Body.Close()
+	var body patchURLRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		middleware.Logger(req.Context()).Debug("Can not parse body", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	update, err := body.toUpdate(time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	alias := storage.Alias(chi.URLParam(req, idParam))
+	record, err := handler.app.Store.UpdateUserURL(ctx, userID, alias, update)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			writeError(w, http.StatusNotFound, "link not found")
+		case errors.Is(err, storage.ErrNotOwner):
+			writeError(w, http.StatusForbidden, "link belongs to another user")
+		case errors.Is(err, storage.ErrExpired):
+			writeError(w, http.StatusGone, "link expired")
+		case errors.Is(err, storage.ErrDeleted):
+			writeError(w, http.StatusGone, "link deleted")
+		case errors.Is(err, storage.ErrConflict):
+			writeError(w, http.StatusConflict, "url is already shortened")
+		default:
+			middleware.Logger(req.Context()).Error("Can not update URL", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(getUserURLsResponseUnit{
+		Alias:       handler.app.Config().ResponseAddress + "/" + string(record.Alias),
+		OriginalURL: string(record.URL),
+		ExpiresAt:   record.ExpiresAt,
+	})
+}
+
+// toUpdate validates the request and converts it to the storage update
+// now is the request time
+// Returns the update and an error if the request changes nothing or its fields are invalid
+func (r patchURLRequest) toUpdate(now time.Time) (storage.URLUpdate, error) {
+	var update storage.URLUpdate
+	if r.URL != nil {
+		if *r.URL == "" {
+			return update, errors.New("url must not be empty")
+		}
+		url := storage.OriginalURL(*r.URL)
+		update.URL = &url
+	}
+
+	expiresAt, err := parseExpiry(r.ExpiresIn, r.ExpiresAt, now)
+	if err != nil {
+		return update, err
+	}
+	if r.NoExpiry && expiresAt != nil {
+		return update, errors.New("no_expiry can not be combined with expires_in or expires_at")
+	}
+	update.ExpiresAt = expiresAt
+	update.ClearExpiry = r.NoExpiry
+
+	if update.URL == nil && update.ExpiresAt == nil && !update.ClearExpiry {
+		return update, errors.New("nothing to update")
+	}
+	return update, nil
+}
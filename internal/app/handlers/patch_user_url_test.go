@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"github.com/vitalykrupin/url-shortener/internal/app/utils"
+)
+
+func TestPatchUserURLHandler_ServeHTTP(t *testing.T) {
+	conf := config.NewConfig()
+	conf.ResponseAddress = "http://localhost:8080"
+	conf.FileStorePath = filepath.Join(t.TempDir(), "testfile.json")
+	store, err := storage.NewStorage(conf)
+	require.NoError(t, err)
+	defer func() {
+		_ = store.CloseStorage(context.Background())
+	}()
+	ap := app.NewApp(store, conf, nil)
+
+	ctx := middleware.SetUserID(context.Background(), "user123")
+	_, err = store.AddOrGet(ctx, map[storage.Alias]storage.OriginalURL{
+		"typo":  "https://yandx.ru",
+		"other": "https://ya.ru",
+	}, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		userID string
+		alias  string
+		body   string
+		code   int
+	}{
+		{name: "owner edits URL", userID: "user123", alias: "typo", body: `{"url":"https://yandex.ru","expires_in":3600}`, code: http.StatusOK},
+		{name: "no user", alias: "typo", body: `{"url":"https://yandex.ru"}`, code: http.StatusUnauthorized},
+		{name: "another user", userID: "user456", alias: "typo", body: `{"url":"https://evil.com"}`, code: http.StatusForbidden},
+		{name: "unknown alias", userID: "user123", alias: "missing", body: `{"url":"https://yandex.ru"}`, code: http.StatusNotFound},
+		{name: "URL of another link", userID: "user123", alias: "typo", body: `{"url":"https://ya.ru"}`, code: http.StatusConflict},
+		{name: "nothing to update", userID: "user123", alias: "typo", body: `{}`, code: http.StatusBadRequest},
+		{name: "empty URL", userID: "user123", alias: "typo", body: `{"url":""}`, code: http.StatusBadRequest},
+		{name: "conflicting expiry", userID: "user123", alias: "typo", body: `{"expires_in":60,"no_expiry":true}`, code: http.StatusBadRequest},
+		{name: "invalid JSON", userID: "user123", alias: "typo", body: `{"url":`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/api/user/urls/"+tt.alias, strings.NewReader(tt.body))
+			req = utils.AddChiContext(req, map[string]string{idParam: tt.alias})
+			if tt.userID != "" {
+				req = req.WithContext(middleware.SetUserID(req.Context(), tt.userID))
+			}
+			w := httptest.NewRecorder()
+			NewPatchUserURLHandler(ap).ServeHTTP(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			require.Equal(t, tt.code, res.StatusCode)
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var body getUserURLsResponseUnit
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, "http://localhost:8080/typo", body.Alias)
+			assert.Equal(t, "https://yandex.ru", body.OriginalURL)
+			assert.NotNil(t, body.ExpiresAt)
+		})
+	}
+
+	url, err := store.GetURL(ctx, "typo")
+	require.NoError(t, err)
+	assert.Equal(t, storage.OriginalURL("https://yandex.ru"), url)
+
+	// The previous destination is kept in the history
+	req := utils.AddChiContext(httptest.NewRequest(http.MethodGet, "/api/user/urls/typo/history", nil), map[string]string{idParam: "typo"})
+	req = req.WithContext(middleware.SetUserID(req.Context(), "user123"))
+	w := httptest.NewRecorder()
+	NewGetURLHistoryHandler(ap).ServeHTTP(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var history []urlEditResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&history))
+	require.Len(t, history, 1)
+	assert.Equal(t, "https://yandx.ru", history[0].OriginalURL)
+
+	req = utils.AddChiContext(httptest.NewRequest(http.MethodGet, "/api/user/urls/typo/history", nil), map[string]string{idParam: "typo"})
+	req = req.WithContext(middleware.SetUserID(req.Context(), "user456"))
+	w = httptest.NewRecorder()
+	NewGetURLHistoryHandler(ap).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
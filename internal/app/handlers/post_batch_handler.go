@@ -4,18 +4,27 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"maps"
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/alias"
 	"github.com/vitalykrupin/url-shortener/internal/app/storage"
-	"github.com/vitalykrupin/url-shortener/internal/app/utils"
+	"go.uber.org/zap"
 )
 
 // postBatchRequestUnit represents a single unit in the batch request
 type postBatchRequestUnit struct {
-	CorrelationID string `json:"correlation_id"`
-	URL           string `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	URL           string     `json:"original_url"`
+	Alias         string     `json:"alias,omitempty"`
+	ExpiresIn     int64      `json:"expires_in,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
 }
 
 // postBatchResponseUnit represents a single unit in the batch response
@@ -24,6 +33,20 @@ type postBatchResponseUnit struct {
 	Alias         string `json:"short_url"`
 }
 
+// expiryGroup holds batch URLs with the same expiration time
+type expiryGroup struct {
+	expiresAt *time.Time
+	urls      []storage.OriginalURL
+}
+
+// expiryKey returns the key of the expiration time for grouping, zero for URLs without expiration
+func expiryKey(expiresAt *time.Time) int64 {
+	if expiresAt == nil {
+		return 0
+	}
+	return expiresAt.UnixNano()
+}
+
 // PostBatchHandler handles POST requests for batch URL creation
 type PostBatchHandler struct {
 	BaseHandler
@@ -43,7 +66,7 @@ func (handler *PostBatchHandler) ServeHTTP(w http.ResponseWriter, req *http.Requ
 	defer req.Body.Close()
 
 	if req.Method != http.MethodPost {
-		log.Println("Only POST requests are allowed!")
+		middleware.Logger(req.Context()).Debug("Only POST requests are allowed")
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
@@ -62,22 +85,105 @@ func (handler *PostBatchHandler) ServeHTTP(w http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	batch := make(map[storage.Alias]storage.OriginalURL)
+	// URLs are grouped by expiration time, since one storage call stores URLs with the same expiration
+	now := time.Now()
+	groups := make(map[int64]*expiryGroup)
+	urlGroups := make(map[storage.OriginalURL]*expiryGroup)
+	customURLs := make(map[storage.OriginalURL]storage.Alias)
+	customAliases := make(map[storage.Alias]storage.OriginalURL)
+	var custom []storage.CustomURL
 	for _, v := range jsonReq {
-		if alias, err := handler.app.Store.GetAlias(ctx, storage.OriginalURL(v.URL)); err == nil {
-			resp = append(resp, postBatchResponseUnit{CorrelationID: v.CorrelationID, Alias: handler.app.Config.ResponseAddress + "/" + string(alias)})
-		} else {
-			alias := utils.RandomString(aliasSize)
-			batch[storage.Alias(alias)] = storage.OriginalURL(v.URL)
-			resp = append(resp, postBatchResponseUnit{CorrelationID: v.CorrelationID, Alias: handler.app.Config.ResponseAddress + "/" + alias})
+		url := storage.OriginalURL(v.URL)
+		expiresAt, err := parseExpiry(v.ExpiresIn, v.ExpiresAt, now)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("correlation_id %s: %v", v.CorrelationID, err))
+			return
+		}
+		key := expiryKey(expiresAt)
+		if g, ok := urlGroups[url]; ok && expiryKey(g.expiresAt) != key {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("URL %s is requested with different expiration", v.URL))
+			return
 		}
+		g, ok := groups[key]
+		if !ok {
+			g = &expiryGroup{expiresAt: expiresAt}
+			groups[key] = g
+		}
+		urlGroups[url] = g
+
+		if v.Alias == "" {
+			continue
+		}
+		if err := alias.ValidateCustom(v.Alias); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("correlation_id %s: %v", v.CorrelationID, err))
+			return
+		}
+		a := storage.Alias(v.Alias)
+		if other, ok := customAliases[a]; ok && other != url {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("alias %q is requested for different URLs", v.Alias))
+			return
+		}
+		if other, ok := customURLs[url]; ok && other != a {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("URL %s is requested with different aliases", v.URL))
+			return
+		}
+		if _, ok := customAliases[a]; !ok {
+			custom = append(custom, storage.CustomURL{Alias: a, URL: url, ExpiresAt: expiresAt})
+		}
+		customAliases[a] = url
+		customURLs[url] = a
+	}
+
+	// Custom aliases go first and all at once, so that nothing is stored if one of them can not be,
+	// and a URL requested both with and without one gets the custom alias
+	stored := make(map[storage.OriginalURL]storage.Alias, len(jsonReq))
+	existing, taken, err := handler.app.Store.AddCustom(ctx, custom)
+	switch {
+	case errors.Is(err, storage.ErrAliasTaken):
+		writeError(w, http.StatusConflict, fmt.Sprintf("aliases are already taken: %v", taken))
+		return
+	case errors.Is(err, storage.ErrConflict):
+		// Like a single custom alias, a URL the user has already shortened is a conflict
+		urls := slices.Sorted(maps.Keys(existing))
+		writeError(w, http.StatusConflict, fmt.Sprintf("URLs are already shortened: %v", urls))
+		return
+	case err != nil:
+		middleware.Logger(req.Context()).Error("Can not add note to database", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	for _, c := range custom {
+		stored[c.URL] = c.Alias
 	}
-	if len(batch) > 0 {
-		if err := handler.app.Store.Add(ctx, batch); err != nil {
-			log.Println("Can not add note to database")
+
+	requested := make(map[storage.OriginalURL]struct{})
+	for _, v := range jsonReq {
+		url := storage.OriginalURL(v.URL)
+		if _, ok := requested[url]; ok {
+			continue
+		}
+		requested[url] = struct{}{}
+		if _, ok := stored[url]; !ok {
+			g := urlGroups[url]
+			g.urls = append(g.urls, url)
+		}
+	}
+	for _, g := range groups {
+		if len(g.urls) == 0 {
+			continue
+		}
+		generated, _, err := shortenURLs(ctx, handler.app.Store, handler.app.AliasGenerator, g.urls, g.expiresAt)
+		if err != nil {
+			middleware.Logger(req.Context()).Error("Can not add note to database", zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		maps.Copy(stored, generated)
+	}
+	baseURL := handler.app.Config().ResponseAddress
+	for _, v := range jsonReq {
+		short := stored[storage.OriginalURL(v.URL)]
+		resp = append(resp, postBatchResponseUnit{CorrelationID: v.CorrelationID, Alias: baseURL + "/" + string(short)})
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
 	"github.com/vitalykrupin/url-shortener/internal/app"
@@ -17,6 +19,8 @@ import (
 type batchReq struct {
 	CorrelationID string `json:"correlation_id"`
 	URL           string `json:"original_url"`
+	Alias         string `json:"alias,omitempty"`
+	ExpiresIn     int64  `json:"expires_in,omitempty"`
 }
 
 type batchResp struct {
@@ -226,3 +230,129 @@ func TestPostBatchHandler_WrongMethod(t *testing.T) {
 		t.Fatalf("expected 405 status, got %d", res.StatusCode)
 	}
 }
+
+func TestPostBatchHandler_CustomAliases(t *testing.T) {
+	conf := config.NewConfig()
+	conf.ResponseAddress = "http://localhost:8080"
+	conf.FileStorePath = filepath.Join(t.TempDir(), "testfile.json")
+	store, err := storage.NewStorage(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = store.CloseStorage(context.Background())
+	}()
+	ap := app.NewApp(store, conf, nil)
+
+	post := func(units []batchReq) *http.Response {
+		body, _ := json.Marshal(units)
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		NewPostBatchHandler(ap).ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	res := post([]batchReq{
+		{CorrelationID: "1", URL: "https://sale", Alias: "spring-sale"},
+		{CorrelationID: "2", URL: "https://random"},
+		{CorrelationID: "3", URL: "https://sale"},
+	})
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected status %d", res.StatusCode)
+	}
+	var resp []batchResp
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp) != 3 {
+		t.Fatalf("expected 3 responses, got %d", len(resp))
+	}
+	if resp[0].Alias != "http://localhost:8080/spring-sale" || resp[2].Alias != resp[0].Alias {
+		t.Fatalf("expected custom alias for both sale units, got %+v", resp)
+	}
+	if resp[1].Alias == "" || resp[1].Alias == resp[0].Alias {
+		t.Fatalf("unexpected generated alias: %+v", resp[1])
+	}
+
+	res = post([]batchReq{{CorrelationID: "1", URL: "https://other", Alias: "spring-sale"}})
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for taken alias, got %d", res.StatusCode)
+	}
+
+	// Nothing is stored when one of the custom aliases is taken
+	res = post([]batchReq{
+		{CorrelationID: "1", URL: "https://free", Alias: "free-alias"},
+		{CorrelationID: "2", URL: "https://other", Alias: "spring-sale"},
+	})
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for partly taken aliases, got %d", res.StatusCode)
+	}
+	if _, err := store.GetURLRecord(context.Background(), "free-alias"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected free alias not to be stored, got %v", err)
+	}
+
+	// A custom alias for an already shortened URL is a conflict, like in PostHandler
+	res = post([]batchReq{{CorrelationID: "1", URL: "https://random", Alias: "random-alias"}})
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for already shortened URL, got %d", res.StatusCode)
+	}
+
+	for _, units := range [][]batchReq{
+		{{CorrelationID: "1", URL: "https://x", Alias: "api"}},
+		{{CorrelationID: "1", URL: "https://x", Alias: "same"}, {CorrelationID: "2", URL: "https://y", Alias: "same"}},
+		{{CorrelationID: "1", URL: "https://x", Alias: "first"}, {CorrelationID: "2", URL: "https://x", Alias: "second"}},
+	} {
+		res = post(units)
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %+v, got %d", units, res.StatusCode)
+		}
+	}
+}
+
+func TestPostBatchHandler_Expiration(t *testing.T) {
+	conf := config.NewConfig()
+	conf.ResponseAddress = "http://localhost:8080"
+	store := storage.NewMemoryStorage()
+	ap := app.NewApp(store, conf, nil)
+
+	post := func(units []batchReq) *http.Response {
+		body, _ := json.Marshal(units)
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		NewPostBatchHandler(ap).ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	res := post([]batchReq{
+		{CorrelationID: "1", URL: "https://hour", Alias: "hour", ExpiresIn: 3600},
+		{CorrelationID: "2", URL: "https://day", Alias: "day", ExpiresIn: 86400},
+		{CorrelationID: "3", URL: "https://forever", Alias: "forever"},
+	})
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected status %d", res.StatusCode)
+	}
+	hour, day := store.MemoryStorage.Expires["hour"], store.MemoryStorage.Expires["day"]
+	if hour.IsZero() || day.Sub(hour) != 23*time.Hour {
+		t.Errorf("expected per unit expiration, got %v and %v", hour, day)
+	}
+	if _, ok := store.MemoryStorage.Expires["forever"]; ok {
+		t.Error("expected URL without expiration")
+	}
+
+	res = post([]batchReq{
+		{CorrelationID: "1", URL: "https://same", ExpiresIn: 60},
+		{CorrelationID: "2", URL: "https://same", ExpiresIn: 120},
+	})
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for different expiration of one URL, got %d", res.StatusCode)
+	}
+}
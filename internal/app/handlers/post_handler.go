@@ -4,19 +4,25 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"time"
 
 	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/alias"
 	"github.com/vitalykrupin/url-shortener/internal/app/storage"
-	"github.com/vitalykrupin/url-shortener/internal/app/utils"
+	"go.uber.org/zap"
 )
 
 // postJSONRequest represents the JSON request structure for POST handler
 type postJSONRequest struct {
-	URL string `json:"url"`
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresIn int64      `json:"expires_in,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // postJSONResponse represents the JSON response structure for POST handler
@@ -42,68 +48,89 @@ func (handler *PostHandler) ServeHTTP(w http.ResponseWriter, req *http.Request)
 	defer cancel()
 
 	if req.Method != http.MethodPost {
-		log.Println("Only POST requests are allowed!")
+		middleware.Logger(req.Context()).Debug("Only POST requests are allowed")
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-	URL, err := parseBody(req)
+	body, err := parseBody(req)
 	if err != nil {
-		log.Println("Can not parse body", err)
+		middleware.Logger(req.Context()).Debug("Can not parse body", zap.Error(err))
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	
 	// Check if URL is empty
-	if URL == "" {
-		log.Println("Empty URL in request")
+	if body.URL == "" {
+		middleware.Logger(req.Context()).Debug("Empty URL in request")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	w.Header().Set("Content-Type", "text/plain")
-	if alias, err := handler.app.Store.GetAlias(ctx, storage.OriginalURL(URL)); err == nil {
-		err := printResponse(w, req, handler.app.Config.ResponseAddress+"/"+string(alias), true)
-		if err != nil {
-			log.Println("Can not print response", err)
-			w.WriteHeader(http.StatusBadRequest)
+	URL := storage.OriginalURL(body.URL)
+	expiresAt, err := parseExpiry(body.ExpiresIn, body.ExpiresAt, time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var (
+		stored       map[storage.OriginalURL]storage.Alias
+		alreadyAdded bool
+	)
+	if body.Alias != "" {
+		if err := alias.ValidateCustom(body.Alias); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-	} else {
-		alias := utils.RandomString(aliasSize)
-		batch := map[storage.Alias]storage.OriginalURL{
-			storage.Alias(alias): storage.OriginalURL(URL),
-		}
-		if err := handler.app.Store.Add(ctx, batch); err != nil {
-			log.Println("Can not add note to database", err)
-		}
-		err := printResponse(w, req, handler.app.Config.ResponseAddress+"/"+alias, false)
-		if err != nil {
-			log.Println("Can not print response", err)
-			w.WriteHeader(http.StatusBadRequest)
+		var existing map[storage.OriginalURL]storage.Alias
+		existing, _, err = handler.app.Store.AddCustom(ctx, []storage.CustomURL{{Alias: storage.Alias(body.Alias), URL: URL, ExpiresAt: expiresAt}})
+		if errors.Is(err, storage.ErrAliasTaken) {
+			writeError(w, http.StatusConflict, fmt.Sprintf("alias %q is already taken", body.Alias))
 			return
 		}
+		// A URL the user has already shortened is answered with its alias, like without a custom alias
+		if alreadyAdded = errors.Is(err, storage.ErrConflict); alreadyAdded {
+			stored, err = existing, nil
+		} else if err == nil {
+			stored = map[storage.OriginalURL]storage.Alias{URL: storage.Alias(body.Alias)}
+		}
+	} else {
+		stored, alreadyAdded, err = shortenURLs(ctx, handler.app.Store, handler.app.AliasGenerator, []storage.OriginalURL{URL}, expiresAt)
+	}
+	if err != nil {
+		middleware.Logger(req.Context()).Error("Can not add note to database", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	short := stored[URL]
+	if err := printResponse(w, req, handler.app.Config().ResponseAddress+"/"+string(short), alreadyAdded); err != nil {
+		middleware.Logger(req.Context()).Warn("Can not print response", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 }
 
 // parseBody parses the request body
+// A plain text body contains only the URL, a JSON body may also contain a custom alias
 // req is the HTTP request
-// Returns the URL string and an error if parsing failed
-func parseBody(req *http.Request) (string, error) {
+// Returns the parsed request and an error if parsing failed
+func parseBody(req *http.Request) (*postJSONRequest, error) {
 	defer req.Body.Close()
 	if req.Header.Get("Content-Type") == "application/json" {
 		jsonReq := new(postJSONRequest)
 		err := json.NewDecoder(req.Body).Decode(jsonReq)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		return jsonReq.URL, nil
+		return jsonReq, nil
 	}
 	body, err := io.ReadAll(req.Body)
 	stringBody := string(body)
 	if stringBody == "" {
-		log.Println("No body in request")
-		return "", fmt.Errorf("no body in request")
+		middleware.Logger(req.Context()).Debug("No body in request")
+		return nil, fmt.Errorf("no body in request")
 	}
-	return stringBody, err
+	return &postJSONRequest{URL: stringBody}, err
 }
 
 // printResponse prints the response
@@ -10,12 +10,14 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
 	"github.com/vitalykrupin/url-shortener/internal/app"
 	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"github.com/vitalykrupin/url-shortener/internal/app/utils"
 )
 
 func TestPostHandler_ServeHTTP_TextPlain(t *testing.T) {
@@ -214,15 +216,110 @@ func TestPostHandler_ServeHTTP_ExistingURL(t *testing.T) {
 	assert.Equal(t, http.StatusConflict, res2.StatusCode)
 }
 
+func TestPostHandler_ServeHTTP_CustomAlias(t *testing.T) {
+	// Setup
+	conf := config.NewConfig()
+	conf.ServerAddress = "localhost:8080"
+	conf.ResponseAddress = "http://localhost:8080"
+	conf.FileStorePath = filepath.Join(t.TempDir(), "testfile.json")
+
+	store, err := storage.NewStorage(conf)
+	require.NoError(t, err)
+	defer func() {
+		_ = store.CloseStorage(context.Background())
+	}()
+
+	handler := NewPostHandler(app.NewApp(store, conf, nil))
+	post := func(body string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	res := post(`{"url":"https://example.com/sale","alias":"spring-sale"}`)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	resp := new(postJSONResponse)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(resp))
+	assert.Equal(t, "http://localhost:8080/spring-sale", resp.Alias)
+
+	url, err := store.GetURL(context.Background(), "spring-sale")
+	require.NoError(t, err)
+	assert.Equal(t, storage.OriginalURL("https://example.com/sale"), url)
+
+	// The alias is taken by another URL
+	res = post(`{"url":"https://example.com/other","alias":"spring-sale"}`)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+	errResp := new(errorResponse)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(errResp))
+	assert.Contains(t, errResp.Error, "already taken")
+
+	for _, body := range []string{
+		`{"url":"https://example.com","alias":"api"}`,
+		`{"url":"https://example.com","alias":"PING"}`,
+		`{"url":"https://example.com","alias":"a/b/c"}`,
+		`{"url":"https://example.com","alias":"ab"}`,
+		`{"url":"https://example.com","alias":"-sale"}`,
+	} {
+		res = post(body)
+		defer res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, body)
+	}
+}
+
+func TestPostHandler_ServeHTTP_Expiration(t *testing.T) {
+	conf := config.NewConfig()
+	conf.ResponseAddress = "http://localhost:8080"
+	store := storage.NewMemoryStorage()
+	newApp := app.NewApp(store, conf, nil)
+	post := func(body string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		NewPostHandler(newApp).ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	res := post(`{"url":"https://example.com/promo","alias":"promo","expires_in":3600}`)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	_, ok := store.MemoryStorage.Expires["promo"]
+	assert.True(t, ok)
+
+	res = post(`{"url":"https://example.com/invite","alias":"invite","expires_at":"2000-01-01T00:00:00Z"}`)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res = post(`{"url":"https://example.com/invite","expires_in":60,"expires_at":"2100-01-01T00:00:00Z"}`)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// Expired link answers 410 with a body that differs from a deleted one
+	past := time.Now().Add(-time.Minute)
+	_, err := store.AddOrGet(context.Background(), map[storage.Alias]storage.OriginalURL{"old": "https://example.com/old"}, &past)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	NewGetHandler(newApp).ServeHTTP(w, utils.AddChiContext(httptest.NewRequest(http.MethodGet, "/old", nil), map[string]string{idParam: "old"}))
+	getRes := w.Result()
+	defer getRes.Body.Close()
+	assert.Equal(t, http.StatusGone, getRes.StatusCode)
+	errResp := new(errorResponse)
+	require.NoError(t, json.NewDecoder(getRes.Body).Decode(errResp))
+	assert.Equal(t, "link expired", errResp.Error)
+}
+
 func TestParseBody_TextPlain(t *testing.T) {
 	// Test case 1: Valid text/plain body
 	t.Run("valid text/plain body", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com"))
 		req.Header.Set("Content-Type", "text/plain")
 
-		url, err := parseBody(req)
+		body, err := parseBody(req)
 		require.NoError(t, err)
-		assert.Equal(t, "https://example.com", url)
+		assert.Equal(t, "https://example.com", body.URL)
 	})
 
 	// Test case 2: Empty text/plain body
@@ -242,9 +339,9 @@ func TestParseBody_ApplicationJSON(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(jsonReq))
 		req.Header.Set("Content-Type", "application/json")
 
-		url, err := parseBody(req)
+		body, err := parseBody(req)
 		require.NoError(t, err)
-		assert.Equal(t, "https://example.com", url)
+		assert.Equal(t, "https://example.com", body.URL)
 	})
 
 	// Test case 2: Invalid JSON body
@@ -263,9 +360,9 @@ func TestParseBody_ApplicationJSON(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(jsonReq))
 		req.Header.Set("Content-Type", "application/json")
 
-		url, err := parseBody(req)
+		body, err := parseBody(req)
 		require.NoError(t, err)
-		assert.Equal(t, "", url)
+		assert.Equal(t, "", body.URL)
 	})
 }
 
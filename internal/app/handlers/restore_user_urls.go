@@ -0,0 +1,79 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"go.uber.org/zap"
+)
+
+// RestoreUserURLsHandler handles POST requests for restoring deleted user URLs
+type RestoreUserURLsHandler struct {
+	BaseHandler
+}
+
+// restoreAliasResult represents the result of restoring a single alias
+type restoreAliasResult struct {
+	Alias  string `json:"alias"`
+	Result string `json:"result"`
+}
+
+// NewRestoreUserURLsHandler is the constructor for RestoreUserURLsHandler
+func NewRestoreUserURLsHandler(app *app.App) *RestoreUserURLsHandler {
+	return &RestoreUserURLsHandler{
+		BaseHandler: BaseHandler{app},
+	}
+}
+
+// ServeHTTP handles the HTTP request for restoring user URLs deleted within the grace period
+// The response reports a result for every requested alias in request order
+func (handler *RestoreUserURLsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), ctxTimeout)
+	defer cancel()
+
+	if req.Method != http.MethodPost {
+		middleware.Logger(req.Context()).Debug("Only POST requests are allowed")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	if userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	defer req.Body.Close()
+	var aliases []string
+	if err := json.NewDecoder(req.Body).Decode(&aliases); err != nil {
+		middleware.Logger(req.Context()).Debug("Can not parse body", zap.Error(err))
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if len(aliases) == 0 {
+		writeError(w, http.StatusBadRequest, "aliases are required")
+		return
+	}
+
+	deletedAfter := time.Now().Add(-handler.app.Config().RestoreGracePeriod)
+	results, err := handler.app.Store.RestoreUserURLs(ctx, userID, aliases, deletedAfter)
+	if err != nil {
+		middleware.Logger(req.Context()).Error("Can not restore URLs", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]restoreAliasResult, 0, len(aliases))
+	for _, alias := range aliases {
+		resp = append(resp, restoreAliasResult{Alias: alias, Result: results[alias]})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+)
+
+func TestRestoreUserURLsHandler_ServeHTTP(t *testing.T) {
+	conf := config.NewConfig()
+	store := storage.NewMemoryStorage()
+	ap := app.NewApp(store, conf, nil)
+
+	ctx := middleware.SetUserID(context.Background(), "user123")
+	require.NoError(t, store.Add(ctx, map[storage.Alias]storage.OriginalURL{
+		"gone": "https://gone.com",
+		"live": "https://live.com",
+	}))
+	_, err := store.DeleteUserURLs(ctx, "user123", []string{"gone"})
+	require.NoError(t, err)
+
+	restore := func(userID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/urls/restore", strings.NewReader(body))
+		if userID != "" {
+			req = req.WithContext(middleware.SetUserID(req.Context(), userID))
+		}
+		w := httptest.NewRecorder()
+		NewRestoreUserURLsHandler(ap).ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, restore("", `["gone"]`).Code)
+	assert.Equal(t, http.StatusBadRequest, restore("user123", `["gone"`).Code)
+	assert.Equal(t, http.StatusBadRequest, restore("user123", `[]`).Code)
+
+	// Restoration is disabled without a grace period
+	conf.RestoreGracePeriod = 0
+	w := restore("user123", `["gone"]`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp []restoreAliasResult
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, []restoreAliasResult{{Alias: "gone", Result: storage.RestoreResultGracePeriodOver}}, resp)
+
+	conf.RestoreGracePeriod = time.Hour
+	w = restore("user123", `["live","gone","missing"]`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, []restoreAliasResult{
+		{Alias: "live", Result: storage.RestoreResultNotDeleted},
+		{Alias: "gone", Result: storage.RestoreResultRestored},
+		{Alias: "missing", Result: storage.RestoreResultNotFound},
+	}, resp)
+
+	url, err := store.GetURL(ctx, "gone")
+	require.NoError(t, err)
+	assert.Equal(t, storage.OriginalURL("https://gone.com"), url)
+}
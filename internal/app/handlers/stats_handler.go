@@ -0,0 +1,97 @@
+// Package handlers provides HTTP request handlers
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// StatsHandler handles GET requests for click statistics of a user URL
+type StatsHandler struct {
+	BaseHandler
+}
+
+// dailyClicksResponse represents the number of clicks during a day
+type dailyClicksResponse struct {
+	Date   string `json:"date"`
+	Clicks int    `json:"clicks"`
+}
+
+// statsResponse represents the click statistics response
+type statsResponse struct {
+	Alias          string                `json:"short_url"`
+	TotalClicks    int                   `json:"total_clicks"`
+	UniqueVisitors int                   `json:"unique_visitors"`
+	Daily          []dailyClicksResponse `json:"daily"`
+}
+
+// NewStatsHandler is the constructor for StatsHandler
+func NewStatsHandler(app *app.App) *StatsHandler {
+	return &StatsHandler{
+		BaseHandler: BaseHandler{app},
+	}
+}
+
+// ServeHTTP handles the HTTP request for click statistics
+// Only the owner of the short URL can see its statistics
+func (handler *StatsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx, cancel := context.WithTimeout(req.Context(), ctxTimeout)
+	defer cancel()
+
+	if req.Method != http.MethodGet {
+		middleware.Logger(req.Context()).Debug("Only GET requests are allowed")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	if userID == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	alias := storage.Alias(chi.URLParam(req, idParam))
+	record, err := handler.app.Store.GetURLRecord(ctx, alias)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "link not found")
+			return
+		}
+		middleware.Logger(req.Context()).Error("Can not get URL record", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if record.UserID != userID {
+		writeError(w, http.StatusForbidden, "link belongs to another user")
+		return
+	}
+
+	stats, err := handler.app.Store.GetClickStats(ctx, alias)
+	if err != nil {
+		middleware.Logger(req.Context()).Error("Can not get click statistics", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	resp := statsResponse{
+		Alias:          handler.app.Config().ResponseAddress + "/" + string(alias),
+		TotalClicks:    stats.Total,
+		UniqueVisitors: stats.UniqueVisitors,
+		Daily:          make([]dailyClicksResponse, 0, len(stats.Daily)),
+	}
+	for _, day := range stats.Daily {
+		resp.Daily = append(resp.Daily, dailyClicksResponse{Date: day.Date, Clicks: day.Clicks})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+	"github.com/vitalykrupin/url-shortener/internal/app"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/cs"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"github.com/vitalykrupin/url-shortener/internal/app/utils"
+	"go.uber.org/zap"
+)
+
+func TestStatsHandler_ServeHTTP(t *testing.T) {
+	conf := config.NewConfig()
+	conf.ResponseAddress = "http://localhost:8080"
+	conf.FileStorePath = filepath.Join(t.TempDir(), "testfile.json")
+	store, err := storage.NewStorage(conf)
+	require.NoError(t, err)
+	defer func() {
+		_ = store.CloseStorage(context.Background())
+	}()
+
+	ctx := middleware.SetUserID(context.Background(), "user123")
+	require.NoError(t, store.Add(ctx, map[storage.Alias]storage.OriginalURL{"abcABC": "https://yandex.ru"}))
+
+	// Redirects are recorded by the click service
+	ap := app.NewApp(store, conf, nil)
+	clickSvc := cs.NewClickService(store, zap.NewNop())
+	clickSvc.Start()
+	ap.ClickService = clickSvc
+	for _, addr := range []string{"10.0.0.1:1234", "10.0.0.1:4321", "10.0.0.2:1234"} {
+		req := utils.AddChiContext(httptest.NewRequest(http.MethodGet, "/abcABC", nil), map[string]string{idParam: "abcABC"})
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		NewGetHandler(ap).ServeHTTP(w, req)
+		require.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	}
+	clickSvc.Stop()
+
+	tests := []struct {
+		name   string
+		userID string
+		alias  string
+		code   int
+	}{
+		{name: "owner", userID: "user123", alias: "abcABC", code: http.StatusOK},
+		{name: "no user", alias: "abcABC", code: http.StatusUnauthorized},
+		{name: "another user", userID: "user456", alias: "abcABC", code: http.StatusForbidden},
+		{name: "unknown alias", userID: "user123", alias: "missing", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := utils.AddChiContext(httptest.NewRequest(http.MethodGet, "/api/user/urls/"+tt.alias+"/stats", nil), map[string]string{idParam: tt.alias})
+			if tt.userID != "" {
+				req = req.WithContext(middleware.SetUserID(req.Context(), tt.userID))
+			}
+			w := httptest.NewRecorder()
+			NewStatsHandler(ap).ServeHTTP(w, req)
+			res := w.Result()
+			defer res.Body.Close()
+			require.Equal(t, tt.code, res.StatusCode)
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var body statsResponse
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+			assert.Equal(t, "http://localhost:8080/abcABC", body.Alias)
+			assert.Equal(t, 3, body.TotalClicks)
+			assert.Equal(t, 2, body.UniqueVisitors)
+			require.Len(t, body.Daily, 1)
+			assert.Equal(t, 3, body.Daily[0].Clicks)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Package health provides checks of the delete queue and the database schema
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ds"
+)
+
+// PendingMigrations is implemented by the storage migrator
+type PendingMigrations interface {
+	// Pending returns the number of migrations that are not applied
+	Pending(ctx context.Context) (int, error)
+}
+
+// DeleteQueue creates a check that fails when too many delete jobs wait for a worker
+// stats returns the current delete service statistics
+// limit returns the current number of waiting jobs above which the check fails, zero disables the check
+// Returns the check function
+func DeleteQueue(stats func() ds.Stats, limit func() int) CheckFunc {
+	return func(ctx context.Context) error {
+		maxQueued := limit()
+		if queued := stats().Queued; maxQueued > 0 && queued > maxQueued {
+			return fmt.Errorf("%d delete jobs are waiting, limit is %d", queued, maxQueued)
+		}
+		return nil
+	}
+}
+
+// Migrations creates a check that fails while the database schema is behind the application
+// migrator reports pending migrations
+// Returns the check function
+func Migrations(migrator PendingMigrations) CheckFunc {
+	return func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			return fmt.Errorf("%d migrations are not applied", pending)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,136 @@
+// Package health provides readiness checks of the application dependencies
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CheckTimeout is the time a single check may take before it is reported as failed
+const CheckTimeout = 2 * time.Second
+
+// Statuses of checks and of the whole report
+const (
+	// StatusOK means the check passed
+	StatusOK = "ok"
+
+	// StatusFail means the check failed
+	StatusFail = "fail"
+
+	// StatusShuttingDown means the server is draining before shutdown and no checks are run
+	StatusShuttingDown = "shutting_down"
+)
+
+// CheckFunc checks a dependency, it returns an error if the dependency is not usable
+type CheckFunc func(ctx context.Context) error
+
+// check is a registered named check
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// CheckResult is the result of a single check
+type CheckResult struct {
+	// Status is StatusOK or StatusFail
+	Status string `json:"status"`
+
+	// LatencyMS is the time the check took in milliseconds
+	LatencyMS float64 `json:"latency_ms"`
+
+	// Error is the reason of the failure
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the result of all checks
+type Report struct {
+	// Status is StatusOK if all checks passed, StatusFail or StatusShuttingDown otherwise
+	Status string `json:"status"`
+
+	// Checks are the results by check name
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Ready reports whether the application can serve traffic
+// Returns true if all checks passed
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// Checker runs the registered readiness checks
+type Checker struct {
+	mu       sync.RWMutex
+	checks   []check
+	draining atomic.Bool
+}
+
+// New creates a checker without checks
+// Returns a pointer to Checker
+func New() *Checker {
+	return &Checker{}
+}
+
+// Register adds a named check, checks are run concurrently by Check
+// name is the name of the check in the report
+// fn is the check function
+func (c *Checker) Register(name string, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, fn: fn})
+}
+
+// Shutdown marks the application as shutting down, the following reports are not ready
+func (c *Checker) Shutdown() {
+	c.draining.Store(true)
+}
+
+// Check runs all checks, each one with CheckTimeout
+// ctx is the request context
+// Returns the report, checks are not run while shutting down
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.draining.Load() {
+		return Report{Status: StatusShuttingDown}
+	}
+
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = run(ctx, ch.fn)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(checks))}
+	for i, ch := range checks {
+		report.Checks[ch.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// run runs a single check with CheckTimeout
+// Returns the result of the check
+func run(ctx context.Context, fn CheckFunc) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := fn(ctx)
+	result := CheckResult{Status: StatusOK, LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
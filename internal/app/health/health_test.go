@@ -0,0 +1,113 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ds"
+)
+
+// pendingMigrations reports a fixed number of pending migrations
+type pendingMigrations struct {
+	pending int
+	err     error
+}
+
+func (p pendingMigrations) Pending(ctx context.Context) (int, error) {
+	return p.pending, p.err
+}
+
+func TestChecker_Check(t *testing.T) {
+	checker := New()
+	checker.Register("storage", func(ctx context.Context) error { return nil })
+
+	report := checker.Check(context.Background())
+	if !report.Ready() || report.Checks["storage"].Status != StatusOK {
+		t.Errorf("Expected ready report, got %+v", report)
+	}
+
+	checker.Register("broken", func(ctx context.Context) error { return errors.New("connection refused") })
+	report = checker.Check(context.Background())
+	if report.Ready() || report.Status != StatusFail {
+		t.Errorf("Expected failed report, got %+v", report)
+	}
+	if result := report.Checks["broken"]; result.Status != StatusFail || result.Error != "connection refused" {
+		t.Errorf("Expected failed check with error, got %+v", result)
+	}
+	if report.Checks["storage"].Status != StatusOK {
+		t.Errorf("Expected other checks to be reported, got %+v", report.Checks)
+	}
+}
+
+func TestChecker_CheckTimeout(t *testing.T) {
+	checker := New()
+	checker.Register("deadline", func(ctx context.Context) error {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return errors.New("no deadline")
+		}
+		if until := time.Until(deadline); until <= 0 || until > CheckTimeout {
+			return errors.New("unexpected deadline")
+		}
+		return nil
+	})
+
+	if report := checker.Check(context.Background()); !report.Ready() {
+		t.Errorf("Expected check to run with a deadline, got %+v", report)
+	}
+}
+
+func TestChecker_Shutdown(t *testing.T) {
+	checker := New()
+	called := false
+	checker.Register("storage", func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+
+	checker.Shutdown()
+	report := checker.Check(context.Background())
+	if report.Ready() || report.Status != StatusShuttingDown {
+		t.Errorf("Expected shutting down report, got %+v", report)
+	}
+	if called {
+		t.Error("Expected checks to be skipped while shutting down")
+	}
+}
+
+func TestDeleteQueue(t *testing.T) {
+	stats := func() ds.Stats { return ds.Stats{Queued: 5, Retrying: 100} }
+	tests := []struct {
+		name    string
+		limit   int
+		wantErr bool
+	}{
+		{name: "below limit", limit: 10},
+		{name: "at limit", limit: 5},
+		{name: "above limit", limit: 4, wantErr: true},
+		{name: "disabled", limit: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := DeleteQueue(stats, func() int { return tt.limit })
+			if err := check(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("DeleteQueue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	if err := Migrations(pendingMigrations{})(context.Background()); err != nil {
+		t.Errorf("Expected no error without pending migrations, got %v", err)
+	}
+	if err := Migrations(pendingMigrations{pending: 2})(context.Background()); err == nil {
+		t.Error("Expected error with pending migrations")
+	}
+	if err := Migrations(pendingMigrations{err: errors.New("relation does not exist")})(context.Background()); err == nil {
+		t.Error("Expected error when migrations can not be read")
+	}
+}
@@ -0,0 +1,214 @@
+// Package metrics provides Prometheus metrics of the application
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ds"
+)
+
+// namespace is the prefix of all metric names
+const namespace = "shortener"
+
+// unmatchedRoute is the route label of requests that did not match any route
+const unmatchedRoute = "unmatched"
+
+// Redirect results
+const (
+	// RedirectHit is a redirect to the original URL
+	RedirectHit = "hit"
+
+	// RedirectMiss is a request for an unknown alias
+	RedirectMiss = "miss"
+
+	// RedirectGone is a request for a deleted or expired URL
+	RedirectGone = "gone"
+)
+
+// Shorten results
+const (
+	// ShortenCreated is a URL stored under a new alias
+	ShortenCreated = "created"
+
+	// ShortenConflict is a URL the user has already shortened
+	ShortenConflict = "conflict"
+)
+
+// Metrics holds the application metrics and the registry they are exposed from
+// A nil Metrics is valid and records nothing
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	redirects       *prometheus.CounterVec
+	shortened       *prometheus.CounterVec
+	storageDuration *prometheus.HistogramVec
+}
+
+// New creates the application metrics with Go runtime and process metrics
+// Returns a pointer to Metrics
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Number of redirect requests by result: hit, miss or gone.",
+		}, []string{"result"}),
+		shortened: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "shortened_urls_total",
+			Help:      "Number of shortened URLs by result: created or conflict.",
+		}, []string{"result"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Storage operation latency by method.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"method"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.redirects,
+		m.shortened,
+		m.storageDuration,
+	)
+	return m
+}
+
+// Handler returns the handler that exposes the metrics in Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware records the count and latency of requests by route pattern, method and status
+// next is the next handler in the chain
+// Returns http.Handler
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		ww := chiMiddleware.NewWrapResponseWriter(w, req.ProtoMajor)
+		next.ServeHTTP(ww, req)
+
+		// The route pattern is known only after routing, it keeps the label cardinality bounded
+		route := unmatchedRoute
+		if rctx := chi.RouteContext(req.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		labels := prometheus.Labels{"route": route, "method": req.Method, "status": strconv.Itoa(status)}
+		m.requests.With(labels).Inc()
+		m.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Redirect counts a redirect request
+// result is one of Redirect* constants
+func (m *Metrics) Redirect(result string) {
+	if m == nil {
+		return
+	}
+	m.redirects.WithLabelValues(result).Inc()
+}
+
+// Shortened counts shortened URLs
+// result is one of Shorten* constants
+// count is the number of URLs
+func (m *Metrics) Shortened(result string, count int) {
+	if m == nil || count == 0 {
+		return
+	}
+	m.shortened.WithLabelValues(result).Add(float64(count))
+}
+
+// observeStorage records the latency of a storage operation
+// method is the storage method name
+// start is the time the operation started
+func (m *Metrics) observeStorage(method string, start time.Time) {
+	m.storageDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// RegisterDeleteQueue exposes the delete queue depth and job counters
+// stats returns the current delete service statistics, it is called on every scrape
+func (m *Metrics) RegisterDeleteQueue(stats func() ds.Stats) {
+	gauge := func(name, help string, value func(s ds.Stats) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help},
+			func() float64 { return value(stats()) })
+	}
+	counter := func(name, help string, value func(s ds.Stats) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help},
+			func() float64 { return value(stats()) })
+	}
+	m.registry.MustRegister(
+		gauge("delete_queue_jobs", "Number of delete jobs waiting for a worker.",
+			func(s ds.Stats) float64 { return float64(s.Queued) }),
+		gauge("delete_retrying_jobs", "Number of delete jobs waiting for the next attempt.",
+			func(s ds.Stats) float64 { return float64(s.Retrying) }),
+		counter("delete_jobs_processed_total", "Number of completed delete jobs.",
+			func(s ds.Stats) float64 { return float64(s.Processed) }),
+		counter("delete_job_failures_total", "Number of failed delete attempts.",
+			func(s ds.Stats) float64 { return float64(s.Failures) }),
+		counter("delete_dead_letters_total", "Number of delete jobs that ran out of attempts.",
+			func(s ds.Stats) float64 { return float64(s.DeadLetters) }),
+	)
+}
+
+// RegisterPool exposes PostgreSQL connection pool statistics
+// stat returns the current pool statistics, it is called on every scrape
+func (m *Metrics) RegisterPool(stat func() *pgxpool.Stat) {
+	gauge := func(name, help string, value func(s *pgxpool.Stat) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Subsystem: "db_pool", Name: name, Help: help},
+			func() float64 { return value(stat()) })
+	}
+	counter := func(name, help string, value func(s *pgxpool.Stat) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{Namespace: namespace, Subsystem: "db_pool", Name: name, Help: help},
+			func() float64 { return value(stat()) })
+	}
+	m.registry.MustRegister(
+		gauge("acquired_connections", "Number of connections currently in use.",
+			func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) }),
+		gauge("idle_connections", "Number of idle connections.",
+			func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) }),
+		gauge("total_connections", "Number of open and constructing connections.",
+			func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) }),
+		gauge("max_connections", "Maximum size of the pool.",
+			func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) }),
+		counter("acquires_total", "Number of successful connection acquires.",
+			func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) }),
+		counter("empty_acquires_total", "Number of acquires that waited for a connection.",
+			func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) }),
+		counter("canceled_acquires_total", "Number of acquires canceled by the context.",
+			func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) }),
+		counter("acquire_duration_seconds_total", "Total time spent acquiring connections.",
+			func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() }),
+	)
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/services/ds"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+)
+
+// scrape returns the metrics in Prometheus text format
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// assertContains checks that the scraped metrics contain all lines
+func assertContains(t *testing.T, body string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
+
+func TestMetrics_Middleware(t *testing.T) {
+	m := New()
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/{id}", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+	r.Post("/api/shorten", func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	for _, path := range []string{"/abc", "/def"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/shorten", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a/b/c", nil))
+
+	assertContains(t, scrape(t, m),
+		`shortener_http_requests_total{method="GET",route="/{id}",status="307"} 2`,
+		`shortener_http_requests_total{method="POST",route="/api/shorten",status="200"} 1`,
+		`shortener_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`shortener_http_request_duration_seconds_count{method="GET",route="/{id}",status="307"} 2`,
+	)
+}
+
+func TestMetrics_InstrumentStorage(t *testing.T) {
+	m := New()
+	store := m.InstrumentStorage(storage.NewMemoryStorage())
+	ctx := middleware.SetUserID(context.Background(), "user123")
+
+	if _, err := store.AddOrGet(ctx, map[storage.Alias]storage.OriginalURL{"abc": "https://a.com", "def": "https://d.com"}, nil); err != nil {
+		t.Fatalf("Expected no error on AddOrGet, got %v", err)
+	}
+	// The same URL under another alias is a conflict, a taken alias is not counted
+	if _, err := store.AddOrGet(ctx, map[storage.Alias]storage.OriginalURL{"xyz": "https://a.com", "def": "https://other.com"}, nil); err == nil {
+		t.Fatal("Expected conflict on AddOrGet")
+	}
+	if _, err := store.GetURL(ctx, "abc"); err != nil {
+		t.Fatalf("Expected no error on GetURL, got %v", err)
+	}
+
+	assertContains(t, scrape(t, m),
+		`shortener_shortened_urls_total{result="created"} 2`,
+		`shortener_shortened_urls_total{result="conflict"} 1`,
+		`shortener_storage_operation_duration_seconds_count{method="AddOrGet"} 2`,
+		`shortener_storage_operation_duration_seconds_count{method="GetURL"} 1`,
+	)
+}
+
+func TestMetrics_RedirectsAndDeleteQueue(t *testing.T) {
+	m := New()
+	m.Redirect(RedirectHit)
+	m.Redirect(RedirectHit)
+	m.Redirect(RedirectGone)
+	m.RegisterDeleteQueue(func() ds.Stats {
+		return ds.Stats{Queued: 3, Retrying: 1, Processed: 10, DeadLetters: 2}
+	})
+
+	assertContains(t, scrape(t, m),
+		`shortener_redirects_total{result="hit"} 2`,
+		`shortener_redirects_total{result="gone"} 1`,
+		`shortener_delete_queue_jobs 3`,
+		`shortener_delete_retrying_jobs 1`,
+		`shortener_delete_jobs_processed_total 10`,
+		`shortener_delete_dead_letters_total 2`,
+	)
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *Metrics
+	store := storage.NewMemoryStorage()
+	if m.InstrumentStorage(store) != store {
+		t.Error("Expected nil metrics to return the storage as is")
+	}
+	next := http.NotFoundHandler()
+	if m.Middleware(next) == nil {
+		t.Error("Expected nil metrics to return the next handler")
+	}
+	m.Redirect(RedirectMiss)
+	m.Shortened(ShortenCreated, 1)
+}
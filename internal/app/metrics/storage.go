@@ -0,0 +1,200 @@
+// Package metrics provides instrumentation of the data storage
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+)
+
+// instrumentedStorage records the latency of every storage call
+type instrumentedStorage struct {
+	storage.Storage
+	m *Metrics
+}
+
+// InstrumentStorage wraps the storage so that the latency of its operations is recorded by method
+// URLs stored by AddOrGet and AddCustom are also counted as created, and URLs the user already shortened as conflicts
+// store is the data storage
+// Returns the instrumented storage, or store itself if m is nil
+func (m *Metrics) InstrumentStorage(store storage.Storage) storage.Storage {
+	if m == nil {
+		return store
+	}
+	return &instrumentedStorage{Storage: store, m: m}
+}
+
+// Add adds new URLs to the storage
+func (s *instrumentedStorage) Add(ctx context.Context, batch map[storage.Alias]storage.OriginalURL) error {
+	defer s.m.observeStorage("Add", time.Now())
+	return s.Storage.Add(ctx, batch)
+}
+
+// AddOrGet stores new URLs and returns aliases of already stored ones
+func (s *instrumentedStorage) AddOrGet(ctx context.Context, batch map[storage.Alias]storage.OriginalURL, expiresAt *time.Time) (map[storage.OriginalURL]storage.Alias, error) {
+	defer s.m.observeStorage("AddOrGet", time.Now())
+	aliases, err := s.Storage.AddOrGet(ctx, batch, expiresAt)
+	if err != nil && !errors.Is(err, storage.ErrConflict) {
+		return aliases, err
+	}
+
+	// A URL returned with another alias than requested was stored before, a missing one has its alias taken
+	created, conflicts := 0, 0
+	for alias, url := range batch {
+		if stored, ok := aliases[url]; ok && stored == alias {
+			created++
+		} else if ok {
+			conflicts++
+		}
+	}
+	s.m.Shortened(ShortenCreated, created)
+	s.m.Shortened(ShortenConflict, conflicts)
+	return aliases, err
+}
+
+// AddCustom stores URLs under aliases chosen by the user, all or none of them
+func (s *instrumentedStorage) AddCustom(ctx context.Context, urls []storage.CustomURL) (map[storage.OriginalURL]storage.Alias, []storage.Alias, error) {
+	defer s.m.observeStorage("AddCustom", time.Now())
+	existing, taken, err := s.Storage.AddCustom(ctx, urls)
+	switch {
+	case err == nil:
+		s.m.Shortened(ShortenCreated, len(urls))
+	case errors.Is(err, storage.ErrConflict):
+		s.m.Shortened(ShortenConflict, len(existing))
+	}
+	return existing, taken, err
+}
+
+// GetURL retrieves the original URL by alias
+func (s *instrumentedStorage) GetURL(ctx context.Context, alias storage.Alias) (storage.OriginalURL, error) {
+	defer s.m.observeStorage("GetURL", time.Now())
+	return s.Storage.GetURL(ctx, alias)
+}
+
+// GetURLRecord retrieves the stored short URL
+func (s *instrumentedStorage) GetURLRecord(ctx context.Context, alias storage.Alias) (storage.URLRecord, error) {
+	defer s.m.observeStorage("GetURLRecord", time.Now())
+	return s.Storage.GetURLRecord(ctx, alias)
+}
+
+// GetAlias retrieves the alias for a given URL
+func (s *instrumentedStorage) GetAlias(ctx context.Context, url storage.OriginalURL) (storage.Alias, error) {
+	defer s.m.observeStorage("GetAlias", time.Now())
+	return s.Storage.GetAlias(ctx, url)
+}
+
+// GetUserURLs retrieves URLs of a user
+func (s *instrumentedStorage) GetUserURLs(ctx context.Context, userID string) ([]storage.URLRecord, error) {
+	defer s.m.observeStorage("GetUserURLs", time.Now())
+	return s.Storage.GetUserURLs(ctx, userID)
+}
+
+// UpdateUserURL changes a user URL
+func (s *instrumentedStorage) UpdateUserURL(ctx context.Context, userID string, alias storage.Alias, update storage.URLUpdate) (storage.URLRecord, error) {
+	defer s.m.observeStorage("UpdateUserURL", time.Now())
+	return s.Storage.UpdateUserURL(ctx, userID, alias, update)
+}
+
+// GetURLHistory retrieves previous states of a short URL
+func (s *instrumentedStorage) GetURLHistory(ctx context.Context, alias storage.Alias) ([]storage.URLEdit, error) {
+	defer s.m.observeStorage("GetURLHistory", time.Now())
+	return s.Storage.GetURLHistory(ctx, alias)
+}
+
+// DeleteUserURLs marks user URLs as deleted
+func (s *instrumentedStorage) DeleteUserURLs(ctx context.Context, userID string, urls []string) (map[string]string, error) {
+	defer s.m.observeStorage("DeleteUserURLs", time.Now())
+	return s.Storage.DeleteUserURLs(ctx, userID, urls)
+}
+
+// RestoreUserURLs clears the deleted mark of user URLs
+func (s *instrumentedStorage) RestoreUserURLs(ctx context.Context, userID string, aliases []string, deletedAfter time.Time) (map[string]string, error) {
+	defer s.m.observeStorage("RestoreUserURLs", time.Now())
+	return s.Storage.RestoreUserURLs(ctx, userID, aliases, deletedAfter)
+}
+
+// PurgeDeletedURLs permanently removes old deleted URLs
+func (s *instrumentedStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, releaseAliases bool) (int, error) {
+	defer s.m.observeStorage("PurgeDeletedURLs", time.Now())
+	return s.Storage.PurgeDeletedURLs(ctx, deletedBefore, releaseAliases)
+}
+
+// DeleteExpiredURLs marks expired URLs as deleted
+func (s *instrumentedStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (int, error) {
+	defer s.m.observeStorage("DeleteExpiredURLs", time.Now())
+	return s.Storage.DeleteExpiredURLs(ctx, now)
+}
+
+// SaveDeleteJob creates or replaces a delete job
+func (s *instrumentedStorage) SaveDeleteJob(ctx context.Context, job storage.DeleteJob) error {
+	defer s.m.observeStorage("SaveDeleteJob", time.Now())
+	return s.Storage.SaveDeleteJob(ctx, job)
+}
+
+// GetPendingDeleteJobs retrieves delete jobs that are not finished yet
+func (s *instrumentedStorage) GetPendingDeleteJobs(ctx context.Context) ([]storage.DeleteJob, error) {
+	defer s.m.observeStorage("GetPendingDeleteJobs", time.Now())
+	return s.Storage.GetPendingDeleteJobs(ctx)
+}
+
+// GetDeleteJob retrieves a delete job by ID
+func (s *instrumentedStorage) GetDeleteJob(ctx context.Context, id string) (storage.DeleteJob, error) {
+	defer s.m.observeStorage("GetDeleteJob", time.Now())
+	return s.Storage.GetDeleteJob(ctx, id)
+}
+
+// CreateAPIKey stores a new API key
+func (s *instrumentedStorage) CreateAPIKey(ctx context.Context, key storage.APIKey) error {
+	defer s.m.observeStorage("CreateAPIKey", time.Now())
+	return s.Storage.CreateAPIKey(ctx, key)
+}
+
+// GetAPIKeys retrieves API keys of a user
+func (s *instrumentedStorage) GetAPIKeys(ctx context.Context, userID string) ([]storage.APIKey, error) {
+	defer s.m.observeStorage("GetAPIKeys", time.Now())
+	return s.Storage.GetAPIKeys(ctx, userID)
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key
+func (s *instrumentedStorage) GetAPIKeyByHash(ctx context.Context, hash string) (storage.APIKey, error) {
+	defer s.m.observeStorage("GetAPIKeyByHash", time.Now())
+	return s.Storage.GetAPIKeyByHash(ctx, hash)
+}
+
+// RevokeAPIKey marks an API key of a user as revoked
+func (s *instrumentedStorage) RevokeAPIKey(ctx context.Context, userID, id string, revokedAt time.Time) (storage.APIKey, error) {
+	defer s.m.observeStorage("RevokeAPIKey", time.Now())
+	return s.Storage.RevokeAPIKey(ctx, userID, id, revokedAt)
+}
+
+// AddClicks stores redirect events
+func (s *instrumentedStorage) AddClicks(ctx context.Context, clicks []storage.Click) error {
+	defer s.m.observeStorage("AddClicks", time.Now())
+	return s.Storage.AddClicks(ctx, clicks)
+}
+
+// GetClickStats aggregates redirect events of a short URL
+func (s *instrumentedStorage) GetClickStats(ctx context.Context, alias storage.Alias) (storage.ClickStats, error) {
+	defer s.m.observeStorage("GetClickStats", time.Now())
+	return s.Storage.GetClickStats(ctx, alias)
+}
+
+// GetUserByLogin retrieves a user by login
+func (s *instrumentedStorage) GetUserByLogin(ctx context.Context, login string) (*storage.User, error) {
+	defer s.m.observeStorage("GetUserByLogin", time.Now())
+	return s.Storage.GetUserByLogin(ctx, login)
+}
+
+// CreateUser creates a new user
+func (s *instrumentedStorage) CreateUser(ctx context.Context, user *storage.User) error {
+	defer s.m.observeStorage("CreateUser", time.Now())
+	return s.Storage.CreateUser(ctx, user)
+}
+
+// PingStorage checks the storage connection
+func (s *instrumentedStorage) PingStorage(ctx context.Context) error {
+	defer s.m.observeStorage("PingStorage", time.Now())
+	return s.Storage.PingStorage(ctx)
+}
@@ -0,0 +1,170 @@
+// Package middleware provides authorization of requests by API keys and local JWTs
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// APIKeyHeader is the header with an API key, the alternative to the "Authorization: ApiKey <key>" header
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyScheme is the authorization scheme of API keys
+const apiKeyScheme = "ApiKey"
+
+// tokenCookie is the cookie with a JWT, the alternative to the "Authorization: Bearer <token>" header
+const tokenCookie = "Token"
+
+// ErrInvalidAPIKey is the error of an unknown or revoked API key
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// ErrInvalidToken is the error of a JWT with a wrong signature, a wrong algorithm or an expired one
+var ErrInvalidToken = errors.New("invalid token")
+
+// APIKeyAuthenticator resolves API keys to their users
+type APIKeyAuthenticator interface {
+	// Authenticate returns the user and the scopes of a key, ErrInvalidAPIKey if the key is unknown or revoked
+	Authenticate(ctx context.Context, key string) (userID string, scopes []string, err error)
+}
+
+// TokenValidator validates JWTs issued by this service
+type TokenValidator interface {
+	// ValidateToken returns the user of a token, ErrInvalidToken if the token is not valid
+	ValidateToken(token string) (userID string, err error)
+}
+
+// scopesKey is the context key of the scopes of the API key that authorized the request
+type scopesKey struct{}
+
+// Authorization authorizes requests by API key and, without one, by JWT
+// Both ways set the same UserIDKey value, requests authorized by a key also carry its scopes for RequireScope
+// keys resolves API keys, nil accepts JWT only
+// tokens validates JWTs issued by this service, nil validates them via auth-service
+// Returns the middleware
+func Authorization(keys APIKeyAuthenticator, tokens TokenValidator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		withUser := logUserID(next)
+		jwt := JWTMiddleware(next)
+		if tokens != nil {
+			jwt = localJWT(tokens, withUser)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			key, ok := apiKey(req)
+			if !ok || keys == nil {
+				jwt.ServeHTTP(w, req)
+				return
+			}
+
+			userID, scopes, err := keys.Authenticate(req.Context(), key)
+			if errors.Is(err, ErrInvalidAPIKey) {
+				Logger(req.Context()).Debug("Invalid API key")
+				writeError(w, http.StatusUnauthorized, "invalid api key")
+				return
+			}
+			if err != nil {
+				Logger(req.Context()).Error("Can not check API key", zap.Error(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			ctx := context.WithValue(SetUserID(req.Context(), userID), scopesKey{}, scopes)
+			withUser.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// localJWT authorizes requests by JWTs issued by this service
+// tokens validates the tokens
+// next is the next handler
+// Returns the middleware handler
+func localJWT(tokens TokenValidator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, ok := bearerToken(req)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "missing token")
+			return
+		}
+		userID, err := tokens.ValidateToken(token)
+		if err != nil {
+			Logger(req.Context()).Debug("Invalid token", zap.Error(err))
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(SetUserID(req.Context(), userID)))
+	})
+}
+
+// RequireScope provides middleware that allows requests authorized by API keys only if the key has the scope
+// Requests authorized by JWT are allowed all operations
+// scope is the required scope
+// Returns the middleware
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if scopes, ok := req.Context().Value(scopesKey{}).([]string); ok && !slices.Contains(scopes, scope) {
+				writeError(w, http.StatusForbidden, "api key has no "+scope+" scope")
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// DenyAPIKeys rejects requests authorized by API keys, so that a leaked key can not create keys with more scopes
+// next is the next handler
+// Returns the middleware handler
+func DenyAPIKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := req.Context().Value(scopesKey{}).([]string); ok {
+			writeError(w, http.StatusForbidden, "api keys can not be used for this request")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// apiKey returns the API key of a request from the Authorization or X-API-Key header
+// req is the HTTP request
+// Returns the key and whether the request has one
+func apiKey(req *http.Request) (string, bool) {
+	if scheme, key, ok := strings.Cut(req.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, apiKeyScheme) {
+		key = strings.TrimSpace(key)
+		return key, key != ""
+	}
+	key := strings.TrimSpace(req.Header.Get(APIKeyHeader))
+	return key, key != ""
+}
+
+// bearerToken returns the JWT of a request from the Authorization header or the Token cookie
+// req is the HTTP request
+// Returns the token and whether the request has one
+func bearerToken(req *http.Request) (string, bool) {
+	if scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		token = strings.TrimSpace(token)
+		return token, token != ""
+	}
+	if cookie, err := req.Cookie(tokenCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, true
+	}
+	return "", false
+}
+
+// writeError writes a JSON error response in the format of the handlers
+// w is the HTTP response writer
+// code is the HTTP status code
+// message is the error description for the client
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{message}); err != nil {
+		zap.L().Warn("Can not write error response", zap.Error(err))
+	}
+}
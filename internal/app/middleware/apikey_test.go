@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeKeys resolves the key "valid" to user123 with the read scope
+type fakeKeys struct {
+	err error
+}
+
+func (f fakeKeys) Authenticate(ctx context.Context, key string) (string, []string, error) {
+	if f.err != nil {
+		return "", nil, f.err
+	}
+	if key != "valid" {
+		return "", nil, ErrInvalidAPIKey
+	}
+	return "user123", []string{"read"}, nil
+}
+
+// fakeTokens resolves the token "good" to user456
+type fakeTokens struct{}
+
+func (fakeTokens) ValidateToken(token string) (string, error) {
+	if token != "good" {
+		return "", ErrInvalidToken
+	}
+	return "user456", nil
+}
+
+// echoUser writes the authorized user ID
+var echoUser = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	userID, _ := req.Context().Value(UserIDKey).(string)
+	_, _ = w.Write([]byte(userID))
+})
+
+func TestAuthorization(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     APIKeyAuthenticator
+		tokens   TokenValidator
+		header   string
+		value    string
+		wantCode int
+		wantUser string
+	}{
+		{name: "authorization header", keys: fakeKeys{}, header: "Authorization", value: "ApiKey valid", wantCode: http.StatusOK, wantUser: "user123"},
+		{name: "scheme is case-insensitive", keys: fakeKeys{}, header: "Authorization", value: "apikey valid", wantCode: http.StatusOK, wantUser: "user123"},
+		{name: "x-api-key header", keys: fakeKeys{}, header: APIKeyHeader, value: "valid", wantCode: http.StatusOK, wantUser: "user123"},
+		{name: "invalid key", keys: fakeKeys{}, header: APIKeyHeader, value: "revoked", wantCode: http.StatusUnauthorized},
+		{name: "storage failure", keys: fakeKeys{err: errors.New("connection refused")}, header: APIKeyHeader, value: "valid", wantCode: http.StatusInternalServerError},
+		{name: "no key falls back to JWT", keys: fakeKeys{}, wantCode: http.StatusUnauthorized},
+		{name: "keys disabled", header: APIKeyHeader, value: "valid", wantCode: http.StatusUnauthorized},
+		{name: "local token", keys: fakeKeys{}, tokens: fakeTokens{}, header: "Authorization", value: "Bearer good", wantCode: http.StatusOK, wantUser: "user456"},
+		{name: "local token cookie", tokens: fakeTokens{}, header: "Cookie", value: "Token=good", wantCode: http.StatusOK, wantUser: "user456"},
+		{name: "invalid local token", tokens: fakeTokens{}, header: "Authorization", value: "Bearer forged", wantCode: http.StatusUnauthorized},
+		{name: "missing local token", tokens: fakeTokens{}, wantCode: http.StatusUnauthorized},
+		{name: "key with local tokens", keys: fakeKeys{}, tokens: fakeTokens{}, header: APIKeyHeader, value: "valid", wantCode: http.StatusOK, wantUser: "user123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			Authorization(tt.keys, tt.tokens)(echoUser).ServeHTTP(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d", tt.wantCode, w.Code)
+			}
+			if tt.wantUser != "" && w.Body.String() != tt.wantUser {
+				t.Errorf("Expected user %q, got %q", tt.wantUser, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	serve := func(h http.Handler, withKey bool) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/keys", nil)
+		var next http.Handler = h
+		if withKey {
+			req.Header.Set(APIKeyHeader, "valid")
+			next = Authorization(fakeKeys{}, nil)(h)
+		} else {
+			req = req.WithContext(SetUserID(req.Context(), "user123"))
+		}
+		w := httptest.NewRecorder()
+		next.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := serve(RequireScope("read")(echoUser), true); code != http.StatusOK {
+		t.Errorf("Expected key with the scope to pass, got %d", code)
+	}
+	if code := serve(RequireScope("delete")(echoUser), true); code != http.StatusForbidden {
+		t.Errorf("Expected key without the scope to be forbidden, got %d", code)
+	}
+	if code := serve(RequireScope("delete")(echoUser), false); code != http.StatusOK {
+		t.Errorf("Expected JWT requests to have all scopes, got %d", code)
+	}
+	if code := serve(DenyAPIKeys(echoUser), true); code != http.StatusForbidden {
+		t.Errorf("Expected API keys to be denied, got %d", code)
+	}
+	if code := serve(DenyAPIKeys(echoUser), false); code != http.StatusOK {
+		t.Errorf("Expected JWT requests to pass, got %d", code)
+	}
+}
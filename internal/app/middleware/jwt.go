@@ -20,4 +20,5 @@ func SetUserID(ctx context.Context, userID string) context.Context {
 }
 
 // JWTMiddleware delegates JWT validation to the auth-service package middleware.
-func JWTMiddleware(next http.Handler) http.Handler { return auth.JWTMiddleware(next) }
+// The authorized user is also added to the request log entry.
+func JWTMiddleware(next http.Handler) http.Handler { return auth.JWTMiddleware(logUserID(next)) }
@@ -2,12 +2,24 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
 )
 
+// loggerKey is the context key of the request log entry
+type loggerKey struct{}
+
+// logEntry is the request log entry shared by the logging middleware and the handlers it wraps
+type logEntry struct {
+	logger *zap.Logger
+	userID string
+}
+
 // responseData stores response data for logging
 type responseData struct {
 	status int
@@ -34,31 +46,82 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 }
 
 // Logging provides request logging middleware
-func Logging(handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		requestLogger := zap.Must(zap.NewProduction()).Sugar()
-		defer func() {
-			_ = requestLogger.Sync()
-		}()
+// Each request gets a copy of logger with the request ID, which handlers and storage get by Logger
+// The request is logged when it is done, with the route pattern and the user ID if the request was authorized
+// logger is the shared application logger
+// Returns the middleware
+func Logging(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			entry := &logEntry{logger: logger}
+			if id := chiMiddleware.GetReqID(req.Context()); id != "" {
+				entry.logger = logger.With(zap.String("request_id", id))
+			}
 
-		start := time.Now()
+			start := time.Now()
 
-		responseData := &responseData{
-			status: 0,
-			size:   0,
-		}
-		lw := loggingResponseWriter{
-			ResponseWriter: w,
-			responseData:   responseData,
-		}
-		handler.ServeHTTP(&lw, req)
-		requestLogger.Info(
-			zap.String("Method", req.Method),
-			zap.String("URI", req.RequestURI),
-			zap.String("ResponseDuration", time.Since(start).String()),
-			zap.Int("ResponseStatus", responseData.status),
-			zap.Int("ResponseBodySize", responseData.size),
-		)
+			responseData := &responseData{
+				status: 0,
+				size:   0,
+			}
+			lw := loggingResponseWriter{
+				ResponseWriter: w,
+				responseData:   responseData,
+			}
+			handler.ServeHTTP(&lw, req.WithContext(context.WithValue(req.Context(), loggerKey{}, entry)))
+
+			status := responseData.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			entry.with(req.Context()).Info("Request",
+				zap.String("method", req.Method),
+				zap.String("uri", req.RequestURI),
+				zap.Duration("duration", time.Since(start)),
+				zap.Int("status", status),
+				zap.Int("size", responseData.size),
+			)
+		})
+	}
+}
+
+// Logger returns the logger of the request
+// It carries the request ID, the user ID and the route pattern once they are known
+// Outside of requests the global logger is returned
+// ctx is the request context
+// Returns *zap.Logger
+func Logger(ctx context.Context) *zap.Logger {
+	entry, ok := ctx.Value(loggerKey{}).(*logEntry)
+	if !ok {
+		return zap.L()
+	}
+	return entry.with(ctx)
+}
 
+// with returns the entry logger with the user ID and the route pattern known in ctx
+func (e *logEntry) with(ctx context.Context) *zap.Logger {
+	fields := make([]zap.Field, 0, 2)
+	userID := e.userID
+	if id, ok := ctx.Value(UserIDKey).(string); ok {
+		userID = id
+	}
+	if userID != "" {
+		fields = append(fields, zap.String("user_id", userID))
+	}
+	if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+		fields = append(fields, zap.String("route", rctx.RoutePattern()))
+	}
+	return e.logger.With(fields...)
+}
+
+// logUserID remembers the authorized user in the request log entry, so that the request is logged with it
+// next is the handler of the authorized request
+// Returns http.Handler
+func logUserID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if entry, ok := req.Context().Value(loggerKey{}).(*logEntry); ok {
+			entry.userID, _ = req.Context().Value(UserIDKey).(string)
+		}
+		next.ServeHTTP(w, req)
 	})
 }
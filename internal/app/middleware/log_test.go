@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// authorize stands in for the JWT middleware, it authorizes every request as user123
+func authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		logUserID(next).ServeHTTP(w, req.WithContext(SetUserID(req.Context(), "user123")))
+	})
+}
+
+func TestLogging(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+
+	r := chi.NewRouter()
+	r.Use(chiMiddleware.RequestID)
+	r.Use(Logging(zap.New(core)))
+	r.Use(authorize)
+	r.Get("/{id}", func(w http.ResponseWriter, req *http.Request) {
+		Logger(req.Context()).Debug("Handled")
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abc", nil))
+
+	entries := logs.AllUntimed()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 log entries, got %d", len(entries))
+	}
+	handled, request := entries[0].ContextMap(), entries[1].ContextMap()
+	if handled["request_id"] == "" || handled["request_id"] != request["request_id"] {
+		t.Errorf("Expected entries to share the request ID, got %v and %v", handled["request_id"], request["request_id"])
+	}
+	for _, fields := range []map[string]interface{}{handled, request} {
+		if fields["user_id"] != "user123" || fields["route"] != "/{id}" {
+			t.Errorf("Expected user ID and route, got %v", fields)
+		}
+	}
+	if entries[1].Message != "Request" || request["status"] != int64(http.StatusTemporaryRedirect) || request["method"] != http.MethodGet {
+		t.Errorf("Unexpected request entry %s %v", entries[1].Message, request)
+	}
+}
+
+func TestLogging_Unauthorized(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	h := Logging(zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/user/urls", nil))
+
+	entries := logs.AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 log entry, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if _, ok := fields["user_id"]; ok {
+		t.Errorf("Expected no user ID for unauthorized request, got %v", fields)
+	}
+	if fields["status"] != int64(http.StatusUnauthorized) {
+		t.Errorf("Expected status 401, got %v", fields["status"])
+	}
+}
+
+func TestLogger_OutsideRequest(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	Logger(context.Background()).Info("Background")
+
+	if logs.Len() != 1 {
+		t.Errorf("Expected global logger to be used outside of requests, got %d entries", logs.Len())
+	}
+}
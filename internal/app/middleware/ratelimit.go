@@ -0,0 +1,204 @@
+// Package middleware provides rate limiting of requests per user or client IP
+package middleware
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+	"go.uber.org/zap"
+)
+
+// sweepInterval is the interval between removals of idle buckets from memory
+const sweepInterval = time.Minute
+
+// RateLimitResult is the state of a token bucket after a request
+type RateLimitResult struct {
+	// Allowed reports whether a token was taken for the request
+	Allowed bool
+
+	// Tokens is the number of tokens left in the bucket
+	Tokens float64
+}
+
+// RateLimitStore keeps token buckets
+type RateLimitStore interface {
+	// Take refills the bucket of key for the time since the previous request and takes a token if there is one
+	Take(ctx context.Context, key string, limit config.RateLimit) (RateLimitResult, error)
+}
+
+// bucket is a token bucket kept in memory
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// MemoryRateLimitStore keeps token buckets of this instance in memory
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory rate limit store
+// Returns a pointer to MemoryRateLimitStore
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Take refills the bucket of key for the time since the previous request and takes a token if there is one
+// A new bucket is full
+// ctx is the request context
+// key identifies the bucket
+// limit is the limit of the bucket
+// Returns the state of the bucket
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit config.RateLimit) (RateLimitResult, error) {
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests)}
+		s.buckets[key] = b
+	} else {
+		b.tokens = math.Min(float64(limit.Requests), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate())
+	}
+	b.updated = now
+	b.period = limit.Period
+
+	if b.tokens < 1 {
+		return RateLimitResult{Tokens: b.tokens}, nil
+	}
+	b.tokens--
+	return RateLimitResult{Allowed: true, Tokens: b.tokens}, nil
+}
+
+// sweep removes buckets that were refilled completely, they are the same as missing ones
+// now is the current time
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) >= b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// RateLimiter limits requests of route groups per authorized user or, for anonymous requests, per client IP
+type RateLimiter struct {
+	store  RateLimitStore
+	limits func(group string) config.RateLimit
+}
+
+// NewRateLimiter creates a rate limiter
+// store keeps the token buckets
+// limits returns the current limit of a route group, it is called for every request
+// Returns a pointer to RateLimiter
+func NewRateLimiter(store RateLimitStore, limits func(group string) config.RateLimit) *RateLimiter {
+	return &RateLimiter{store: store, limits: limits}
+}
+
+// Limit provides rate limiting middleware for a route group per authorized user or, without one, per client IP
+// Every response of a limited group has RateLimit-* headers, requests over the limit get 429 with Retry-After
+// If the store fails the request is allowed, so that rate limiting never takes the service down
+// group is the route group, see config.RateGroup* constants
+// Returns the middleware, or one that does nothing if l is nil
+func (l *RateLimiter) Limit(group string) func(http.Handler) http.Handler {
+	return l.limit(group, clientKey)
+}
+
+// LimitIP provides rate limiting middleware for a route group per client IP
+// It is used before authorization, so that requests with invalid credentials are limited as well
+// group is the route group, see config.RateGroup* constants
+// Returns the middleware, or one that does nothing if l is nil
+func (l *RateLimiter) LimitIP(group string) func(http.Handler) http.Handler {
+	return l.limit(group, ipKey)
+}
+
+// limit provides rate limiting middleware for a route group
+// group is the route group
+// key returns the bucket key of the client of a request
+// Returns the middleware, or one that does nothing if l is nil
+func (l *RateLimiter) limit(group string, key func(req *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			limit := l.limits(group)
+			if !limit.Enabled() {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			result, err := l.store.Take(req.Context(), group+":"+key(req), limit)
+			if err != nil {
+				Logger(req.Context()).Warn("Can not check rate limit, request is allowed", zap.String("group", group), zap.Error(err))
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			setRateLimitHeaders(w.Header(), limit, result)
+			if !result.Allowed {
+				Logger(req.Context()).Debug("Rate limit exceeded", zap.String("group", group))
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, seconds((1-result.Tokens)/limit.Rate()))))
+				writeError(w, http.StatusTooManyRequests, "too many requests")
+				return
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// clientKey returns the user ID of an authorized request, otherwise the client IP set by RealIP
+// req is the HTTP request
+// Returns the bucket key of the client
+func clientKey(req *http.Request) string {
+	if userID, ok := req.Context().Value(UserIDKey).(string); ok && userID != "" {
+		return "user:" + userID
+	}
+	return ipKey(req)
+}
+
+// ipKey returns the client IP set by RealIP
+// req is the HTTP request
+// Returns the bucket key of the client IP
+func ipKey(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		// RealIP replaces the address with a bare IP taken from proxy headers
+		host = req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// setRateLimitHeaders sets the RateLimit-* headers of the IETF rate limit fields draft
+// header is the response header
+// limit is the limit of the route group
+// result is the state of the bucket after the request
+func setRateLimitHeaders(header http.Header, limit config.RateLimit, result RateLimitResult) {
+	header.Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+	header.Set("RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(result.Tokens)))))
+	header.Set("RateLimit-Reset", strconv.Itoa(seconds((float64(limit.Requests)-result.Tokens)/limit.Rate())))
+	header.Set("RateLimit-Policy", strconv.Itoa(limit.Requests)+";w="+strconv.Itoa(seconds(limit.Period.Seconds())))
+}
+
+// seconds rounds a non-negative number of seconds up to a whole number
+func seconds(s float64) int {
+	return int(math.Ceil(math.Max(0, s)))
+}
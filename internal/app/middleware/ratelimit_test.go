@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+)
+
+// failingStore is a rate limit store that is unavailable
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit config.RateLimit) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("connection refused")
+}
+
+// fixedLimits returns the same limit for every route group
+func fixedLimits(limit config.RateLimit) func(string) config.RateLimit {
+	return func(string) config.RateLimit { return limit }
+}
+
+func TestMemoryRateLimitStore_Take(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	limit := config.RateLimit{Requests: 2, Period: time.Second}
+
+	for i, want := range []bool{true, true, false} {
+		result, err := store.Take(context.Background(), "key", limit)
+		if err != nil {
+			t.Fatalf("Take() error = %v", err)
+		}
+		if result.Allowed != want {
+			t.Errorf("Request %d: expected allowed %v, got %v", i+1, want, result.Allowed)
+		}
+	}
+
+	// Half of the period refills one token
+	now = now.Add(500 * time.Millisecond)
+	if result, _ := store.Take(context.Background(), "key", limit); !result.Allowed || result.Tokens != 0 {
+		t.Errorf("Expected refilled token to be taken, got %+v", result)
+	}
+	if result, _ := store.Take(context.Background(), "other", limit); !result.Allowed || result.Tokens != 1 {
+		t.Errorf("Expected separate bucket for another key, got %+v", result)
+	}
+
+	// Idle full buckets are removed
+	now = now.Add(sweepInterval)
+	_, _ = store.Take(context.Background(), "new", limit)
+	if len(store.buckets) != 1 {
+		t.Errorf("Expected idle buckets to be removed, got %d buckets", len(store.buckets))
+	}
+}
+
+func TestRateLimiter_Limit(t *testing.T) {
+	limiter := NewRateLimiter(NewMemoryRateLimitStore(), fixedLimits(config.RateLimit{Requests: 1, Period: time.Minute}))
+	h := limiter.Limit(config.RateGroupShorten)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", w.Code)
+	}
+	want := map[string]string{"RateLimit-Limit": "1", "RateLimit-Remaining": "0", "RateLimit-Reset": "60", "RateLimit-Policy": "1;w=60"}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("Expected %s %q, got %q", name, value, got)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Errorf("Expected Retry-After 60, got %q", got)
+	}
+	if got := w.Body.String(); got != `{"error":"too many requests"}`+"\n" {
+		t.Errorf("Unexpected body %q", got)
+	}
+}
+
+func TestRateLimiter_ClientKeys(t *testing.T) {
+	limiter := NewRateLimiter(NewMemoryRateLimitStore(), fixedLimits(config.RateLimit{Requests: 1, Period: time.Minute}))
+	h := limiter.Limit(config.RateGroupAPI)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	request := func(remoteAddr, userID string) int {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = remoteAddr
+		if userID != "" {
+			req = req.WithContext(SetUserID(req.Context(), userID))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request("10.0.0.1:1234", ""); code != http.StatusOK {
+		t.Errorf("Expected first anonymous request to pass, got %d", code)
+	}
+	if code := request("10.0.0.1:5678", ""); code != http.StatusTooManyRequests {
+		t.Errorf("Expected anonymous requests to be limited per IP, got %d", code)
+	}
+	if code := request("10.0.0.2", ""); code != http.StatusOK {
+		t.Errorf("Expected another IP to have its own limit, got %d", code)
+	}
+	if code := request("10.0.0.1:1234", "user123"); code != http.StatusOK {
+		t.Errorf("Expected authorized user to have its own limit, got %d", code)
+	}
+	if code := request("10.0.0.3:1234", "user123"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected user to be limited from any IP, got %d", code)
+	}
+}
+
+func TestRateLimiter_LimitIP(t *testing.T) {
+	limiter := NewRateLimiter(NewMemoryRateLimitStore(), fixedLimits(config.RateLimit{Requests: 1, Period: time.Minute}))
+	h := limiter.LimitIP(config.RateGroupClient)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	request := func(remoteAddr, userID string) int {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.RemoteAddr = remoteAddr
+		if userID != "" {
+			req = req.WithContext(SetUserID(req.Context(), userID))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request("10.0.0.1:1234", "user123"); code != http.StatusOK {
+		t.Errorf("Expected first request to pass, got %d", code)
+	}
+	if code := request("10.0.0.1:5678", "other"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected requests to be limited per IP whatever the user, got %d", code)
+	}
+	if code := request("10.0.0.2:1234", "user123"); code != http.StatusOK {
+		t.Errorf("Expected another IP to have its own limit, got %d", code)
+	}
+}
+
+func TestRateLimiter_PassThrough(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter *RateLimiter
+	}{
+		{name: "nil limiter"},
+		{name: "disabled limit", limiter: NewRateLimiter(NewMemoryRateLimitStore(), fixedLimits(config.RateLimit{}))},
+		{name: "store failure", limiter: NewRateLimiter(failingStore{}, fixedLimits(config.RateLimit{Requests: 1, Period: time.Minute}))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.limiter.Limit(config.RateGroupRedirect)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+			for i := 0; i < 3; i++ {
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc", nil))
+				if w.Code != http.StatusOK {
+					t.Fatalf("Expected request %d to pass, got %d", i+1, w.Code)
+				}
+				if w.Header().Get("RateLimit-Limit") != "" {
+					t.Errorf("Expected no rate limit headers, got %v", w.Header())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+// Package alias provides short alias generation strategies
+package alias
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+)
+
+const (
+	// Base62Alphabet is the default alphabet of digits and latin letters
+	Base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	// HumanAlphabet is the alphabet without characters that are easy to confuse, such as 0/O/o and 1/l/I
+	HumanAlphabet = "23456789abcdefghijkmnpqrstuvwxyz"
+
+	// DefaultLength is the default alias length
+	DefaultLength = 8
+
+	// GrowAfter is the number of attempts with taken aliases after which random and hash aliases grow by one character
+	GrowAfter = 3
+)
+
+// seedEpoch is the start of the counter seed, later than the Unix epoch so that the seed fits short aliases
+var seedEpoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Generator generates short aliases for URLs
+type Generator interface {
+	// Generate returns an alias for the URL
+	// attempt is the number of previous attempts whose aliases were already taken
+	Generate(url string, attempt int) (string, error)
+}
+
+// NewGenerator creates the alias generator selected by configuration
+// conf is the application configuration
+// Returns the generator and an error if the settings are invalid
+func NewGenerator(conf *config.Config) (Generator, error) {
+	length := conf.AliasLength
+	if length == 0 {
+		length = DefaultLength
+	}
+
+	alphabet := conf.AliasAlphabet
+	if alphabet == "" {
+		alphabet = Base62Alphabet
+		if conf.AliasStrategy == config.AliasHuman {
+			alphabet = HumanAlphabet
+		}
+	}
+	if err := config.ValidateAliasAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+
+	switch conf.AliasStrategy {
+	case "", config.AliasRandom, config.AliasHuman:
+		return NewRandom(alphabet, length), nil
+	case config.AliasSequential:
+		return NewSequential(alphabet, length, counterSeed(len(alphabet), length, time.Now())), nil
+	case config.AliasHashids:
+		return NewHashids(alphabet, length, conf.AliasSalt, counterSeed(len(alphabet), hashidsDigits(length), time.Now())), nil
+	case config.AliasHash:
+		return NewHash(alphabet, length), nil
+	default:
+		return nil, fmt.Errorf("unknown alias strategy: %q", conf.AliasStrategy)
+	}
+}
+
+// counterSeed returns the initial counter value for counter based strategies
+// Starting from the milliseconds since seedEpoch keeps restarted instances from reusing values
+// as long as fewer than 1000 aliases per second are created on average.
+// The value wraps within the lower half of the counters that fit into the digits,
+// so that aliases have the configured length and the upper half is left for growth
+// base is the alphabet size
+// digits is the number of characters the counter is encoded with
+// now is the current time
+// Returns the initial counter value
+func counterSeed(base, digits int, now time.Time) uint64 {
+	elapsed := uint64(max(now.Sub(seedEpoch).Milliseconds(), 0))
+	half := capacity(base, digits) / 2
+	if half == 0 {
+		return 0
+	}
+	return elapsed % half
+}
+
+// capacity returns the number of counter values that fit into the digits of the base, at most math.MaxUint64
+func capacity(base, digits int) uint64 {
+	result := uint64(1)
+	for range digits {
+		if result > math.MaxUint64/uint64(base) {
+			return math.MaxUint64
+		}
+		result *= uint64(base)
+	}
+	return result
+}
+
+// hashidsDigits returns the number of characters a hashids alias encodes the counter with after the lottery character
+func hashidsDigits(length int) int {
+	return max(length-1, 1)
+}
+
+// grow returns the alias length for the attempt
+func grow(length, attempt int) int {
+	return length + attempt/GrowAfter
+}
+
+// encode writes n in the positional system of the alphabet, left-padded with the zero digit to length
+func encode(n uint64, alphabet string, length int) string {
+	base := uint64(len(alphabet))
+	buf := make([]byte, 0, length)
+	for n > 0 {
+		buf = append(buf, alphabet[n%base])
+		n /= base
+	}
+	for len(buf) < length {
+		buf = append(buf, alphabet[0])
+	}
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return string(buf)
+}
+
+// Random generates uniformly distributed random aliases
+type Random struct {
+	alphabet string
+	length   int
+}
+
+// NewRandom creates a random alias generator
+// alphabet is the set of characters to use
+// length is the initial alias length
+func NewRandom(alphabet string, length int) *Random {
+	return &Random{alphabet: alphabet, length: length}
+}
+
+// Generate returns a random alias, longer after several taken attempts
+func (g *Random) Generate(url string, attempt int) (string, error) {
+	size := grow(g.length, attempt)
+	n := len(g.alphabet)
+	// Bytes above limit are rejected so that every character has the same probability
+	limit := 256 - 256%n
+	result := make([]byte, 0, size)
+	buf := make([]byte, size)
+	for len(result) < size {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("can not read random bytes: %w", err)
+		}
+		for _, b := range buf {
+			if int(b) < limit && len(result) < size {
+				result = append(result, g.alphabet[int(b)%n])
+			}
+		}
+	}
+	return string(result), nil
+}
+
+// Sequential generates aliases from an increasing counter
+type Sequential struct {
+	alphabet string
+	length   int
+	counter  atomic.Uint64
+}
+
+// NewSequential creates a sequential alias generator
+// alphabet is the set of digits to encode the counter with
+// length is the minimum alias length
+// seed is the initial counter value
+func NewSequential(alphabet string, length int, seed uint64) *Sequential {
+	g := &Sequential{alphabet: alphabet, length: length}
+	g.counter.Store(seed)
+	return g
+}
+
+// Generate returns the next counter value encoded in the alphabet
+func (g *Sequential) Generate(url string, attempt int) (string, error) {
+	return encode(g.counter.Add(1), g.alphabet, g.length), nil
+}
+
+// Hashids generates aliases from an increasing counter encoded with a salted alphabet,
+// so that consecutive aliases do not look sequential
+type Hashids struct {
+	alphabet string
+	salt     string
+	length   int
+	counter  atomic.Uint64
+}
+
+// NewHashids creates a hashids-style alias generator
+// alphabet is the set of characters to use
+// length is the minimum alias length
+// salt makes the aliases unique for the installation
+// seed is the initial counter value
+func NewHashids(alphabet string, length int, salt string, seed uint64) *Hashids {
+	g := &Hashids{alphabet: shuffle(alphabet, salt), salt: salt, length: length}
+	g.counter.Store(seed)
+	return g
+}
+
+// Generate returns the next counter value obfuscated with the salted alphabet
+// The first character selects the alphabet permutation of the rest, so the encoding stays reversible
+func (g *Hashids) Generate(url string, attempt int) (string, error) {
+	n := g.counter.Add(1)
+	lottery := g.alphabet[n%uint64(len(g.alphabet))]
+	alphabet := shuffle(g.alphabet, string(lottery)+g.salt+g.alphabet)
+	return string(lottery) + encode(n, alphabet, hashidsDigits(g.length)), nil
+}
+
+// shuffle deterministically permutes the alphabet with the salt like hashids does
+func shuffle(alphabet, salt string) string {
+	result := []byte(alphabet)
+	if salt == "" {
+		return alphabet
+	}
+	for i, v, p := len(result)-1, 0, 0; i > 0; i, v = i-1, v+1 {
+		v %= len(salt)
+		p += int(salt[v])
+		j := (int(salt[v]) + v + p) % i
+		result[i], result[j] = result[j], result[i]
+	}
+	return string(result)
+}
+
+// Hash generates deterministic aliases from the URL content
+type Hash struct {
+	alphabet string
+	length   int
+}
+
+// NewHash creates a content hashing alias generator
+// alphabet is the set of characters to use
+// length is the initial alias length
+func NewHash(alphabet string, length int) *Hash {
+	return &Hash{alphabet: alphabet, length: length}
+}
+
+// Generate returns the encoded SHA-256 of the URL
+// The attempt number is mixed into the hash after collisions, so the same URL of another user gets another alias
+func (g *Hash) Generate(url string, attempt int) (string, error) {
+	data := url
+	if attempt > 0 {
+		data += "#" + strconv.Itoa(attempt)
+	}
+	sum := sha256.Sum256([]byte(data))
+	n := new(big.Int).SetBytes(sum[:])
+	base := big.NewInt(int64(len(g.alphabet)))
+	mod := new(big.Int)
+
+	size := grow(g.length, attempt)
+	result := make([]byte, size)
+	for i := range result {
+		n.DivMod(n, base, mod)
+		result[i] = g.alphabet[mod.Int64()]
+	}
+	return string(result), nil
+}
@@ -0,0 +1,205 @@
+package alias
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+)
+
+func TestNewGenerator(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     string
+	}{
+		{"", "*alias.Random"},
+		{config.AliasRandom, "*alias.Random"},
+		{config.AliasHuman, "*alias.Random"},
+		{config.AliasSequential, "*alias.Sequential"},
+		{config.AliasHashids, "*alias.Hashids"},
+		{config.AliasHash, "*alias.Hash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			conf := config.NewConfig()
+			conf.AliasStrategy = tt.strategy
+			g, err := NewGenerator(conf)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got := fmt.Sprintf("%T", g); got != tt.want {
+				t.Errorf("Expected %s generator, got %s", tt.want, got)
+			}
+		})
+	}
+
+	conf := config.NewConfig()
+	conf.AliasStrategy = "unknown"
+	if _, err := NewGenerator(conf); err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+}
+
+func TestNewGenerator_Length(t *testing.T) {
+	strategies := []string{config.AliasRandom, config.AliasHuman, config.AliasSequential, config.AliasHashids, config.AliasHash}
+	alphabets := []string{"", Base62Alphabet, HumanAlphabet}
+	for _, strategy := range strategies {
+		for _, alphabet := range alphabets {
+			for _, length := range []int{4, DefaultLength, 12} {
+				conf := config.NewConfig()
+				conf.AliasStrategy = strategy
+				conf.AliasAlphabet = alphabet
+				conf.AliasLength = length
+				g, err := NewGenerator(conf)
+				if err != nil {
+					t.Fatalf("Expected no error for %s, got %v", strategy, err)
+				}
+				for i := 0; i < 100; i++ {
+					a, err := g.Generate(fmt.Sprintf("https://example.com/%d", i), 0)
+					if err != nil {
+						t.Fatalf("Expected no error, got %v", err)
+					}
+					if len(a) != length {
+						t.Fatalf("Expected %s alias of %d characters with alphabet %q, got %q", strategy, length, alphabet, a)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCounterSeed(t *testing.T) {
+	now := time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if seed := counterSeed(len(HumanAlphabet), DefaultLength, now); len(encode(seed, HumanAlphabet, DefaultLength)) != DefaultLength {
+		t.Errorf("Expected seed to fit %d characters, got %d", DefaultLength, seed)
+	}
+	if seed := counterSeed(len(Base62Alphabet), 1, now); seed >= 31 {
+		t.Errorf("Expected seed in the lower half of one character, got %d", seed)
+	}
+	if a, b := counterSeed(62, 12, now), counterSeed(62, 12, now.Add(time.Second)); b != a+1000 {
+		t.Errorf("Expected seed to count milliseconds, got %d and %d", a, b)
+	}
+	if seed := counterSeed(62, 12, seedEpoch.Add(-time.Hour)); seed != 0 {
+		t.Errorf("Expected zero seed before the epoch, got %d", seed)
+	}
+}
+
+func TestNewGenerator_HumanAlphabet(t *testing.T) {
+	conf := config.NewConfig()
+	conf.AliasStrategy = config.AliasHuman
+	conf.AliasLength = 64
+	g, err := NewGenerator(conf)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	a, err := g.Generate("https://example.com", 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if strings.ContainsAny(a, "0O1lI") {
+		t.Errorf("Expected alias without ambiguous characters, got %q", a)
+	}
+}
+
+func TestRandom_Generate(t *testing.T) {
+	g := NewRandom("ab", 6)
+	a, err := g.Generate("https://example.com", 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(a) != 6 || strings.Trim(a, "ab") != "" {
+		t.Errorf("Expected 6 characters from alphabet, got %q", a)
+	}
+
+	a, _ = g.Generate("https://example.com", GrowAfter)
+	if len(a) != 7 {
+		t.Errorf("Expected alias to grow after %d attempts, got %q", GrowAfter, a)
+	}
+}
+
+func TestSequential_Generate(t *testing.T) {
+	g := NewSequential(Base62Alphabet, 4, 60)
+	want := []string{"000z", "0010", "0011"}
+	for _, w := range want {
+		a, _ := g.Generate("", 0)
+		if a != w {
+			t.Errorf("Expected %q, got %q", w, a)
+		}
+	}
+}
+
+func TestHashids_Generate(t *testing.T) {
+	g := NewHashids(Base62Alphabet, 6, "salt", 0)
+	seen := make(map[string]struct{})
+	prev := ""
+	for i := 0; i < 1000; i++ {
+		a, _ := g.Generate("", 0)
+		if len(a) < 6 {
+			t.Fatalf("Expected at least 6 characters, got %q", a)
+		}
+		if _, ok := seen[a]; ok {
+			t.Fatalf("Expected unique aliases, got %q twice", a)
+		}
+		seen[a] = struct{}{}
+		if prev != "" && a[1:] == prev[1:] {
+			t.Errorf("Expected consecutive aliases to differ, got %q and %q", prev, a)
+		}
+		prev = a
+	}
+
+	other := NewHashids(Base62Alphabet, 6, "pepper", 0)
+	a, _ := NewHashids(Base62Alphabet, 6, "salt", 0).Generate("", 0)
+	b, _ := other.Generate("", 0)
+	if a == b {
+		t.Error("Expected different salts to produce different aliases")
+	}
+}
+
+func TestHash_Generate(t *testing.T) {
+	g := NewHash(Base62Alphabet, 8)
+	a, _ := g.Generate("https://example.com", 0)
+	b, _ := g.Generate("https://example.com", 0)
+	if a != b || len(a) != 8 {
+		t.Errorf("Expected the same 8 characters alias for the same URL, got %q and %q", a, b)
+	}
+
+	c, _ := g.Generate("https://example.com", 1)
+	if c == a {
+		t.Error("Expected another alias after a collision")
+	}
+	d, _ := g.Generate("https://example.org", 0)
+	if d == a {
+		t.Error("Expected different aliases for different URLs")
+	}
+}
+
+func TestValidateCustom(t *testing.T) {
+	tests := []struct {
+		alias   string
+		wantErr error
+	}{
+		{"spring-sale", nil},
+		{"Sale_2025", nil},
+		{"abc", nil},
+		{"ab", ErrInvalid},
+		{strings.Repeat("a", MaxCustomLength+1), ErrInvalid},
+		{"_sale", ErrInvalid},
+		{"sale/2025", ErrInvalid},
+		{"распродажа", ErrInvalid},
+		{"api", ErrReserved},
+		{"Ping", ErrReserved},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			err := ValidateCustom(tt.alias)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateCustom(%q) error = %v, want %v", tt.alias, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Package alias provides validation of custom (vanity) aliases
+package alias
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MinCustomLength is the minimum length of a custom alias
+	MinCustomLength = 3
+
+	// MaxCustomLength is the maximum length of a custom alias
+	MaxCustomLength = 64
+)
+
+// ErrInvalid is returned for custom aliases with wrong length or characters
+var ErrInvalid = errors.New("invalid alias")
+
+// ErrReserved is returned for custom aliases that clash with service routes
+var ErrReserved = errors.New("alias is reserved")
+
+// reserved contains lower-cased words that are used or may be used by service routes
+var reserved = map[string]struct{}{
+	"api":     {},
+	"ping":    {},
+	"healthz": {},
+	"readyz":  {},
+	"metrics": {},
+	"debug":   {},
+	"admin":   {},
+	"static":  {},
+	"login":   {},
+	"logout":  {},
+}
+
+// IsReserved reports whether the alias clashes with a service route, ignoring case
+func IsReserved(a string) bool {
+	_, ok := reserved[strings.ToLower(a)]
+	return ok
+}
+
+// ValidateCustom checks a user-provided alias
+// It must be MinCustomLength to MaxCustomLength latin letters, digits, '-' or '_',
+// start with a letter or digit and not be a reserved word
+// a is the alias to check
+// Returns ErrInvalid or ErrReserved wrapped with details, nil if the alias is valid
+func ValidateCustom(a string) error {
+	if len(a) < MinCustomLength || len(a) > MaxCustomLength {
+		return fmt.Errorf("%w: length must be between %d and %d", ErrInvalid, MinCustomLength, MaxCustomLength)
+	}
+	for i, r := range a {
+		isDigit := r >= '0' && r <= '9'
+		isLetter := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+		if i == 0 && !isDigit && !isLetter {
+			return fmt.Errorf("%w: must start with a letter or digit", ErrInvalid)
+		}
+		if !isDigit && !isLetter && r != '-' && r != '_' {
+			return fmt.Errorf("%w: character %q is not allowed", ErrInvalid, r)
+		}
+	}
+	if IsReserved(a) {
+		return fmt.Errorf("%w: %s", ErrReserved, a)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Package as provides built-in authentication service functionality
+package as
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// MaxLoginLength is the maximum length of a login, it is the size of the users.login column
+	MaxLoginLength = 255
+
+	// MinPasswordLength is the minimum length of a password
+	MinPasswordLength = 8
+
+	// MaxPasswordLength is the maximum length of a password in bytes, bcrypt ignores longer input
+	MaxPasswordLength = 72
+)
+
+// ErrInvalidLogin is the error of an empty or too long login
+var ErrInvalidLogin = fmt.Errorf("login must be 1 to %d characters long", MaxLoginLength)
+
+// ErrInvalidPassword is the error of a too short or too long password
+var ErrInvalidPassword = fmt.Errorf("password must be %d to %d bytes long", MinPasswordLength, MaxPasswordLength)
+
+// ErrInvalidCredentials is the error of an unknown login or a wrong password, they are not told apart
+var ErrInvalidCredentials = errors.New("invalid login or password")
+
+// AuthServiceInterface defines the interface for built-in authentication service
+type AuthServiceInterface interface {
+	middleware.TokenValidator
+
+	// Register creates a user and returns a token for it, storage.ErrUserExists if the login is taken
+	Register(ctx context.Context, login, password string) (userID, token string, err error)
+
+	// Login checks the password of a user and returns a token for it
+	Login(ctx context.Context, login, password string) (userID, token string, err error)
+}
+
+// claims are the claims of issued tokens, user_id is the claim the auth-service middleware reads
+type claims struct {
+	jwt.RegisteredClaims
+	UserID string `json:"user_id"`
+}
+
+// AuthService registers users with bcrypt password hashes and issues JWTs signed with a local secret
+type AuthService struct {
+	store    storage.Storage
+	secret   []byte
+	lifetime time.Duration
+	now      func() time.Time
+
+	// dummyHash is compared with passwords of unknown logins, so that they take as long as wrong passwords
+	dummyHash []byte
+}
+
+// NewAuthService creates a new authentication service instance
+// store is the storage for users
+// secret is the HMAC secret tokens are signed with
+// lifetime is the lifetime of issued tokens
+// Returns a pointer to AuthService and an error if the password hash could not be prepared
+func NewAuthService(store storage.Storage, secret string, lifetime time.Duration) (*AuthService, error) {
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("can not hash password: %w", err)
+	}
+	return &AuthService{
+		store:     store,
+		secret:    []byte(secret),
+		lifetime:  lifetime,
+		now:       time.Now,
+		dummyHash: dummyHash,
+	}, nil
+}
+
+// Register creates a user with a new user ID
+// ctx is the request context
+// login is the unique login of the user
+// password is the password, only its bcrypt hash is stored
+// Returns the user ID, a token, and ErrInvalidLogin, ErrInvalidPassword, storage.ErrUserExists or a storage error
+func (s *AuthService) Register(ctx context.Context, login, password string) (string, string, error) {
+	login = strings.TrimSpace(login)
+	if login == "" || len([]rune(login)) > MaxLoginLength {
+		return "", "", ErrInvalidLogin
+	}
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return "", "", ErrInvalidPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", fmt.Errorf("can not hash password: %w", err)
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("can not generate user ID: %w", err)
+	}
+	user := &storage.User{Login: login, Password: string(hash), UserID: hex.EncodeToString(b)}
+	if err := s.store.CreateUser(ctx, user); err != nil {
+		return "", "", err
+	}
+
+	token, err := s.issue(user.UserID)
+	if err != nil {
+		return "", "", err
+	}
+	return user.UserID, token, nil
+}
+
+// Login checks the password of a user
+// ctx is the request context
+// login is the login of the user
+// password is the password to check
+// Returns the user ID, a token, and ErrInvalidCredentials if the login is unknown or the password is wrong
+func (s *AuthService) Login(ctx context.Context, login, password string) (string, string, error) {
+	user, err := s.store.GetUserByLogin(ctx, strings.TrimSpace(login))
+	if errors.Is(err, storage.ErrUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return "", "", ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("can not get user: %w", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return "", "", ErrInvalidCredentials
+	}
+
+	token, err := s.issue(user.UserID)
+	if err != nil {
+		return "", "", err
+	}
+	return user.UserID, token, nil
+}
+
+// ValidateToken checks the signature and expiration of a token
+// token is the JWT from the request
+// Returns the user ID and middleware.ErrInvalidToken if the token is not valid
+func (s *AuthService) ValidateToken(token string) (string, error) {
+	var c claims
+	_, err := jwt.ParseWithClaims(token, &c, func(*jwt.Token) (interface{}, error) { return s.secret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(s.now),
+	)
+	if err != nil || c.UserID == "" {
+		return "", middleware.ErrInvalidToken
+	}
+	return c.UserID, nil
+}
+
+// issue creates a token of a user
+// userID is the user identifier
+// Returns the signed token
+func (s *AuthService) issue(userID string) (string, error) {
+	now := s.now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.lifetime)),
+		},
+		UserID: userID,
+	})
+	signed, err := token.SignedString(s.secret)
+	if err != nil {
+		return "", fmt.Errorf("can not sign token: %w", err)
+	}
+	return signed, nil
+}
@@ -0,0 +1,129 @@
+package as
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+)
+
+func TestAuthService_RegisterAndLogin(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	service, err := NewAuthService(store, "supersecretkey", time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error on NewAuthService, got %v", err)
+	}
+	ctx := context.Background()
+
+	userID, token, err := service.Register(ctx, " alice ", "correct horse")
+	if err != nil {
+		t.Fatalf("Expected no error on Register, got %v", err)
+	}
+	if got, err := service.ValidateToken(token); err != nil || got != userID {
+		t.Errorf("Expected token of the new user, got %q, %v", got, err)
+	}
+
+	user, err := store.GetUserByLogin(ctx, "alice")
+	if err != nil {
+		t.Fatalf("Expected user with trimmed login, got %v", err)
+	}
+	if user.UserID != userID || strings.Contains(user.Password, "correct horse") {
+		t.Errorf("Expected only the password hash to be stored, got %+v", user)
+	}
+
+	if _, _, err := service.Register(ctx, "alice", "another password"); !errors.Is(err, storage.ErrUserExists) {
+		t.Errorf("Expected ErrUserExists for a taken login, got %v", err)
+	}
+
+	loggedIn, token, err := service.Login(ctx, "alice", "correct horse")
+	if err != nil || loggedIn != userID {
+		t.Fatalf("Expected login of the user, got %q, %v", loggedIn, err)
+	}
+	if got, err := service.ValidateToken(token); err != nil || got != userID {
+		t.Errorf("Expected token of the user, got %q, %v", got, err)
+	}
+
+	if _, _, err := service.Login(ctx, "alice", "wrong password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials for a wrong password, got %v", err)
+	}
+	if _, _, err := service.Login(ctx, "bob", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials for an unknown login, got %v", err)
+	}
+}
+
+func TestAuthService_RegisterValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		wantErr  error
+	}{
+		{name: "valid", login: "alice", password: "12345678"},
+		{name: "empty login", login: "  ", password: "12345678", wantErr: ErrInvalidLogin},
+		{name: "long login", login: strings.Repeat("a", MaxLoginLength+1), password: "12345678", wantErr: ErrInvalidLogin},
+		{name: "short password", login: "alice", password: "1234567", wantErr: ErrInvalidPassword},
+		{name: "long password", login: "alice", password: strings.Repeat("a", MaxPasswordLength+1), wantErr: ErrInvalidPassword},
+	}
+
+	service, err := NewAuthService(storage.NewMemoryStorage(), "supersecretkey", time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error on NewAuthService, got %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := service.Register(context.Background(), tt.login, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Register() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthService_ValidateToken(t *testing.T) {
+	service, err := NewAuthService(storage.NewMemoryStorage(), "supersecretkey", time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error on NewAuthService, got %v", err)
+	}
+	sign := func(method jwt.SigningMethod, key interface{}, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("Can not sign token: %v", err)
+		}
+		return token
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	valid := sign(jwt.SigningMethodHS256, []byte("supersecretkey"), jwt.MapClaims{"user_id": "user123", "exp": exp})
+	if userID, err := service.ValidateToken(valid); err != nil || userID != "user123" {
+		t.Errorf("Expected valid token to resolve to its user, got %q, %v", userID, err)
+	}
+
+	invalid := map[string]string{
+		"other secret": sign(jwt.SigningMethodHS256, []byte("other"), jwt.MapClaims{"user_id": "user123", "exp": exp}),
+		"other method": sign(jwt.SigningMethodHS512, []byte("supersecretkey"), jwt.MapClaims{"user_id": "user123", "exp": exp}),
+		"expired":      sign(jwt.SigningMethodHS256, []byte("supersecretkey"), jwt.MapClaims{"user_id": "user123", "exp": time.Now().Add(-time.Minute).Unix()}),
+		"no expiry":    sign(jwt.SigningMethodHS256, []byte("supersecretkey"), jwt.MapClaims{"user_id": "user123"}),
+		"no user":      sign(jwt.SigningMethodHS256, []byte("supersecretkey"), jwt.MapClaims{"exp": exp}),
+		"malformed":    "invalid.token.here",
+	}
+	for name, token := range invalid {
+		if _, err := service.ValidateToken(token); !errors.Is(err, middleware.ErrInvalidToken) {
+			t.Errorf("Expected ErrInvalidToken for %s token, got %v", name, err)
+		}
+	}
+
+	// Tokens expire after the configured lifetime
+	_, token, err := service.Register(context.Background(), "alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Expected no error on Register, got %v", err)
+	}
+	service.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := service.ValidateToken(token); !errors.Is(err, middleware.ErrInvalidToken) {
+		t.Errorf("Expected token to expire after its lifetime, got %v", err)
+	}
+}
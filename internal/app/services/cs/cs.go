@@ -0,0 +1,119 @@
+// Package cs provides click service functionality
+package cs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// BufferSize is the number of clicks that can wait for writing before new ones are dropped
+	BufferSize = 10000
+
+	// BatchSize is the maximum number of clicks written at once
+	BatchSize = 500
+
+	// FlushInterval is the maximum time a click waits in a batch before it is written
+	FlushInterval = time.Second
+
+	// writeTimeout is the timeout of a single batch write
+	writeTimeout = 10 * time.Second
+)
+
+// ClickServiceInterface defines the interface for click service
+type ClickServiceInterface interface {
+	// Add queues a click for writing without blocking the caller
+	Add(click storage.Click)
+
+	// Start starts the click service
+	Start()
+
+	// Stop stops the click service and writes queued clicks
+	Stop()
+}
+
+// ClickService writes redirect events to storage in batches off the request path
+type ClickService struct {
+	store         storage.Storage
+	logger        *zap.Logger
+	input         chan storage.Click
+	batchSize     int
+	flushInterval time.Duration
+	wg            sync.WaitGroup
+}
+
+// NewClickService creates a new click service instance
+// store is the storage for clicks
+// logger is the logger for dropped clicks and write failures
+// Returns a pointer to ClickService
+func NewClickService(store storage.Storage, logger *zap.Logger) *ClickService {
+	return &ClickService{
+		store:         store,
+		logger:        logger,
+		input:         make(chan storage.Click, BufferSize),
+		batchSize:     BatchSize,
+		flushInterval: FlushInterval,
+	}
+}
+
+// Start starts the worker that writes clicks when a batch is full or the flush interval passes
+func (cs *ClickService) Start() {
+	cs.wg.Add(1)
+	go func() {
+		defer cs.wg.Done()
+		ticker := time.NewTicker(cs.flushInterval)
+		defer ticker.Stop()
+
+		batch := make([]storage.Click, 0, cs.batchSize)
+		for {
+			select {
+			case click, ok := <-cs.input:
+				if !ok {
+					cs.write(batch)
+					return
+				}
+				batch = append(batch, click)
+				if len(batch) >= cs.batchSize {
+					cs.write(batch)
+					batch = batch[:0]
+				}
+			case <-ticker.C:
+				cs.write(batch)
+				batch = batch[:0]
+			}
+		}
+	}()
+}
+
+// Stop stops the click service and waits until queued clicks are written
+// Add must not be called after Stop
+func (cs *ClickService) Stop() {
+	close(cs.input)
+	cs.wg.Wait()
+}
+
+// Add queues a click for writing
+// The click is dropped if the queue is full so that redirects never wait for storage
+func (cs *ClickService) Add(click storage.Click) {
+	select {
+	case cs.input <- click:
+	default:
+		cs.logger.Warn("Click queue is full, dropping click", zap.String("alias", string(click.Alias)))
+	}
+}
+
+// write stores a batch of clicks
+func (cs *ClickService) write(batch []storage.Click) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	if err := cs.store.AddClicks(ctx, batch); err != nil {
+		cs.logger.Error("Failed to store clicks", zap.Int("clicks", len(batch)), zap.Error(err))
+	}
+}
@@ -0,0 +1,68 @@
+package cs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+func TestClickService_FlushOnStop(t *testing.T) {
+	mem := storage.NewMemoryStorage()
+	service := NewClickService(mem, zap.NewNop())
+	service.Start()
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		service.Add(storage.Click{Alias: "abc", Time: now, IP: "10.0.0.1", UserAgent: "curl"})
+	}
+	service.Stop()
+
+	stats, err := mem.GetClickStats(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("Expected no error on GetClickStats, got %v", err)
+	}
+	if stats.Total != 3 {
+		t.Errorf("Expected 3 clicks to be written on Stop, got %d", stats.Total)
+	}
+}
+
+func TestClickService_FlushOnInterval(t *testing.T) {
+	mem := storage.NewMemoryStorage()
+	service := NewClickService(mem, zap.NewNop())
+	service.flushInterval = 10 * time.Millisecond
+	service.Start()
+	defer service.Stop()
+
+	service.Add(storage.Click{Alias: "abc", Time: time.Now()})
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		stats, _ := mem.GetClickStats(context.Background(), "abc")
+		if stats.Total == 1 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("Expected click to be written after the flush interval")
+}
+
+func TestClickService_DropsWhenFull(t *testing.T) {
+	mem := storage.NewMemoryStorage()
+	service := NewClickService(mem, zap.NewNop())
+	service.input = make(chan storage.Click, 1)
+
+	// The worker is not started, so the second click does not fit into the queue
+	service.Add(storage.Click{Alias: "abc", Time: time.Now()})
+	service.Add(storage.Click{Alias: "abc", Time: time.Now()})
+
+	service.Start()
+	service.Stop()
+
+	stats, _ := mem.GetClickStats(context.Background(), "abc")
+	if stats.Total != 1 {
+		t.Errorf("Expected the overflowing click to be dropped, got %d clicks", stats.Total)
+	}
+}
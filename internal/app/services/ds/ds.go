@@ -3,67 +3,537 @@ package ds
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"github.com/vitalykrupin/url-shortener/internal/app/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
-// payload represents the data structure for delete operations
-type payload struct {
-	userID string
-	urls   []string
+const (
+	// MaxAttempts is the number of attempts after which a job is kept as a dead-letter record
+	MaxAttempts = 5
+
+	// RetryDelay is the delay before the first retry, it doubles after every failed attempt
+	RetryDelay = time.Second
+
+	// MaxRetryDelay limits the delay between retries
+	MaxRetryDelay = time.Minute
+
+	// BatchSize is the maximum number of aliases a worker merges into one delete
+	BatchSize = 1000
+
+	// FlushInterval is the time a worker accumulates queued jobs before merging them
+	FlushInterval = 20 * time.Millisecond
+
+	// DrainTimeout is the time Stop waits for queued jobs before leaving them for the next start
+	DrainTimeout = 10 * time.Second
+
+	// storeTimeout is the timeout of a single storage call
+	storeTimeout = 10 * time.Second
+)
+
+// ErrStopped is returned by Add after the service is stopped
+var ErrStopped = errors.New("delete service is stopped")
+
+// Stats contains delete queue counters
+type Stats struct {
+	// Queued is the number of jobs waiting for a worker
+	Queued int
+
+	// Retrying is the number of jobs waiting for the next attempt after a failure
+	Retrying int
+
+	// Processed is the number of completed jobs
+	Processed int64
+
+	// Failures is the number of failed attempts
+	Failures int64
+
+	// DeadLetters is the number of jobs that ran out of attempts
+	DeadLetters int64
 }
 
 // DeleteServiceInterface defines the interface for delete service
 type DeleteServiceInterface interface {
-	// Add adds URLs to the delete queue
-	Add(userID string, urls []string)
-	
+	// Add persists a delete job and queues it, the job is not lost if the process stops before it is done
+	// The trace of ctx is continued by the worker that processes the job
+	// Returns the job ID that can be used to check the job status
+	Add(ctx context.Context, userID string, urls []string) (jobID string, err error)
+
 	// Start starts the delete service with specified number of workers
 	Start(workers int)
-	
+
 	// Stop stops the delete service
 	Stop()
+
+	// Stats returns delete queue counters
+	Stats() Stats
 }
 
-// DeleteService implements the delete service functionality
+// DeleteService deletes user URLs in background workers
+// Workers merge queued jobs of the same user into one storage call, jobs are persisted in storage before they are queued, failed jobs are retried with exponential backoff
+// and unfinished jobs are picked up again on the next start
 type DeleteService struct {
-	store storage.Storage
-	input chan payload
-	wg    sync.WaitGroup
+	store  storage.Storage
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []storage.DeleteJob
+	aliases  int                          // number of aliases in the queue
+	timers   map[string]*time.Timer       // job ID -> pending retry
+	traces   map[string]trace.SpanContext // job ID -> span of the request that added the job
+	stopped  bool
+	draining bool
+
+	// ctx is cancelled when Stop gives up draining
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	processed   atomic.Int64
+	failures    atomic.Int64
+	deadLetters atomic.Int64
+
+	batchSize     int
+	flushInterval time.Duration
+	maxAttempts   int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+	drainTimeout  time.Duration
 }
 
 // NewDeleteService creates a new delete service instance
-func NewDeleteService(store storage.Storage) *DeleteService {
-	return &DeleteService{
-		store: store,
-		input: make(chan payload),
+// store is the storage for URLs and delete jobs
+// logger is the logger for job failures
+// Returns a pointer to DeleteService
+func NewDeleteService(store storage.Storage, logger *zap.Logger) *DeleteService {
+	ctx, cancel := context.WithCancel(context.Background())
+	ds := &DeleteService{
+		store:         store,
+		logger:        logger,
+		timers:        make(map[string]*time.Timer),
+		traces:        make(map[string]trace.SpanContext),
+		ctx:           ctx,
+		cancel:        cancel,
+		batchSize:     BatchSize,
+		flushInterval: FlushInterval,
+		maxAttempts:   MaxAttempts,
+		retryDelay:    RetryDelay,
+		maxRetryDelay: MaxRetryDelay,
+		drainTimeout:  DrainTimeout,
 	}
+	ds.cond = sync.NewCond(&ds.mu)
+	return ds
+}
+
+// SetBatching overrides how workers merge jobs, it can also be called while workers run
+// batchSize is the maximum number of aliases merged into one delete
+// flushInterval is the time a worker waits for more jobs before merging, zero merges only already queued jobs
+func (ds *DeleteService) SetBatching(batchSize int, flushInterval time.Duration) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	ds.batchSize = max(batchSize, 1)
+	ds.flushInterval = max(flushInterval, 0)
+	ds.cond.Broadcast()
 }
 
-// Start starts the delete service with specified number of workers
+// Start queues jobs left unfinished by the previous run and starts the specified number of workers
 func (ds *DeleteService) Start(workers int) {
+	ctx, cancel := context.WithTimeout(ds.ctx, storeTimeout)
+	pending, err := ds.store.GetPendingDeleteJobs(ctx)
+	cancel()
+	if err != nil {
+		ds.logger.Error("Failed to load pending delete jobs", zap.Error(err))
+	}
+	ds.resume(pending)
+
 	for w := 1; w <= workers; w++ {
 		ds.wg.Add(1)
 		go func() {
 			defer ds.wg.Done()
-			for p := range ds.input {
-				_ = ds.store.DeleteUserURLs(context.Background(), p.userID, p.urls)
+			for {
+				jobs, ok := ds.nextBatch()
+				if !ok {
+					return
+				}
+				ds.process(jobs)
 			}
 		}()
 	}
 }
 
-// Stop stops the delete service
+// Stop stops accepting jobs and waits up to the drain timeout for queued jobs
+// Jobs waiting for a retry or left in the queue stay pending in storage and are resumed on the next start
 func (ds *DeleteService) Stop() {
-	close(ds.input)
-	ds.wg.Wait()
+	ds.mu.Lock()
+	if ds.stopped {
+		ds.mu.Unlock()
+		return
+	}
+	ds.stopped = true
+	for id, timer := range ds.timers {
+		timer.Stop()
+		delete(ds.timers, id)
+	}
+	ds.cond.Broadcast()
+	ds.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ds.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(ds.drainTimeout):
+		ds.mu.Lock()
+		left := len(ds.queue)
+		ds.queue = nil
+		ds.aliases = 0
+		ds.draining = true
+		ds.mu.Unlock()
+		ds.cancel()
+		ds.logger.Warn("Delete queue was not drained, jobs are left for the next start",
+			zap.Duration("timeout", ds.drainTimeout), zap.Int("jobs", left))
+		<-done
+	}
+	ds.cancel()
+}
+
+// Add persists a delete job and queues it
+// ctx is the request context, its trace is continued by the worker that processes the job
+// Returns the job ID, ErrStopped after Stop and an error if the job could not be persisted
+func (ds *DeleteService) Add(ctx context.Context, userID string, urls []string) (string, error) {
+	ds.mu.Lock()
+	stopped := ds.stopped
+	ds.mu.Unlock()
+	if stopped {
+		return "", ErrStopped
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	job := storage.DeleteJob{
+		ID:        id,
+		UserID:    userID,
+		Aliases:   urls,
+		Status:    storage.DeleteJobPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := ds.save(ctx, job); err != nil {
+		return "", fmt.Errorf("can not persist delete job: %w", err)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		ds.mu.Lock()
+		ds.traces[id] = sc
+		ds.mu.Unlock()
+	}
+	ds.push(job)
+	return id, nil
+}
+
+// Stats returns delete queue counters
+func (ds *DeleteService) Stats() Stats {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return Stats{
+		Queued:      len(ds.queue),
+		Retrying:    len(ds.timers),
+		Processed:   ds.processed.Load(),
+		Failures:    ds.failures.Load(),
+		DeadLetters: ds.deadLetters.Load(),
+	}
+}
+
+// resume queues pending jobs loaded from storage, skipping jobs added before Start that are already queued
+func (ds *DeleteService) resume(pending []storage.DeleteJob) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	queued := make(map[string]struct{}, len(ds.queue))
+	for _, job := range ds.queue {
+		queued[job.ID] = struct{}{}
+	}
+	resumed := 0
+	for _, job := range pending {
+		if _, ok := queued[job.ID]; ok {
+			continue
+		}
+		ds.enqueue(job)
+		resumed++
+	}
+	if resumed > 0 {
+		ds.logger.Info("Resuming pending delete jobs", zap.Int("jobs", resumed))
+		ds.cond.Broadcast()
+	}
+}
+
+// push appends a job to the queue and wakes up a worker
+func (ds *DeleteService) push(job storage.DeleteJob) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.draining {
+		return
+	}
+	ds.enqueue(job)
+	ds.cond.Signal()
+}
+
+// enqueue appends a job to the queue, the caller must hold the lock
+func (ds *DeleteService) enqueue(job storage.DeleteJob) {
+	ds.queue = append(ds.queue, job)
+	ds.aliases += len(job.Aliases)
+}
+
+// nextBatch waits for queued jobs and takes them once the batch size is reached,
+// the flush interval passes or the service is stopped
+// Returns false when the service is stopped and the queue is empty
+func (ds *DeleteService) nextBatch() ([]storage.DeleteJob, bool) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for {
+		for len(ds.queue) == 0 && !ds.stopped {
+			ds.cond.Wait()
+		}
+		if len(ds.queue) == 0 {
+			return nil, false
+		}
+		ds.waitFlush()
+		// Another worker may have taken the jobs while this one was waiting
+		if len(ds.queue) > 0 {
+			break
+		}
+	}
+
+	n, size := 0, 0
+	for n < len(ds.queue) && (n == 0 || size+len(ds.queue[n].Aliases) <= ds.batchSize) {
+		size += len(ds.queue[n].Aliases)
+		n++
+	}
+	jobs := make([]storage.DeleteJob, n)
+	copy(jobs, ds.queue)
+	ds.queue = ds.queue[n:]
+	ds.aliases -= size
+	return jobs, true
+}
+
+// waitFlush waits until the queue holds a full batch, the flush interval passes or the service is stopped,
+// the caller must hold the lock
+func (ds *DeleteService) waitFlush() {
+	if ds.flushInterval <= 0 {
+		return
+	}
+	flushed := false
+	timer := time.AfterFunc(ds.flushInterval, func() {
+		ds.mu.Lock()
+		defer ds.mu.Unlock()
+		flushed = true
+		ds.cond.Broadcast()
+	})
+	defer timer.Stop()
+	for !flushed && !ds.stopped && len(ds.queue) > 0 && ds.aliases < ds.batchSize {
+		ds.cond.Wait()
+	}
+}
+
+// process deletes the aliases of a batch with one storage call per user and records the result of every job
+func (ds *DeleteService) process(jobs []storage.DeleteJob) {
+	var users []string
+	byUser := make(map[string][]storage.DeleteJob)
+	for _, job := range jobs {
+		if _, ok := byUser[job.UserID]; !ok {
+			users = append(users, job.UserID)
+		}
+		byUser[job.UserID] = append(byUser[job.UserID], job)
+	}
+
+	for _, userID := range users {
+		if !ds.processUser(userID, byUser[userID]) {
+			return
+		}
+	}
+}
+
+// processUser deletes the merged aliases of the user jobs and records the result of every job
+// Returns false if the delete was interrupted by Stop, the jobs then stay pending for the next start
+func (ds *DeleteService) processUser(userID string, jobs []storage.DeleteJob) bool {
+	ctx, span := ds.startSpan(jobs)
+	defer span.End()
+
+	storeCtx, cancel := context.WithTimeout(ctx, storeTimeout)
+	results, err := ds.store.DeleteUserURLs(storeCtx, userID, mergeAliases(jobs))
+	cancel()
+	// A delete interrupted by Stop is not a failed attempt, the jobs are retried after the next start
+	if err != nil && ds.ctx.Err() != nil {
+		return false
+	}
+	for _, job := range jobs {
+		ds.finish(ctx, job, jobResults(job, results), err)
+	}
+	return true
+}
+
+// startSpan starts the span of a merged delete
+// The span continues the trace of the first job added by a traced request and links the traces of all jobs
+// Returns the context with the span and the span
+func (ds *DeleteService) startSpan(jobs []storage.DeleteJob) (context.Context, trace.Span) {
+	var parent trace.SpanContext
+	links := make([]trace.Link, 0, len(jobs))
+	ds.mu.Lock()
+	for _, job := range jobs {
+		sc, ok := ds.traces[job.ID]
+		if !ok {
+			continue
+		}
+		if !parent.IsValid() {
+			parent = sc
+		}
+		links = append(links, trace.Link{SpanContext: sc, Attributes: []attribute.KeyValue{attribute.String("delete.job_id", job.ID)}})
+	}
+	ds.mu.Unlock()
+
+	ctx := ds.ctx
+	if parent.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, parent)
+	}
+	return tracing.Tracer().Start(ctx, "ds.DeleteUserURLs",
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("delete.jobs", len(jobs))),
+	)
+}
+
+// finish records the result of a job attempt and schedules a retry if the attempt failed with a transient error
+// ctx is the context of the attempt
+// results are the per-alias results of the job, err is the error of the attempt
+func (ds *DeleteService) finish(ctx context.Context, job storage.DeleteJob, results map[string]string, err error) {
+	job.Attempts++
+	job.UpdatedAt = time.Now()
+	if err == nil {
+		job.Status = storage.DeleteJobDone
+		job.LastError = ""
+		job.Results = results
+		ds.processed.Add(1)
+	} else {
+		ds.failures.Add(1)
+		job.LastError = err.Error()
+		if job.Attempts >= ds.maxAttempts || permanent(err) {
+			job.Status = storage.DeleteJobFailed
+			ds.deadLetters.Add(1)
+			ds.logger.Error("Delete job failed", zap.String("job_id", job.ID), zap.Int("attempts", job.Attempts), zap.Error(err))
+		} else {
+			ds.logger.Warn("Delete job attempt failed", zap.String("job_id", job.ID), zap.Int("attempt", job.Attempts), zap.Error(err))
+		}
+	}
+
+	if err := ds.save(ctx, job); err != nil {
+		ds.logger.Error("Failed to save delete job", zap.String("job_id", job.ID), zap.Error(err))
+	}
+	if job.Status == storage.DeleteJobPending {
+		ds.retryLater(job)
+		return
+	}
+	ds.mu.Lock()
+	delete(ds.traces, job.ID)
+	ds.mu.Unlock()
+}
+
+// permanent reports whether the error of an attempt can not be fixed by retrying,
+// such jobs become dead letters at once instead of using up their attempts
+func permanent(err error) bool {
+	return errors.Is(err, storage.ErrUserIDRequired)
+}
+
+// mergeAliases returns the aliases of all jobs without duplicates, in the order they were requested
+func mergeAliases(jobs []storage.DeleteJob) []string {
+	if len(jobs) == 1 {
+		return jobs[0].Aliases
+	}
+	seen := make(map[string]struct{})
+	merged := make([]string, 0)
+	for _, job := range jobs {
+		for _, alias := range job.Aliases {
+			if _, ok := seen[alias]; ok {
+				continue
+			}
+			seen[alias] = struct{}{}
+			merged = append(merged, alias)
+		}
+	}
+	return merged
+}
+
+// jobResults picks the results of the job aliases from the results of a merged delete
+// Returns nil if the storage returned no results
+func jobResults(job storage.DeleteJob, results map[string]string) map[string]string {
+	if results == nil {
+		return nil
+	}
+	picked := make(map[string]string, len(job.Aliases))
+	for _, alias := range job.Aliases {
+		if result, ok := results[alias]; ok {
+			picked[alias] = result
+		}
+	}
+	return picked
+}
+
+// retryLater queues the job again after the backoff delay
+func (ds *DeleteService) retryLater(job storage.DeleteJob) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.stopped {
+		return
+	}
+	ds.timers[job.ID] = time.AfterFunc(ds.backoff(job.Attempts), func() {
+		ds.mu.Lock()
+		defer ds.mu.Unlock()
+		if _, ok := ds.timers[job.ID]; !ok {
+			// Cancelled by Stop
+			return
+		}
+		delete(ds.timers, job.ID)
+		ds.enqueue(job)
+		ds.cond.Signal()
+	})
+}
+
+// backoff returns the delay before the next attempt
+// attempts is the number of finished attempts
+func (ds *DeleteService) backoff(attempts int) time.Duration {
+	delay := ds.retryDelay
+	for i := 1; i < attempts && delay < ds.maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, ds.maxRetryDelay)
+}
+
+// save persists the job state
+// ctx carries the trace only, cancellation is ignored so that results are saved while stopping
+func (ds *DeleteService) save(ctx context.Context, job storage.DeleteJob) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+	return ds.store.SaveDeleteJob(ctx, job)
 }
 
-// Add adds URLs to the delete queue
-func (ds *DeleteService) Add(userID string, urls []string) {
-	ds.input <- payload{
-		userID: userID,
-		urls:   urls,
+// newJobID generates a random job identifier
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("can not generate job ID: %w", err)
 	}
+	return hex.EncodeToString(b), nil
 }
@@ -2,12 +2,20 @@ package ds
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
 	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"github.com/vitalykrupin/url-shortener/internal/app/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
 )
 
 // mockStorage for testing
@@ -23,28 +31,96 @@ func (m *mockStorage) Add(ctx context.Context, batch map[storage.Alias]storage.O
 	return nil
 }
 
+func (m *mockStorage) AddOrGet(ctx context.Context, batch map[storage.Alias]storage.OriginalURL, expiresAt *time.Time) (map[storage.OriginalURL]storage.Alias, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) AddCustom(ctx context.Context, urls []storage.CustomURL) (map[storage.OriginalURL]storage.Alias, []storage.Alias, error) {
+	return nil, nil, nil
+}
+
 func (m *mockStorage) GetURL(ctx context.Context, alias storage.Alias) (storage.OriginalURL, error) {
 	return "", nil
 }
 
+func (m *mockStorage) GetURLRecord(ctx context.Context, alias storage.Alias) (storage.URLRecord, error) {
+	return storage.URLRecord{}, nil
+}
+
 func (m *mockStorage) GetAlias(ctx context.Context, url storage.OriginalURL) (storage.Alias, error) {
 	return "", nil
 }
 
-func (m *mockStorage) GetUserURLs(ctx context.Context, userID string) (storage.AliasKeysMap, error) {
+func (m *mockStorage) GetUserURLs(ctx context.Context, userID string) ([]storage.URLRecord, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) UpdateUserURL(ctx context.Context, userID string, alias storage.Alias, update storage.URLUpdate) (storage.URLRecord, error) {
+	return storage.URLRecord{}, nil
+}
+
+func (m *mockStorage) GetURLHistory(ctx context.Context, alias storage.Alias) ([]storage.URLEdit, error) {
 	return nil, nil
 }
 
-func (m *mockStorage) DeleteUserURLs(ctx context.Context, userID string, urls []string) error {
+func (m *mockStorage) DeleteUserURLs(ctx context.Context, userID string, urls []string) (map[string]string, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.deleteCalls = append(m.deleteCalls, struct {
 		userID string
 		urls   []string
 	}{userID, urls})
+	return nil, nil
+}
+
+func (m *mockStorage) RestoreUserURLs(ctx context.Context, userID string, aliases []string, deletedAfter time.Time) (map[string]string, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, releaseAliases bool) (int, error) {
+	return 0, nil
+}
+
+func (m *mockStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (int, error) {
+	return 0, nil
+}
+
+func (m *mockStorage) SaveDeleteJob(ctx context.Context, job storage.DeleteJob) error {
 	return nil
 }
 
+func (m *mockStorage) GetPendingDeleteJobs(ctx context.Context) ([]storage.DeleteJob, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) GetDeleteJob(ctx context.Context, id string) (storage.DeleteJob, error) {
+	return storage.DeleteJob{}, storage.ErrJobNotFound
+}
+
+func (m *mockStorage) CreateAPIKey(ctx context.Context, key storage.APIKey) error {
+	return nil
+}
+
+func (m *mockStorage) GetAPIKeys(ctx context.Context, userID string) ([]storage.APIKey, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) GetAPIKeyByHash(ctx context.Context, hash string) (storage.APIKey, error) {
+	return storage.APIKey{}, storage.ErrAPIKeyNotFound
+}
+
+func (m *mockStorage) RevokeAPIKey(ctx context.Context, userID, id string, revokedAt time.Time) (storage.APIKey, error) {
+	return storage.APIKey{}, storage.ErrAPIKeyNotFound
+}
+
+func (m *mockStorage) AddClicks(ctx context.Context, clicks []storage.Click) error {
+	return nil
+}
+
+func (m *mockStorage) GetClickStats(ctx context.Context, alias storage.Alias) (storage.ClickStats, error) {
+	return storage.ClickStats{}, nil
+}
+
 func (m *mockStorage) CloseStorage(ctx context.Context) error {
 	return nil
 }
@@ -78,7 +154,7 @@ func (m *mockStorage) GetDeleteCalls() []struct {
 
 func TestNewDeleteService(t *testing.T) {
 	mockStore := &mockStorage{}
-	service := NewDeleteService(mockStore)
+	service := NewDeleteService(mockStore, zap.NewNop())
 
 	if service == nil {
 		t.Fatal("Expected DeleteService to be non-nil")
@@ -87,7 +163,7 @@ func TestNewDeleteService(t *testing.T) {
 
 func TestDeleteService_Add(t *testing.T) {
 	mockStore := &mockStorage{}
-	service := NewDeleteService(mockStore)
+	service := NewDeleteService(mockStore, zap.NewNop())
 
 	userID := "user123"
 	urls := []string{"url1", "url2", "url3"}
@@ -97,7 +173,7 @@ func TestDeleteService_Add(t *testing.T) {
 	defer service.Stop()
 
 	// Add a payload
-	service.Add(userID, urls)
+	service.Add(context.Background(), userID, urls)
 
 	// Give some time for processing
 	time.Sleep(100 * time.Millisecond)
@@ -126,7 +202,7 @@ func TestDeleteService_Add(t *testing.T) {
 
 func TestDeleteService_MultipleWorkers(t *testing.T) {
 	mockStore := &mockStorage{}
-	service := NewDeleteService(mockStore)
+	service := NewDeleteService(mockStore, zap.NewNop())
 
 	// Start with multiple workers
 	workerCount := 3
@@ -146,7 +222,7 @@ func TestDeleteService_MultipleWorkers(t *testing.T) {
 	}
 
 	for _, payload := range payloads {
-		service.Add(payload.userID, payload.urls)
+		service.Add(context.Background(), payload.userID, payload.urls)
 	}
 
 	// Give time for processing
@@ -173,7 +249,7 @@ func TestDeleteService_MultipleWorkers(t *testing.T) {
 
 func TestDeleteService_ConcurrentAdd(t *testing.T) {
 	mockStore := &mockStorage{}
-	service := NewDeleteService(mockStore)
+	service := NewDeleteService(mockStore, zap.NewNop())
 
 	service.Start(2)
 	defer service.Stop()
@@ -190,7 +266,7 @@ func TestDeleteService_ConcurrentAdd(t *testing.T) {
 			for j := 0; j < payloadsPerGoroutine; j++ {
 				userID := fmt.Sprintf("user%d", goroutineID)
 				urls := []string{fmt.Sprintf("url%d_%d", goroutineID, j)}
-				service.Add(userID, urls)
+				service.Add(context.Background(), userID, urls)
 			}
 		}(i)
 	}
@@ -200,22 +276,29 @@ func TestDeleteService_ConcurrentAdd(t *testing.T) {
 	// Give time for processing
 	time.Sleep(200 * time.Millisecond)
 
-	// Check that all payloads were processed
-	expectedCalls := numGoroutines * payloadsPerGoroutine
+	// Check that all payloads were processed, payloads of the same user may be merged
+	expectedURLs := numGoroutines * payloadsPerGoroutine
 	calls := mockStore.GetDeleteCalls()
-	if len(calls) != expectedCalls {
-		t.Fatalf("Expected %d delete calls, got %d", expectedCalls, len(calls))
+	deleted := 0
+	for _, call := range calls {
+		deleted += len(call.urls)
+	}
+	if deleted != expectedURLs {
+		t.Fatalf("Expected %d deleted URLs, got %d", expectedURLs, deleted)
+	}
+	if len(calls) > expectedURLs {
+		t.Errorf("Expected at most %d delete calls, got %d", expectedURLs, len(calls))
 	}
 }
 
 func TestDeleteService_Stop(t *testing.T) {
 	mockStore := &mockStorage{}
-	service := NewDeleteService(mockStore)
+	service := NewDeleteService(mockStore, zap.NewNop())
 
 	service.Start(1)
 
 	// Add a payload
-	service.Add("user1", []string{"url1"})
+	service.Add(context.Background(), "user1", []string{"url1"})
 
 	// Give time for processing
 	time.Sleep(100 * time.Millisecond)
@@ -229,13 +312,15 @@ func TestDeleteService_Stop(t *testing.T) {
 		t.Error("Expected at least one delete call")
 	}
 
-	// Note: Adding after stop will panic due to closed channel
-	// This is expected behavior and the test verifies the service stops gracefully
+	// Adding after stop is rejected
+	if _, err := service.Add(context.Background(), "user1", []string{"url2"}); !errors.Is(err, ErrStopped) {
+		t.Errorf("Expected ErrStopped, got %v", err)
+	}
 }
 
 func TestDeleteService_InterfaceCompliance(t *testing.T) {
 	mockStore := &mockStorage{}
-	service := NewDeleteService(mockStore)
+	service := NewDeleteService(mockStore, zap.NewNop())
 
 	// Test that DeleteService implements DeleteServiceInterface
 	var _ DeleteServiceInterface = service
@@ -243,13 +328,13 @@ func TestDeleteService_InterfaceCompliance(t *testing.T) {
 
 func TestDeleteService_EmptyURLs(t *testing.T) {
 	mockStore := &mockStorage{}
-	service := NewDeleteService(mockStore)
+	service := NewDeleteService(mockStore, zap.NewNop())
 
 	service.Start(1)
 	defer service.Stop()
 
 	// Add payload with empty URLs
-	service.Add("user1", []string{})
+	service.Add(context.Background(), "user1", []string{})
 
 	// Give time for processing
 	time.Sleep(100 * time.Millisecond)
@@ -265,3 +350,337 @@ func TestDeleteService_EmptyURLs(t *testing.T) {
 		t.Errorf("Expected empty URLs, got %v", call.urls)
 	}
 }
+
+// flakyStorage fails the first fail calls of DeleteUserURLs and can block them until release is closed
+type flakyStorage struct {
+	storage.Storage
+	mu      sync.Mutex
+	fail    int
+	err     error // returned by failed calls instead of a temporary failure
+	calls   int
+	release chan struct{}
+}
+
+func (s *flakyStorage) DeleteUserURLs(ctx context.Context, userID string, urls []string) (map[string]string, error) {
+	s.mu.Lock()
+	s.calls++
+	fail := s.calls <= s.fail
+	s.mu.Unlock()
+	if s.release != nil {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if fail && s.err != nil {
+		return nil, s.err
+	}
+	if fail {
+		return nil, fmt.Errorf("temporary failure")
+	}
+	return s.Storage.DeleteUserURLs(ctx, userID, urls)
+}
+
+func (s *flakyStorage) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// newTestService creates a service with short delays
+func newTestService(store storage.Storage) *DeleteService {
+	service := NewDeleteService(store, zap.NewNop())
+	service.retryDelay = time.Millisecond
+	service.maxRetryDelay = 5 * time.Millisecond
+	return service
+}
+
+func TestDeleteService_PersistsBeforeProcessing(t *testing.T) {
+	mem := storage.NewMemoryStorage()
+	service := newTestService(mem)
+
+	// Not started, so the job is only persisted
+	if _, err := service.Add(context.Background(), "user1", []string{"abc"}); err != nil {
+		t.Fatalf("Expected no error on Add, got %v", err)
+	}
+	jobs, err := mem.GetPendingDeleteJobs(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error on GetPendingDeleteJobs, got %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].UserID != "user1" || jobs[0].ID == "" {
+		t.Fatalf("Expected one pending job, got %+v", jobs)
+	}
+	if stats := service.Stats(); stats.Queued != 1 {
+		t.Errorf("Expected queue depth 1, got %+v", stats)
+	}
+}
+
+func TestDeleteService_ResumesPendingJobs(t *testing.T) {
+	mem := storage.NewMemoryStorage()
+	ctx := middleware.SetUserID(context.Background(), "user1")
+	if err := mem.Add(ctx, map[storage.Alias]storage.OriginalURL{"abc": "https://abc.com"}); err != nil {
+		t.Fatal(err)
+	}
+	err := mem.SaveDeleteJob(ctx, storage.DeleteJob{
+		ID:      "left",
+		UserID:  "user1",
+		Aliases: []string{"abc"},
+		Status:  storage.DeleteJobPending,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := newTestService(mem)
+	service.Start(1)
+	service.Stop()
+
+	if _, err := mem.GetURL(ctx, "abc"); !errors.Is(err, storage.ErrDeleted) {
+		t.Errorf("Expected URL to be deleted by the resumed job, got %v", err)
+	}
+	jobs, _ := mem.GetPendingDeleteJobs(ctx)
+	if len(jobs) != 0 {
+		t.Errorf("Expected no pending jobs, got %+v", jobs)
+	}
+	if job := mem.MemoryStorage.DeleteJobs["left"]; job.Status != storage.DeleteJobDone || job.Attempts != 1 {
+		t.Errorf("Expected job to be done, got %+v", job)
+	}
+}
+
+func TestDeleteService_RetriesWithBackoff(t *testing.T) {
+	store := &flakyStorage{Storage: storage.NewMemoryStorage(), fail: 2}
+	service := newTestService(store)
+	service.Start(1)
+	defer service.Stop()
+
+	if _, err := service.Add(context.Background(), "user1", []string{"abc"}); err != nil {
+		t.Fatalf("Expected no error on Add, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for service.Stats().Processed == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	stats := service.Stats()
+	if stats.Processed != 1 || stats.Failures != 2 || stats.DeadLetters != 0 {
+		t.Errorf("Expected job to succeed after 2 failures, got %+v", stats)
+	}
+	if store.Calls() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", store.Calls())
+	}
+}
+
+func TestDeleteService_DeadLetter(t *testing.T) {
+	mem := storage.NewMemoryStorage()
+	store := &flakyStorage{Storage: mem, fail: 100}
+	service := newTestService(store)
+	service.maxAttempts = 3
+	service.Start(1)
+	defer service.Stop()
+
+	if _, err := service.Add(context.Background(), "user1", []string{"abc"}); err != nil {
+		t.Fatalf("Expected no error on Add, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for service.Stats().DeadLetters == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	stats := service.Stats()
+	if stats.DeadLetters != 1 || stats.Failures != 3 || stats.Retrying != 0 {
+		t.Errorf("Expected job to be dead-lettered after 3 attempts, got %+v", stats)
+	}
+	for _, job := range mem.MemoryStorage.DeleteJobs {
+		if job.Status != storage.DeleteJobFailed || job.LastError == "" {
+			t.Errorf("Expected failed job with error, got %+v", job)
+		}
+	}
+}
+
+func TestDeleteService_PermanentError(t *testing.T) {
+	mem := storage.NewMemoryStorage()
+	store := &flakyStorage{Storage: mem, fail: 100, err: fmt.Errorf("invalid job: %w", storage.ErrUserIDRequired)}
+	service := newTestService(store)
+	service.Start(1)
+	defer service.Stop()
+
+	if _, err := service.Add(context.Background(), "", []string{"abc"}); err != nil {
+		t.Fatalf("Expected no error on Add, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for service.Stats().DeadLetters == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	stats := service.Stats()
+	if stats.DeadLetters != 1 || stats.Failures != 1 || store.Calls() != 1 {
+		t.Errorf("Expected job to be dead-lettered without retries, got %+v after %d calls", stats, store.Calls())
+	}
+	for _, job := range mem.MemoryStorage.DeleteJobs {
+		if job.Status != storage.DeleteJobFailed || job.Attempts != 1 {
+			t.Errorf("Expected failed job after one attempt, got %+v", job)
+		}
+	}
+}
+
+func TestDeleteService_StopDeadline(t *testing.T) {
+	mem := storage.NewMemoryStorage()
+	store := &flakyStorage{Storage: mem, release: make(chan struct{})}
+	service := newTestService(store)
+	service.drainTimeout = 20 * time.Millisecond
+	service.Start(1)
+
+	for i := 0; i < 3; i++ {
+		if _, err := service.Add(context.Background(), "user1", []string{fmt.Sprintf("url%d", i)}); err != nil {
+			t.Fatalf("Expected no error on Add, got %v", err)
+		}
+	}
+
+	start := time.Now()
+	service.Stop()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Stop to give up after the drain timeout, took %s", elapsed)
+	}
+
+	// Unfinished jobs are left pending for the next start without using up an attempt
+	jobs, _ := mem.GetPendingDeleteJobs(context.Background())
+	if len(jobs) != 3 {
+		t.Errorf("Expected 3 pending jobs, got %d", len(jobs))
+	}
+	for _, job := range jobs {
+		if job.Attempts != 0 {
+			t.Errorf("Expected interrupted job to keep its attempts, got %+v", job)
+		}
+	}
+	if stats := service.Stats(); stats.Failures != 0 {
+		t.Errorf("Expected interrupted deletes not to count as failures, got %+v", stats)
+	}
+}
+
+func TestDeleteService_AddBeforeStart(t *testing.T) {
+	store := &flakyStorage{Storage: storage.NewMemoryStorage()}
+	service := newTestService(store)
+
+	id, err := service.Add(context.Background(), "user1", []string{"abc"})
+	if err != nil || id == "" {
+		t.Fatalf("Expected job ID, got %q, %v", id, err)
+	}
+
+	// The job is both queued and pending in storage, it must run once
+	service.Start(1)
+	service.Stop()
+	if store.Calls() != 1 {
+		t.Errorf("Expected 1 attempt, got %d", store.Calls())
+	}
+}
+
+func TestDeleteService_MergesJobsPerUser(t *testing.T) {
+	mem := storage.NewMemoryStorage()
+	ctx := middleware.SetUserID(context.Background(), "user1")
+	err := mem.Add(ctx, map[storage.Alias]storage.OriginalURL{
+		"abc": "https://abc.com",
+		"def": "https://def.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &flakyStorage{Storage: mem}
+	service := newTestService(store)
+	service.SetBatching(BatchSize, time.Hour)
+
+	first, _ := service.Add(context.Background(), "user1", []string{"abc", "def"})
+	second, _ := service.Add(context.Background(), "user1", []string{"def", "ghi"})
+	other, _ := service.Add(context.Background(), "user2", []string{"abc"})
+
+	// Stop flushes the batch without waiting for the interval
+	service.Start(1)
+	service.Stop()
+
+	if store.Calls() != 2 {
+		t.Errorf("Expected one delete call per user, got %d", store.Calls())
+	}
+	jobs := mem.MemoryStorage.DeleteJobs
+	expected := map[string]map[string]string{
+		first:  {"abc": storage.DeleteResultDeleted, "def": storage.DeleteResultDeleted},
+		second: {"def": storage.DeleteResultDeleted, "ghi": storage.DeleteResultNotFound},
+		other:  {"abc": storage.DeleteResultNotOwner},
+	}
+	for id, results := range expected {
+		job := jobs[id]
+		if job.Status != storage.DeleteJobDone || job.Attempts != 1 {
+			t.Errorf("Expected job %s to be done after one attempt, got %+v", id, job)
+		}
+		if !reflect.DeepEqual(job.Results, results) {
+			t.Errorf("Expected results %v for job %s, got %v", results, id, job.Results)
+		}
+	}
+}
+
+func TestDeleteService_ContinuesRequestTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	service := newTestService(storage.NewMemoryStorage())
+	service.SetBatching(BatchSize, time.Hour)
+
+	ctx, request := tracing.Tracer().Start(context.Background(), "request")
+	first, _ := service.Add(ctx, "user1", []string{"abc"})
+	request.End()
+	second, _ := service.Add(context.Background(), "user1", []string{"def"})
+
+	service.Start(1)
+	service.Stop()
+
+	var deletes []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "ds.DeleteUserURLs" {
+			deletes = append(deletes, span)
+		}
+	}
+	if len(deletes) != 1 {
+		t.Fatalf("Expected one span of the merged delete, got %d", len(deletes))
+	}
+	span := deletes[0]
+	if span.Parent().SpanID() != request.SpanContext().SpanID() || span.SpanContext().TraceID() != request.SpanContext().TraceID() {
+		t.Error("Expected delete span to continue the trace of the request")
+	}
+	// Only the job added by a traced request is linked
+	links := span.Links()
+	if len(links) != 1 || links[0].Attributes[0].Value.AsString() != first {
+		t.Errorf("Expected link to job %s only, got %v", first, links)
+	}
+	if _, ok := service.traces[second]; ok || len(service.traces) != 0 {
+		t.Errorf("Expected traces of finished jobs to be dropped, got %v", service.traces)
+	}
+}
+
+func TestDeleteService_BatchSize(t *testing.T) {
+	store := &flakyStorage{Storage: storage.NewMemoryStorage()}
+	service := newTestService(store)
+	service.SetBatching(2, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if _, err := service.Add(context.Background(), "user1", []string{fmt.Sprintf("url%d", i)}); err != nil {
+			t.Fatalf("Expected no error on Add, got %v", err)
+		}
+	}
+
+	// The full batch is taken without waiting for the interval, the rest is flushed by Stop
+	service.Start(1)
+	deadline := time.Now().Add(time.Second)
+	for store.Calls() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if store.Calls() != 1 {
+		t.Fatalf("Expected the full batch to be deleted at once, got %d calls", store.Calls())
+	}
+	service.Stop()
+	if store.Calls() != 2 {
+		t.Errorf("Expected the rest to be deleted on stop, got %d calls", store.Calls())
+	}
+}
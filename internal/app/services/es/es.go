@@ -0,0 +1,81 @@
+// Package es provides expire service functionality
+package es
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// sweepTimeout is the timeout of a single sweep
+const sweepTimeout = 30 * time.Second
+
+// ExpireServiceInterface defines the interface for expire service
+type ExpireServiceInterface interface {
+	// Start starts sweeping expired URLs with specified interval
+	Start(interval time.Duration)
+
+	// Stop stops the expire service
+	Stop()
+}
+
+// ExpireService periodically marks expired URLs as deleted
+type ExpireService struct {
+	store  storage.Storage
+	logger *zap.Logger
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewExpireService creates a new expire service instance
+// store is the storage to sweep
+// logger is the logger for sweep results
+// Returns a pointer to ExpireService
+func NewExpireService(store storage.Storage, logger *zap.Logger) *ExpireService {
+	return &ExpireService{
+		store:  store,
+		logger: logger,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start starts sweeping expired URLs with specified interval
+func (es *ExpireService) Start(interval time.Duration) {
+	es.wg.Add(1)
+	go func() {
+		defer es.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-es.stop:
+				return
+			case now := <-ticker.C:
+				es.sweep(now)
+			}
+		}
+	}()
+}
+
+// Stop stops the expire service and waits for the running sweep to finish
+func (es *ExpireService) Stop() {
+	close(es.stop)
+	es.wg.Wait()
+}
+
+// sweep marks URLs expired at the given time as deleted
+func (es *ExpireService) sweep(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), sweepTimeout)
+	defer cancel()
+	count, err := es.store.DeleteExpiredURLs(ctx, now)
+	if err != nil {
+		es.logger.Error("Failed to delete expired URLs", zap.Error(err))
+		return
+	}
+	if count > 0 {
+		es.logger.Info("Deleted expired URLs", zap.Int("count", count))
+	}
+}
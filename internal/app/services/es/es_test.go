@@ -0,0 +1,61 @@
+package es
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// countingStorage counts DeleteExpiredURLs calls
+type countingStorage struct {
+	storage.Storage
+	mu    sync.Mutex
+	calls int
+}
+
+func (s *countingStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	return s.Storage.DeleteExpiredURLs(ctx, now)
+}
+
+func (s *countingStorage) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestExpireService_Sweeps(t *testing.T) {
+	mem := storage.NewMemoryStorage()
+	ctx := middleware.SetUserID(context.Background(), "user123")
+	expiresAt := time.Now().Add(20 * time.Millisecond)
+	if _, err := mem.AddOrGet(ctx, map[storage.Alias]storage.OriginalURL{"promo": "https://promo.com"}, &expiresAt); err != nil {
+		t.Fatalf("Expected no error on AddOrGet, got %v", err)
+	}
+
+	store := &countingStorage{Storage: mem}
+	service := NewExpireService(store, zap.NewNop())
+	service.Start(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	service.Stop()
+
+	if store.Calls() == 0 {
+		t.Fatal("Expected expired URLs to be swept")
+	}
+	if _, deleted := mem.MemoryStorage.Deleted["promo"]; !deleted {
+		t.Error("Expected expired URL to be marked as deleted")
+	}
+
+	// No sweeps after Stop
+	calls := store.Calls()
+	time.Sleep(30 * time.Millisecond)
+	if store.Calls() != calls {
+		t.Error("Expected no sweeps after Stop")
+	}
+}
@@ -0,0 +1,166 @@
+// Package ks provides API key service functionality
+package ks
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+)
+
+// API key scopes
+const (
+	// ScopeRead allows reading user URLs, their statistics, history and delete jobs
+	ScopeRead = "read"
+
+	// ScopeShorten allows creating and editing short URLs
+	ScopeShorten = "shorten"
+
+	// ScopeDelete allows deleting and restoring user URLs
+	ScopeDelete = "delete"
+)
+
+// Scopes are all API key scopes
+var Scopes = []string{ScopeRead, ScopeShorten, ScopeDelete}
+
+const (
+	// KeyPrefix starts every API key, so that leaked keys are easy to find
+	KeyPrefix = "usk_"
+
+	// keyBytes is the number of random bytes of a key
+	keyBytes = 32
+
+	// shownPrefixLength is the number of key characters kept to let the user recognize the key
+	shownPrefixLength = len(KeyPrefix) + 8
+
+	// MaxNameLength is the maximum length of a key name
+	MaxNameLength = 100
+)
+
+// ErrInvalidName is the error of an empty or too long key name
+var ErrInvalidName = fmt.Errorf("key name must be 1 to %d characters long", MaxNameLength)
+
+// ErrInvalidScopes is the error of an empty or unknown scope list
+var ErrInvalidScopes = fmt.Errorf("scopes must be a non-empty list of %s", strings.Join(Scopes, ", "))
+
+// KeyServiceInterface defines the interface for API key service
+type KeyServiceInterface interface {
+	middleware.APIKeyAuthenticator
+
+	// Create creates a new key of the user, the key itself is returned only once
+	Create(ctx context.Context, userID, name string, scopes []string) (key string, info storage.APIKey, err error)
+
+	// List returns keys of the user including revoked ones, oldest first
+	List(ctx context.Context, userID string) ([]storage.APIKey, error)
+
+	// Revoke revokes a key of the user, storage.ErrAPIKeyNotFound if the user has no such key
+	Revoke(ctx context.Context, userID, id string) (storage.APIKey, error)
+}
+
+// KeyService issues API keys and resolves them to their users, only hashes of the keys are stored
+type KeyService struct {
+	store storage.Storage
+	now   func() time.Time
+}
+
+// NewKeyService creates a new API key service instance
+// store is the storage for keys
+// Returns a pointer to KeyService
+func NewKeyService(store storage.Storage) *KeyService {
+	return &KeyService{store: store, now: time.Now}
+}
+
+// Create creates a new key of the user
+// ctx is the request context
+// userID is the owner of the key
+// name is the name that lets the user tell keys apart
+// scopes are the operations allowed with the key, see Scope* constants
+// Returns the key, its stored description, and ErrInvalidName, ErrInvalidScopes or a storage error
+func (s *KeyService) Create(ctx context.Context, userID, name string, scopes []string) (string, storage.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > MaxNameLength {
+		return "", storage.APIKey{}, ErrInvalidName
+	}
+	if len(scopes) == 0 {
+		return "", storage.APIKey{}, ErrInvalidScopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return "", storage.APIKey{}, ErrInvalidScopes
+		}
+	}
+	scopes = slices.Clone(scopes)
+	slices.Sort(scopes)
+
+	b := make([]byte, 16+keyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", storage.APIKey{}, fmt.Errorf("can not generate API key: %w", err)
+	}
+	id := hex.EncodeToString(b[:16])
+	key := KeyPrefix + base64.RawURLEncoding.EncodeToString(b[16:])
+
+	info := storage.APIKey{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:shownPrefixLength],
+		Hash:      hash(key),
+		Scopes:    slices.Compact(scopes),
+		CreatedAt: s.now().UTC(),
+	}
+	if err := s.store.CreateAPIKey(ctx, info); err != nil {
+		return "", storage.APIKey{}, fmt.Errorf("can not store API key: %w", err)
+	}
+	return key, info, nil
+}
+
+// List returns keys of the user
+// ctx is the request context
+// userID is the owner of the keys
+// Returns the keys including revoked ones, oldest first, and an error if retrieval failed
+func (s *KeyService) List(ctx context.Context, userID string) ([]storage.APIKey, error) {
+	return s.store.GetAPIKeys(ctx, userID)
+}
+
+// Revoke revokes a key of the user, revoking a revoked key changes nothing
+// ctx is the request context
+// userID is the owner of the key
+// id is the key identifier
+// Returns the revoked key and storage.ErrAPIKeyNotFound if the user has no such key
+func (s *KeyService) Revoke(ctx context.Context, userID, id string) (storage.APIKey, error) {
+	return s.store.RevokeAPIKey(ctx, userID, id, s.now().UTC())
+}
+
+// Authenticate resolves a key to its user
+// ctx is the request context
+// key is the API key from the request
+// Returns the user, the scopes of the key, and middleware.ErrInvalidAPIKey if the key is unknown or revoked
+func (s *KeyService) Authenticate(ctx context.Context, key string) (string, []string, error) {
+	if !strings.HasPrefix(key, KeyPrefix) {
+		return "", nil, middleware.ErrInvalidAPIKey
+	}
+	info, err := s.store.GetAPIKeyByHash(ctx, hash(key))
+	if errors.Is(err, storage.ErrAPIKeyNotFound) || (err == nil && info.RevokedAt != nil) {
+		return "", nil, middleware.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("can not get API key: %w", err)
+	}
+	return info.UserID, info.Scopes, nil
+}
+
+// hash returns the stored hash of a key
+// Keys are random, so a fast hash is enough to make a leaked storage useless for authorization
+func hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
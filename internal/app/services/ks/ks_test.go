@@ -0,0 +1,83 @@
+package ks
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+)
+
+func TestKeyService_CreateAndAuthenticate(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	service := NewKeyService(store)
+	ctx := context.Background()
+
+	key, info, err := service.Create(ctx, "user123", " ci ", []string{ScopeShorten, ScopeRead, ScopeRead})
+	if err != nil {
+		t.Fatalf("Expected no error on Create, got %v", err)
+	}
+	if !strings.HasPrefix(key, KeyPrefix) || !strings.HasPrefix(key, info.Prefix) || len(info.Prefix) != shownPrefixLength {
+		t.Errorf("Unexpected key %q with prefix %q", key, info.Prefix)
+	}
+	if info.Name != "ci" || strings.Join(info.Scopes, ",") != "read,shorten" {
+		t.Errorf("Expected trimmed name and sorted unique scopes, got %+v", info)
+	}
+
+	stored, err := store.GetAPIKeyByHash(ctx, info.Hash)
+	if err != nil || stored.Hash == key || strings.Contains(stored.Hash, key[len(KeyPrefix):]) {
+		t.Errorf("Expected only the hash of the key to be stored, got %+v, %v", stored, err)
+	}
+
+	userID, scopes, err := service.Authenticate(ctx, key)
+	if err != nil || userID != "user123" || len(scopes) != 2 {
+		t.Errorf("Expected key to resolve to its user, got %q, %v, %v", userID, scopes, err)
+	}
+	for _, invalid := range []string{"", "usk_unknown", key[len(KeyPrefix):], key + "x"} {
+		if _, _, err := service.Authenticate(ctx, invalid); !errors.Is(err, middleware.ErrInvalidAPIKey) {
+			t.Errorf("Expected ErrInvalidAPIKey for %q, got %v", invalid, err)
+		}
+	}
+
+	if _, err := service.Revoke(ctx, "other", info.ID); !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Errorf("Expected keys of other users to be not found, got %v", err)
+	}
+	if _, err := service.Revoke(ctx, "user123", info.ID); err != nil {
+		t.Fatalf("Expected no error on Revoke, got %v", err)
+	}
+	if _, _, err := service.Authenticate(ctx, key); !errors.Is(err, middleware.ErrInvalidAPIKey) {
+		t.Errorf("Expected revoked key to be rejected, got %v", err)
+	}
+
+	keys, err := service.List(ctx, "user123")
+	if err != nil || len(keys) != 1 || keys[0].RevokedAt == nil {
+		t.Errorf("Expected revoked key to stay in the list, got %+v, %v", keys, err)
+	}
+}
+
+func TestKeyService_CreateValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyName string
+		scopes  []string
+		wantErr error
+	}{
+		{name: "valid", keyName: "backup", scopes: []string{ScopeDelete}},
+		{name: "empty name", keyName: "  ", scopes: []string{ScopeRead}, wantErr: ErrInvalidName},
+		{name: "long name", keyName: strings.Repeat("a", MaxNameLength+1), scopes: []string{ScopeRead}, wantErr: ErrInvalidName},
+		{name: "no scopes", keyName: "ci", wantErr: ErrInvalidScopes},
+		{name: "unknown scope", keyName: "ci", scopes: []string{ScopeRead, "admin"}, wantErr: ErrInvalidScopes},
+	}
+
+	service := NewKeyService(storage.NewMemoryStorage())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := service.Create(context.Background(), "user123", tt.keyName, tt.scopes)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Create() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Package ps provides purge service functionality
+package ps
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// purgeTimeout is the timeout of a single purge
+const purgeTimeout = 5 * time.Minute
+
+// PurgeServiceInterface defines the interface for purge service
+type PurgeServiceInterface interface {
+	// Purge permanently removes URLs deleted longer than the retention age ago
+	Purge(ctx context.Context, now time.Time) (count int, err error)
+
+	// Start starts purging with specified interval
+	Start(interval time.Duration)
+
+	// Stop stops the purge service
+	Stop()
+}
+
+// PurgeService permanently removes URLs that were deleted longer than the retention age ago
+type PurgeService struct {
+	store          storage.Storage
+	logger         *zap.Logger
+	age            time.Duration
+	releaseAliases bool
+	stop           chan struct{}
+	wg             sync.WaitGroup
+}
+
+// NewPurgeService creates a new purge service instance
+// store is the storage to purge
+// age is the age of deletion after which URLs are removed
+// releaseAliases allows aliases of removed URLs to be used again, otherwise they stay reserved
+// logger is the logger for background purge results
+// Returns a pointer to PurgeService
+func NewPurgeService(store storage.Storage, age time.Duration, releaseAliases bool, logger *zap.Logger) *PurgeService {
+	return &PurgeService{
+		store:          store,
+		logger:         logger,
+		age:            age,
+		releaseAliases: releaseAliases,
+		stop:           make(chan struct{}),
+	}
+}
+
+// Purge permanently removes URLs deleted before now minus the retention age
+// ctx is the request context
+// now is the current time
+// Returns the number of removed URLs and an error if purging failed
+func (ps *PurgeService) Purge(ctx context.Context, now time.Time) (int, error) {
+	return ps.store.PurgeDeletedURLs(ctx, now.Add(-ps.age), ps.releaseAliases)
+}
+
+// Start starts purging with specified interval
+func (ps *PurgeService) Start(interval time.Duration) {
+	ps.wg.Add(1)
+	go func() {
+		defer ps.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ps.stop:
+				return
+			case now := <-ticker.C:
+				ps.purge(now)
+			}
+		}
+	}()
+}
+
+// Stop stops the purge service and waits for the running purge to finish
+func (ps *PurgeService) Stop() {
+	close(ps.stop)
+	ps.wg.Wait()
+}
+
+// purge runs a single background purge
+func (ps *PurgeService) purge(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), purgeTimeout)
+	defer cancel()
+	count, err := ps.Purge(ctx, now)
+	if err != nil {
+		ps.logger.Error("Failed to purge deleted URLs", zap.Error(err))
+		return
+	}
+	if count > 0 {
+		ps.logger.Info("Purged deleted URLs", zap.Int("count", count))
+	}
+}
@@ -0,0 +1,83 @@
+package ps
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// countingStorage counts PurgeDeletedURLs calls
+type countingStorage struct {
+	storage.Storage
+	mu            sync.Mutex
+	calls         int
+	deletedBefore time.Time
+}
+
+func (s *countingStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, releaseAliases bool) (int, error) {
+	s.mu.Lock()
+	s.calls++
+	s.deletedBefore = deletedBefore
+	s.mu.Unlock()
+	return s.Storage.PurgeDeletedURLs(ctx, deletedBefore, releaseAliases)
+}
+
+func (s *countingStorage) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func TestPurgeService_Purge(t *testing.T) {
+	mem := storage.NewMemoryStorage()
+	ctx := middleware.SetUserID(context.Background(), "user123")
+	if err := mem.Add(ctx, map[storage.Alias]storage.OriginalURL{"gone": "https://gone.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mem.DeleteUserURLs(ctx, "user123", []string{"gone"}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &countingStorage{Storage: mem}
+	service := NewPurgeService(store, time.Hour, false, zap.NewNop())
+
+	// Deleted just now, so it is kept
+	now := time.Now()
+	count, err := service.Purge(ctx, now)
+	if err != nil || count != 0 {
+		t.Fatalf("Expected nothing to be purged, got %d, %v", count, err)
+	}
+	if !store.deletedBefore.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Expected cutoff %s, got %s", now.Add(-time.Hour), store.deletedBefore)
+	}
+
+	count, err = service.Purge(ctx, now.Add(2*time.Hour))
+	if err != nil || count != 1 {
+		t.Fatalf("Expected 1 purged URL, got %d, %v", count, err)
+	}
+	if _, reserved := mem.MemoryStorage.Reserved["gone"]; !reserved {
+		t.Error("Expected alias of purged URL to be reserved")
+	}
+}
+
+func TestPurgeService_StartStop(t *testing.T) {
+	store := &countingStorage{Storage: storage.NewMemoryStorage()}
+	service := NewPurgeService(store, time.Hour, true, zap.NewNop())
+	service.Start(10 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	service.Stop()
+
+	if store.Calls() == 0 {
+		t.Fatal("Expected periodic purges")
+	}
+	calls := store.Calls()
+	time.Sleep(30 * time.Millisecond)
+	if store.Calls() != calls {
+		t.Error("Expected no purges after Stop")
+	}
+}
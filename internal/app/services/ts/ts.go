@@ -0,0 +1,197 @@
+// Package ts provides TLS certificate service functionality
+package ts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SelfSignedValidity is the validity period of generated self-signed certificates
+const SelfSignedValidity = 365 * 24 * time.Hour
+
+// CertificateServiceInterface defines the interface for certificate service
+type CertificateServiceInterface interface {
+	// GetCertificate returns the current certificate, it is used as tls.Config.GetCertificate
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+
+	// Start starts checking certificate files for changes with specified interval
+	Start(interval time.Duration)
+
+	// Stop stops the certificate service
+	Stop()
+}
+
+// fileVersion identifies the state of certificate and key files
+type fileVersion struct {
+	certModTime time.Time
+	certSize    int64
+	keyModTime  time.Time
+	keySize     int64
+}
+
+// CertificateService serves a certificate loaded from files and reloads it when the files change
+type CertificateService struct {
+	certFile string
+	keyFile  string
+	logger   *zap.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	version fileVersion
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewCertificateService creates a new certificate service and loads the certificate
+// certFile is the path to the PEM encoded certificate chain
+// keyFile is the path to the PEM encoded private key
+// logger is the logger for certificate reloads
+// Returns a pointer to CertificateService and an error if the certificate could not be loaded
+func NewCertificateService(certFile, keyFile string, logger *zap.Logger) (*CertificateService, error) {
+	cs := &CertificateService{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+		stop:     make(chan struct{}),
+	}
+	if _, err := cs.Reload(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// GetCertificate returns the current certificate
+// hello is the TLS client hello, it is not used
+// Returns the certificate and an error, which is always nil
+func (cs *CertificateService) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.cert, nil
+}
+
+// Reload loads the certificate again if the files changed since the last attempt
+// A certificate that fails to load does not replace the current one
+// Returns true if the certificate was replaced and an error if the files could not be loaded
+func (cs *CertificateService) Reload() (bool, error) {
+	version, err := cs.stat()
+	if err != nil {
+		return false, err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.cert != nil && version == cs.version {
+		return false, nil
+	}
+	// Remember the attempt, so broken files are reported once and retried after they change again
+	cs.version = version
+
+	cert, err := tls.LoadX509KeyPair(cs.certFile, cs.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	cs.cert = &cert
+	return true, nil
+}
+
+// Start starts checking certificate files for changes with specified interval
+func (cs *CertificateService) Start(interval time.Duration) {
+	cs.wg.Add(1)
+	go func() {
+		defer cs.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-cs.stop:
+				return
+			case <-ticker.C:
+				reloaded, err := cs.Reload()
+				if err != nil {
+					cs.logger.Error("Failed to reload TLS certificate, keeping the current one", zap.Error(err))
+				} else if reloaded {
+					cs.logger.Info("TLS certificate reloaded", zap.String("file", cs.certFile))
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the certificate service and waits for the running check to finish
+func (cs *CertificateService) Stop() {
+	close(cs.stop)
+	cs.wg.Wait()
+}
+
+// stat reads modification times and sizes of certificate and key files
+// Returns the file version and an error if a file is not accessible
+func (cs *CertificateService) stat() (fileVersion, error) {
+	cert, err := os.Stat(cs.certFile)
+	if err != nil {
+		return fileVersion{}, fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+	key, err := os.Stat(cs.keyFile)
+	if err != nil {
+		return fileVersion{}, fmt.Errorf("failed to read TLS key: %w", err)
+	}
+	return fileVersion{
+		certModTime: cert.ModTime(),
+		certSize:    cert.Size(),
+		keyModTime:  key.ModTime(),
+		keySize:     key.Size(),
+	}, nil
+}
+
+// SelfSigned generates a self-signed certificate for development
+// hosts are the DNS names and IP addresses the certificate is valid for
+// Returns the certificate and an error if generation failed
+func SelfSigned(hosts []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"url-shortener development"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(SelfSignedValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
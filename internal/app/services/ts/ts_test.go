@@ -0,0 +1,144 @@
+package ts
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// writeCertificate writes a new self-signed certificate and its key as PEM files
+func writeCertificate(t *testing.T, certFile, keyFile string, modTime time.Time) tls.Certificate {
+	t.Helper()
+	cert, err := SelfSigned([]string{"localhost"})
+	if err != nil {
+		t.Fatalf("Expected no error on SelfSigned, got %v", err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key})
+	for path, data := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		// Modification times may not change within the file system resolution
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cert
+}
+
+// serial returns the serial number of the current certificate of the service
+func serial(t *testing.T, service *CertificateService) string {
+	t.Helper()
+	cert, err := service.GetCertificate(nil)
+	if err != nil || cert == nil {
+		t.Fatalf("Expected certificate, got %v, %v", cert, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.String()
+}
+
+func TestSelfSigned(t *testing.T) {
+	cert, err := SelfSigned([]string{"localhost", "short.example", "127.0.0.1", ""})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname("short.example"); err != nil {
+		t.Errorf("Expected certificate for short.example, got %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("Expected certificate for 127.0.0.1, got %v", err)
+	}
+	if err := cert.Leaf.VerifyHostname("other.example"); err == nil {
+		t.Error("Expected certificate not to be valid for other.example")
+	}
+	if !cert.Leaf.NotAfter.After(time.Now().Add(SelfSignedValidity - time.Hour)) {
+		t.Errorf("Unexpected expiry %s", cert.Leaf.NotAfter)
+	}
+}
+
+func TestCertificateService_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	modTime := time.Now().Add(-time.Hour)
+	first := writeCertificate(t, certFile, keyFile, modTime)
+
+	service, err := NewCertificateService(certFile, keyFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got := serial(t, service); got != first.Leaf.SerialNumber.String() {
+		t.Fatalf("Expected first certificate, got serial %s", got)
+	}
+
+	// Unchanged files are not loaded again
+	if reloaded, err := service.Reload(); err != nil || reloaded {
+		t.Errorf("Expected no reload of unchanged files, got %v, %v", reloaded, err)
+	}
+
+	// Changed files replace the certificate
+	second := writeCertificate(t, certFile, keyFile, modTime.Add(time.Minute))
+	if reloaded, err := service.Reload(); err != nil || !reloaded {
+		t.Fatalf("Expected reload of changed files, got %v, %v", reloaded, err)
+	}
+	if got := serial(t, service); got != second.Leaf.SerialNumber.String() {
+		t.Errorf("Expected second certificate, got serial %s", got)
+	}
+
+	// Broken files keep the current certificate and are reported once
+	if err := os.WriteFile(keyFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Reload(); err == nil {
+		t.Error("Expected error for broken key")
+	}
+	if reloaded, err := service.Reload(); err != nil || reloaded {
+		t.Errorf("Expected broken files not to be retried before they change, got %v, %v", reloaded, err)
+	}
+	if got := serial(t, service); got != second.Leaf.SerialNumber.String() {
+		t.Errorf("Expected second certificate to be kept, got serial %s", got)
+	}
+}
+
+func TestCertificateService_Start(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	modTime := time.Now().Add(-time.Hour)
+	writeCertificate(t, certFile, keyFile, modTime)
+
+	service, err := NewCertificateService(certFile, keyFile, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	service.Start(10 * time.Millisecond)
+	defer service.Stop()
+
+	next := writeCertificate(t, certFile, keyFile, modTime.Add(time.Minute))
+	deadline := time.Now().Add(time.Second)
+	for serial(t, service) != next.Leaf.SerialNumber.String() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected certificate to be reloaded in background")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewCertificateService_MissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewCertificateService(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), zap.NewNop()); err == nil {
+		t.Error("Expected error for missing files")
+	}
+}
@@ -5,11 +5,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
 	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"github.com/vitalykrupin/url-shortener/migrations"
+	"go.uber.org/zap"
 )
 
 // DB is the PostgreSQL data storage implementation
@@ -21,38 +25,135 @@ type DB struct {
 // ErrDeleted is an error that occurs when trying to get a deleted URL
 var ErrDeleted = errors.New(`url deleted`)
 
+// ErrExpired is an error that occurs when trying to get an expired URL
+var ErrExpired = errors.New(`url expired`)
+
+// ErrNotFound is an error that occurs when a short URL does not exist
+var ErrNotFound = errors.New(`url not found`)
+
+// ErrNotOwner is an error that occurs when a user changes a URL of another user
+var ErrNotOwner = errors.New(`url belongs to another user`)
+
+// ErrJobNotFound is an error that occurs when a delete job does not exist
+var ErrJobNotFound = errors.New(`delete job not found`)
+
+// ErrAPIKeyNotFound is an error that occurs when an API key does not exist
+var ErrAPIKeyNotFound = errors.New(`api key not found`)
+
+// ErrUserNotFound is an error that occurs when a user with the login does not exist
+var ErrUserNotFound = errors.New(`user not found`)
+
+// ErrUserExists is an error that occurs when a user with the login is already registered
+var ErrUserExists = errors.New(`user already exists`)
+
+// ErrUserIDRequired is an error that occurs when a user operation is called without a user
+var ErrUserIDRequired = errors.New(`user ID is required`)
+
+// ErrConflict is an error that occurs when the user has already shortened the URL
+var ErrConflict = errors.New(`url already exists`)
+
+// ErrAliasTaken is an error that occurs when an alias is already used by another URL
+var ErrAliasTaken = errors.New(`alias already taken`)
+
+// addOrGetAttempts limits retries when a concurrent insert is not yet visible to the statement snapshot
+const addOrGetAttempts = 3
+
+// addOrGet statuses returned by addOrGetQuery
+const (
+	addOrGetInserted = iota
+	addOrGetExisting
+	addOrGetAliasTaken
+)
+
+// addOrGetQuery inserts a URL or returns the alias already stored for the user
+// The second column is one of addOrGet* statuses, the alias is reported as taken only if the URL is new
+// An expired URL that is not swept yet blocks the insert, so nothing is returned for it
+const addOrGetQuery = `
+	WITH inserted AS (
+		INSERT INTO urls (alias, url, user_id, expires_at)
+		SELECT $1::TEXT, $2::TEXT, NULLIF($3::TEXT, ''), $4::TIMESTAMPTZ
+		WHERE NOT EXISTS (SELECT 1 FROM reserved_aliases WHERE alias = $1)
+		ON CONFLICT DO NOTHING
+		RETURNING alias
+	)
+	SELECT alias, status FROM (
+		SELECT alias, 0 AS status FROM inserted
+		UNION ALL
+		SELECT alias, 1 FROM urls WHERE COALESCE(user_id, '') = $3 AND url = $2 AND deleted_flag = FALSE
+			AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		UNION ALL
+		SELECT alias, 2 FROM urls WHERE alias = $1
+		UNION ALL
+		SELECT alias, 2 FROM reserved_aliases WHERE alias = $1
+	) AS candidates
+	ORDER BY status
+	LIMIT 1;`
+
+// deleteExpiredUserURLQuery marks an expired URL of the user as deleted so that it can be shortened again
+const deleteExpiredUserURLQuery = `
+	UPDATE urls SET deleted_flag = TRUE, deleted_at = expires_at, expired_flag = TRUE
+	WHERE COALESCE(user_id, '') = $1 AND url = $2 AND deleted_flag = FALSE AND expires_at <= CURRENT_TIMESTAMP;`
+
+// deleteExpiredUserURLsQuery marks expired URLs of the user as deleted so that they can be shortened again
+const deleteExpiredUserURLsQuery = `
+	UPDATE urls SET deleted_flag = TRUE, deleted_at = expires_at, expired_flag = TRUE
+	WHERE COALESCE(user_id, '') = $1 AND url = ANY($2) AND deleted_flag = FALSE AND expires_at <= CURRENT_TIMESTAMP;`
+
+// uniqueViolation is the PostgreSQL error code of a unique constraint violation
+const uniqueViolation = "23505"
+
 // NewDB creates a new connection to the PostgreSQL database
-// DBDSN is the database connection string
+// conf is the application configuration with the connection string and pool settings
 // Returns a pointer to DB and an error if the connection failed
-func NewDB(DBDSN string) (*DB, error) {
+func NewDB(conf *config.Config) (*DB, error) {
 	ctx := context.Background()
 
+	poolConfig, err := pgxpool.ParseConfig(conf.DBDSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database DSN: %w", err)
+	}
+
+	// Apply pool settings, zero values keep pgxpool defaults
+	if conf.DBMaxConns > 0 {
+		poolConfig.MaxConns = int32(conf.DBMaxConns)
+	}
+	if conf.DBMinConns > 0 {
+		poolConfig.MinConns = min(int32(conf.DBMinConns), poolConfig.MaxConns)
+	}
+	if conf.DBConnMaxLifetime > 0 {
+		poolConfig.MaxConnLifetime = conf.DBConnMaxLifetime
+	}
+
 	// Create connection pool
-	conn, err := pgxpool.New(ctx, DBDSN)
+	conn, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
-		log.Println("Can not connect to database")
+		zap.L().Error("Can not connect to database", zap.Error(err))
 		return nil, err
 	}
 
-	// Create urls table if it doesn't exist
-	_, err = conn.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS urls (
-			id serial PRIMARY KEY,
-			alias TEXT NOT NULL UNIQUE,
-			url TEXT NOT NULL,
-			user_id TEXT,
-			deleted_flag BOOLEAN NOT NULL DEFAULT FALSE
-		);`)
-	if err != nil {
-		log.Println("Can not create table")
+	if err := conn.Ping(ctx); err != nil {
+		zap.L().Error("Can not connect to database", zap.Error(err))
+		conn.Close()
 		return nil, err
 	}
 
-	// Note: user-related tables are managed by external auth-service
+	// Note: schema is managed by versioned migrations, see Migrator
 
 	return &DB{conn}, nil
 }
 
+// PoolStats returns statistics of the connection pool
+// Returns a pointer to pgxpool.Stat
+func (d *DB) PoolStats() *pgxpool.Stat {
+	return d.pool.Stat()
+}
+
+// Migrator creates a migrator for the embedded migrations
+// Returns a pointer to Migrator and an error if migrations could not be loaded
+func (d *DB) Migrator() (*Migrator, error) {
+	return NewMigrator(d.pool, migrations.FS)
+}
+
 // Add adds new URLs to the database
 // ctx is the request context
 // batch is the map of alias -> OriginalURL to add
@@ -62,9 +163,15 @@ func (d *DB) Add(ctx context.Context, batch map[Alias]OriginalURL) error {
 		return nil
 	}
 
-	var query = `INSERT INTO urls (alias, url, user_id) VALUES (@alias, @url, @user_id)`
+	var query = `
+		INSERT INTO urls (alias, url, user_id)
+		SELECT @alias::TEXT, @url::TEXT, @user_id::TEXT
+		WHERE NOT EXISTS (SELECT 1 FROM reserved_aliases WHERE alias = @alias)
+		ON CONFLICT (alias) DO NOTHING`
 	b := &pgx.Batch{}
+	aliases := make([]Alias, 0, len(batch))
 	for alias, url := range batch {
+		aliases = append(aliases, alias)
 		b.Queue(query, pgx.NamedArgs{
 			"alias":   alias,
 			"url":     url,
@@ -75,19 +182,230 @@ func (d *DB) Add(ctx context.Context, batch map[Alias]OriginalURL) error {
 	results := d.pool.SendBatch(ctx, b)
 	defer func() {
 		if err := results.Close(); err != nil {
-			log.Printf("Failed to close batch results: %v", err)
+			middleware.Logger(ctx).Error("Failed to close batch results", zap.Error(err))
 		}
 	}()
 
+	var taken []Alias
 	for i := 0; i < len(batch); i++ {
-		if _, err := results.Exec(); err != nil {
+		tag, err := results.Exec()
+		if err != nil {
 			return fmt.Errorf("failed to execute batch query #%d: %w", i, err)
 		}
+		if tag.RowsAffected() == 0 {
+			taken = append(taken, aliases[i])
+		}
+	}
+	if len(taken) > 0 {
+		return fmt.Errorf("%w: %v", ErrAliasTaken, taken)
 	}
 
 	return nil
 }
 
+// AddOrGet atomically stores URLs that the user has not shortened yet
+// All URLs are sent in batches within one transaction
+// URLs whose new alias is already taken are left out of the result so that they can be retried with another alias
+// ctx is the request context
+// batch is the map of new alias -> OriginalURL
+// expiresAt is the expiration time of the new URLs, nil if they never expire
+// Returns a map of OriginalURL -> stored alias and ErrConflict if at least one URL already existed
+func (d *DB) AddOrGet(ctx context.Context, batch map[Alias]OriginalURL, expiresAt *time.Time) (map[OriginalURL]Alias, error) {
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	pending := make(map[OriginalURL]Alias, len(batch))
+	originals := make([]string, 0, len(batch))
+	for alias, url := range batch {
+		if _, ok := pending[url]; !ok {
+			pending[url] = alias
+			originals = append(originals, string(url))
+		}
+	}
+	if len(pending) == 0 {
+		return map[OriginalURL]Alias{}, nil
+	}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can not begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// Expired URLs that are not swept yet would block the insert without returning their alias
+	if _, err := tx.Exec(ctx, deleteExpiredUserURLsQuery, userID, originals); err != nil {
+		middleware.Logger(ctx).Error("Failed to delete expired URLs from database", zap.Error(err))
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	result := make(map[OriginalURL]Alias, len(pending))
+	conflict := false
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt == addOrGetAttempts {
+			return nil, fmt.Errorf("can not add or get aliases for %d URLs", len(pending))
+		}
+		next, err := d.addOrGetBatch(ctx, tx, userID, pending, expiresAt, func(url OriginalURL, stored Alias, status int) {
+			switch status {
+			case addOrGetInserted:
+				result[url] = stored
+			case addOrGetExisting:
+				result[url] = stored
+				conflict = true
+			}
+		})
+		if err != nil {
+			middleware.Logger(ctx).Error("Failed to add URLs to database", zap.Error(err))
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		pending = next
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("can not commit URLs: %w", err)
+	}
+
+	if conflict {
+		return result, ErrConflict
+	}
+	return result, nil
+}
+
+// addOrGetBatch sends addOrGetQuery for every pending URL in one batch
+// ctx is the request context
+// tx is the transaction of AddOrGet
+// userID is the owner user identifier, empty for anonymous URLs
+// pending is the map of OriginalURL -> new alias
+// expiresAt is the expiration time of the new URLs, nil if they never expire
+// report is called with the stored alias and one of addOrGet* statuses of each URL
+// Returns URLs without a result, whose concurrent insert was not visible to the statement snapshot yet, and an error if the batch failed
+func (d *DB) addOrGetBatch(ctx context.Context, tx pgx.Tx, userID string, pending map[OriginalURL]Alias, expiresAt *time.Time, report func(url OriginalURL, stored Alias, status int)) (map[OriginalURL]Alias, error) {
+	urls := make([]OriginalURL, 0, len(pending))
+	b := &pgx.Batch{}
+	for url, alias := range pending {
+		urls = append(urls, url)
+		b.Queue(addOrGetQuery, alias, url, userID, expiresAt)
+	}
+	br := tx.SendBatch(ctx, b)
+	defer br.Close()
+
+	next := make(map[OriginalURL]Alias)
+	for _, url := range urls {
+		var stored Alias
+		var status int
+		err := br.QueryRow().Scan(&stored, &status)
+		if errors.Is(err, pgx.ErrNoRows) {
+			next[url] = pending[url]
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		report(url, stored, status)
+	}
+	return next, br.Close()
+}
+
+// AddCustom atomically stores URLs under aliases chosen by the user in one transaction
+// The transaction is retried if a concurrent insert takes an alias or a URL after the checks
+// ctx is the request context
+// urls are the URLs with their aliases and expiration times
+// Returns the aliases of URLs the user has already shortened with ErrConflict,
+// or the taken aliases with ErrAliasTaken, nothing is stored in both cases
+func (d *DB) AddCustom(ctx context.Context, urls []CustomURL) (map[OriginalURL]Alias, []Alias, error) {
+	if len(urls) == 0 {
+		return nil, nil, nil
+	}
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	for attempt := 0; attempt < addOrGetAttempts; attempt++ {
+		existing, taken, err := d.addCustom(ctx, userID, urls)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			continue
+		}
+		return existing, taken, err
+	}
+	return nil, nil, fmt.Errorf("can not add custom aliases: concurrent inserts")
+}
+
+// addCustom checks and stores URLs under aliases chosen by the user in one transaction
+// ctx is the request context
+// userID is the owner user identifier, empty for anonymous URLs
+// urls are the URLs with their aliases and expiration times
+// Returns the result of AddCustom, or a unique violation if a concurrent insert won
+func (d *DB) addCustom(ctx context.Context, userID string, urls []CustomURL) (map[OriginalURL]Alias, []Alias, error) {
+	aliases := make([]string, 0, len(urls))
+	originals := make([]string, 0, len(urls))
+	for _, u := range urls {
+		aliases = append(aliases, string(u.Alias))
+		originals = append(originals, string(u.URL))
+	}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can not begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// Expired URLs that are not swept yet do not prevent the user from shortening them again
+	if _, err := tx.Exec(ctx, deleteExpiredUserURLsQuery, userID, originals); err != nil {
+		middleware.Logger(ctx).Error("Failed to delete expired URLs from database", zap.Error(err))
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT url, alias FROM urls
+		WHERE COALESCE(user_id, '') = $1 AND url = ANY($2) AND deleted_flag = FALSE;`, userID, originals)
+	if err != nil {
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+	existing := make(map[OriginalURL]Alias)
+	for rows.Next() {
+		var url OriginalURL
+		var alias Alias
+		if err := rows.Scan(&url, &alias); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("database error: %w", err)
+		}
+		existing[url] = alias
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+	if len(existing) > 0 {
+		return existing, nil, ErrConflict
+	}
+
+	rows, err = tx.Query(ctx, `
+		SELECT alias FROM urls WHERE alias = ANY($1)
+		UNION
+		SELECT alias FROM reserved_aliases WHERE alias = ANY($1)
+		ORDER BY alias;`, aliases)
+	if err != nil {
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+	taken, err := pgx.CollectRows(rows, pgx.RowTo[Alias])
+	if err != nil {
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+	if len(taken) > 0 {
+		return nil, taken, fmt.Errorf("%w: %v", ErrAliasTaken, taken)
+	}
+
+	b := &pgx.Batch{}
+	for _, u := range urls {
+		b.Queue(`INSERT INTO urls (alias, url, user_id, expires_at) VALUES ($1, $2, NULLIF($3, ''), $4);`, u.Alias, u.URL, userID, u.ExpiresAt)
+	}
+	if err := tx.SendBatch(ctx, b).Close(); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, nil, fmt.Errorf("can not commit custom aliases: %w", err)
+	}
+	return nil, nil, nil
+}
+
 // GetAlias gets the alias for a given URL
 // ctx is the request context
 // url is the original URL
@@ -104,7 +422,7 @@ func (d *DB) GetAlias(ctx context.Context, url OriginalURL) (Alias, error) {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return "", fmt.Errorf("alias not found for URL: %s", url)
 		}
-		log.Printf("Failed to get alias from database: %v", err)
+		middleware.Logger(ctx).Error("Failed to get alias from database", zap.Error(err))
 		return "", fmt.Errorf("database error: %w", err)
 	}
 	return alias, nil
@@ -117,34 +435,60 @@ func (d *DB) GetAlias(ctx context.Context, url OriginalURL) (Alias, error) {
 func (d *DB) GetURL(ctx context.Context, alias Alias) (OriginalURL, error) {
 	var url OriginalURL
 	var deletedFlag bool
-	row := d.pool.QueryRow(ctx, `SELECT url, deleted_flag FROM urls WHERE alias = $1;`, alias)
-	err := row.Scan(&url, &deletedFlag)
+	var expiresAt *time.Time
+	row := d.pool.QueryRow(ctx, `SELECT url, deleted_flag, expires_at FROM urls WHERE alias = $1;`, alias)
+	err := row.Scan(&url, &deletedFlag, &expiresAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return "", fmt.Errorf("URL not found for alias: %s", alias)
 		}
-		log.Printf("Failed to get URL from database: %v", err)
+		middleware.Logger(ctx).Error("Failed to get URL from database", zap.Error(err))
 		return "", fmt.Errorf("database error: %w", err)
 	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", ErrExpired
+	}
 	if deletedFlag {
 		return "", ErrDeleted
 	}
 	return url, nil
 }
 
-// GetUserURLs gets all URLs for a user
+// GetURLRecord gets the short URL including deleted and expired ones
+// ctx is the request context
+// alias is the short URL alias
+// Returns the URL record and ErrNotFound if the alias does not exist
+func (d *DB) GetURLRecord(ctx context.Context, alias Alias) (URLRecord, error) {
+	record := URLRecord{Alias: alias}
+	row := d.pool.QueryRow(ctx, `SELECT url, COALESCE(user_id, ''), expires_at FROM urls WHERE alias = $1;`, alias)
+	err := row.Scan(&record.URL, &record.UserID, &record.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return URLRecord{}, ErrNotFound
+		}
+		middleware.Logger(ctx).Error("Failed to get URL from database", zap.Error(err))
+		return URLRecord{}, fmt.Errorf("database error: %w", err)
+	}
+	return record, nil
+}
+
+// GetUserURLs gets not deleted and expired URLs for a user
+// Expired URLs are listed even after the sweeper marked them as deleted, URLs deleted by the user are not
 // ctx is the request context
 // userID is the user identifier
-// Returns a map of alias -> OriginalURL and an error if retrieval failed
-func (d *DB) GetUserURLs(ctx context.Context, userID string) (AliasKeysMap, error) {
+// Returns URLs sorted by alias and an error if retrieval failed
+func (d *DB) GetUserURLs(ctx context.Context, userID string) ([]URLRecord, error) {
 	if userID == "" {
-		return nil, fmt.Errorf("user ID is required")
+		return nil, ErrUserIDRequired
 	}
 
-	result := make(AliasKeysMap)
-	rows, err := d.pool.Query(ctx, `SELECT alias, url FROM urls WHERE user_id = $1;`, userID)
+	result := make([]URLRecord, 0)
+	rows, err := d.pool.Query(ctx, `
+		SELECT alias, url, expires_at FROM urls
+		WHERE user_id = $1 AND (deleted_flag = FALSE OR expired_flag = TRUE)
+		ORDER BY alias;`, userID)
 	if err != nil {
-		log.Printf("Failed to query user URLs from database: %v", err)
+		middleware.Logger(ctx).Error("Failed to query user URLs from database", zap.Error(err))
 		return nil, fmt.Errorf("database query error: %w", err)
 	}
 	defer func() {
@@ -152,11 +496,11 @@ func (d *DB) GetUserURLs(ctx context.Context, userID string) (AliasKeysMap, erro
 	}()
 
 	for rows.Next() {
-		var alias, originalURL string
-		if err := rows.Scan(&alias, &originalURL); err != nil {
+		record := URLRecord{UserID: userID}
+		if err := rows.Scan(&record.Alias, &record.URL, &record.ExpiresAt); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
-		result[Alias(alias)] = OriginalURL(originalURL)
+		result = append(result, record)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -166,28 +510,577 @@ func (d *DB) GetUserURLs(ctx context.Context, userID string) (AliasKeysMap, erro
 	return result, nil
 }
 
+// UpdateUserURL changes the destination or expiration of a user URL and keeps the previous state in url_edits
+// ctx is the request context
+// userID is the user identifier
+// alias is the short URL alias
+// update is the change to apply
+// Returns the updated URL record and ErrNotFound, ErrNotOwner, ErrExpired, ErrDeleted or ErrConflict if the URL can not be changed
+func (d *DB) UpdateUserURL(ctx context.Context, userID string, alias Alias, update URLUpdate) (URLRecord, error) {
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return URLRecord{}, fmt.Errorf("can not begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	record := URLRecord{Alias: alias}
+	var deletedFlag bool
+	err = tx.QueryRow(ctx, `
+		SELECT url, COALESCE(user_id, ''), expires_at, deleted_flag FROM urls
+		WHERE alias = $1
+		FOR UPDATE;`, alias).Scan(&record.URL, &record.UserID, &record.ExpiresAt, &deletedFlag)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return URLRecord{}, ErrNotFound
+		}
+		middleware.Logger(ctx).Error("Failed to get URL from database", zap.Error(err))
+		return URLRecord{}, fmt.Errorf("database error: %w", err)
+	}
+	now := time.Now()
+	switch {
+	case userID == "" || record.UserID != userID:
+		return URLRecord{}, ErrNotOwner
+	case record.Expired(now):
+		return URLRecord{}, ErrExpired
+	case deletedFlag:
+		return URLRecord{}, ErrDeleted
+	}
+
+	updated := update.apply(record)
+	if updated.URL == record.URL && sameTime(updated.ExpiresAt, record.ExpiresAt) {
+		return record, nil
+	}
+	if updated.URL != record.URL {
+		// An expired URL of the user that is not swept yet must not block the new destination
+		if _, err := tx.Exec(ctx, deleteExpiredUserURLQuery, userID, updated.URL); err != nil {
+			middleware.Logger(ctx).Error("Failed to delete expired URL from database", zap.Error(err))
+			return URLRecord{}, fmt.Errorf("database error: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO url_edits (alias, url, expires_at, edited_at) VALUES ($1, $2, $3, $4);`,
+		alias, record.URL, record.ExpiresAt, now)
+	if err != nil {
+		middleware.Logger(ctx).Error("Failed to add URL edit to database", zap.Error(err))
+		return URLRecord{}, fmt.Errorf("database error: %w", err)
+	}
+	_, err = tx.Exec(ctx, `UPDATE urls SET url = $2, expires_at = $3 WHERE alias = $1;`, alias, updated.URL, updated.ExpiresAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return URLRecord{}, ErrConflict
+		}
+		middleware.Logger(ctx).Error("Failed to update URL in database", zap.Error(err))
+		return URLRecord{}, fmt.Errorf("database error: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return URLRecord{}, fmt.Errorf("can not commit URL update: %w", err)
+	}
+	return updated, nil
+}
+
+// GetURLHistory gets previous states of a short URL
+// ctx is the request context
+// alias is the short URL alias
+// Returns the previous states, oldest first, and an error if retrieval failed
+func (d *DB) GetURLHistory(ctx context.Context, alias Alias) ([]URLEdit, error) {
+	rows, err := d.pool.Query(ctx, `
+		SELECT url, expires_at, edited_at FROM url_edits
+		WHERE alias = $1
+		ORDER BY id;`, alias)
+	if err != nil {
+		middleware.Logger(ctx).Error("Failed to query URL history from database", zap.Error(err))
+		return nil, fmt.Errorf("database query error: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]URLEdit, 0)
+	for rows.Next() {
+		var edit URLEdit
+		if err := rows.Scan(&edit.URL, &edit.ExpiresAt, &edit.EditedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		result = append(result, edit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return result, nil
+}
+
+// deleteUserURLsQuery marks aliases of the user as deleted and reports a result for every requested alias
+// The urls scan sees the rows as they were before the update, so the update result is checked first
+const deleteUserURLsQuery = `
+	WITH requested AS (
+		SELECT DISTINCT unnest($2::TEXT[]) AS alias
+	), deleted AS (
+		UPDATE urls SET deleted_flag = TRUE, deleted_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND alias = ANY($2) AND deleted_flag = FALSE
+		RETURNING alias
+	)
+	SELECT r.alias, CASE
+		WHEN d.alias IS NOT NULL THEN $3
+		WHEN u.alias IS NULL THEN $4
+		WHEN COALESCE(u.user_id, '') <> $1 THEN $5
+		ELSE $6
+	END
+	FROM requested r
+	LEFT JOIN deleted d ON d.alias = r.alias
+	LEFT JOIN urls u ON u.alias = r.alias;`
+
 // DeleteUserURLs marks user URLs as deleted
 // ctx is the request context
 // userID is the user identifier
 // aliases is the list of aliases to delete
-// Returns an error if deletion failed
-func (d *DB) DeleteUserURLs(ctx context.Context, userID string, aliases []string) error {
+// Returns one of DeleteResult* values for every alias and an error if deletion failed
+func (d *DB) DeleteUserURLs(ctx context.Context, userID string, aliases []string) (map[string]string, error) {
 	if userID == "" {
-		return fmt.Errorf("user ID is required")
+		return nil, ErrUserIDRequired
 	}
 
+	results := make(map[string]string, len(aliases))
 	if len(aliases) == 0 {
+		return results, nil
+	}
+
+	rows, err := d.pool.Query(ctx, deleteUserURLsQuery, userID, aliases,
+		DeleteResultDeleted, DeleteResultNotFound, DeleteResultNotOwner, DeleteResultAlreadyDeleted)
+	if err != nil {
+		middleware.Logger(ctx).Error("Failed to delete URLs from database", zap.Error(err))
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var alias, result string
+		if err := rows.Scan(&alias, &result); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		results[alias] = result
+	}
+	if err := rows.Err(); err != nil {
+		middleware.Logger(ctx).Error("Failed to delete URLs from database", zap.Error(err))
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return results, nil
+}
+
+// RestoreUserURLs clears the deleted mark of user URLs deleted after the given time
+// ctx is the request context
+// userID is the user identifier
+// aliases is the list of aliases to restore
+// deletedAfter is the start of the grace period
+// Returns one of RestoreResult* values for every alias and an error if restoration failed
+func (d *DB) RestoreUserURLs(ctx context.Context, userID string, aliases []string, deletedAfter time.Time) (map[string]string, error) {
+	if userID == "" {
+		return nil, ErrUserIDRequired
+	}
+
+	results := make(map[string]string, len(aliases))
+	if len(aliases) == 0 {
+		return results, nil
+	}
+
+	tx, err := d.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can not begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	rows, err := tx.Query(ctx, `
+		SELECT alias, url, COALESCE(user_id, ''), expires_at, deleted_flag, deleted_at FROM urls
+		WHERE alias = ANY($1)
+		FOR UPDATE;`, aliases)
+	if err != nil {
+		middleware.Logger(ctx).Error("Failed to get URLs from database", zap.Error(err))
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	type stored struct {
+		record    URLRecord
+		deletedAt *time.Time
+	}
+	found := make(map[string]stored, len(aliases))
+	for rows.Next() {
+		var s stored
+		var deletedFlag bool
+		if err := rows.Scan(&s.record.Alias, &s.record.URL, &s.record.UserID, &s.record.ExpiresAt, &deletedFlag, &s.deletedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		switch {
+		case !deletedFlag:
+			s.deletedAt = nil
+		case s.deletedAt == nil:
+			// Deleted before the deletion time was recorded, so out of any grace period
+			s.deletedAt = &time.Time{}
+		}
+		found[string(s.record.Alias)] = s
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		middleware.Logger(ctx).Error("Failed to get URLs from database", zap.Error(err))
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	now := time.Now()
+	var candidates []URLRecord
+	for _, alias := range aliases {
+		if results[alias] != "" {
+			continue
+		}
+		s, ok := found[alias]
+		if !ok {
+			results[alias] = RestoreResultNotFound
+			continue
+		}
+		results[alias] = restoreResult(s.record, userID, s.deletedAt, deletedAfter, now)
+		if results[alias] == RestoreResultRestored {
+			candidates = append(candidates, s.record)
+		}
+	}
+	if len(candidates) == 0 {
+		return results, nil
+	}
+
+	// A URL the user shortened again after the deletion can not be taken back,
+	// an expired one that is not swept yet must not block the restoration
+	urls := make([]string, 0, len(candidates))
+	for _, record := range candidates {
+		if _, err := tx.Exec(ctx, deleteExpiredUserURLQuery, userID, record.URL); err != nil {
+			middleware.Logger(ctx).Error("Failed to delete expired URL from database", zap.Error(err))
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		urls = append(urls, string(record.URL))
+	}
+	rows, err = tx.Query(ctx, `
+		SELECT url FROM urls
+		WHERE user_id = $1 AND url = ANY($2) AND deleted_flag = FALSE;`, userID, urls)
+	if err != nil {
+		middleware.Logger(ctx).Error("Failed to get URLs from database", zap.Error(err))
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	taken := make(map[OriginalURL]bool)
+	for rows.Next() {
+		var url OriginalURL
+		if err := rows.Scan(&url); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		taken[url] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		middleware.Logger(ctx).Error("Failed to get URLs from database", zap.Error(err))
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	restored := make([]string, 0, len(candidates))
+	for _, record := range candidates {
+		if taken[record.URL] {
+			results[string(record.Alias)] = RestoreResultConflict
+			continue
+		}
+		taken[record.URL] = true
+		restored = append(restored, string(record.Alias))
+	}
+	if len(restored) > 0 {
+		_, err = tx.Exec(ctx, `UPDATE urls SET deleted_flag = FALSE, deleted_at = NULL, expired_flag = FALSE WHERE alias = ANY($1);`, restored)
+		if err != nil {
+			middleware.Logger(ctx).Error("Failed to restore URLs in database", zap.Error(err))
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("can not commit URL restoration: %w", err)
+	}
+	return results, nil
+}
+
+// purgeDeletedURLsQuery removes URLs deleted before $1 with their clicks and edit history
+// and reserves their aliases unless $2 allows reusing them
+const purgeDeletedURLsQuery = `
+	WITH purged AS (
+		DELETE FROM urls
+		WHERE deleted_flag = TRUE AND deleted_at < $1
+		RETURNING alias
+	), purged_clicks AS (
+		DELETE FROM clicks WHERE alias IN (SELECT alias FROM purged)
+	), purged_edits AS (
+		DELETE FROM url_edits WHERE alias IN (SELECT alias FROM purged)
+	), reserved AS (
+		INSERT INTO reserved_aliases (alias)
+		SELECT alias FROM purged WHERE NOT $2::BOOLEAN
+		ON CONFLICT DO NOTHING
+	)
+	SELECT COUNT(*) FROM purged;`
+
+// PurgeDeletedURLs permanently removes URLs deleted before the given time
+// ctx is the request context
+// deletedBefore is the time before which deleted URLs are removed
+// releaseAliases allows the aliases to be used again, otherwise they stay reserved
+// Returns the number of removed URLs and an error if removal failed
+func (d *DB) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, releaseAliases bool) (int, error) {
+	var count int
+	if err := d.pool.QueryRow(ctx, purgeDeletedURLsQuery, deletedBefore, releaseAliases).Scan(&count); err != nil {
+		middleware.Logger(ctx).Error("Failed to purge deleted URLs from database", zap.Error(err))
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteExpiredURLs marks URLs expired at the given time as deleted as of their expiration time
+// ctx is the request context
+// now is the current time
+// Returns the number of deleted URLs and an error if deletion failed
+func (d *DB) DeleteExpiredURLs(ctx context.Context, now time.Time) (int, error) {
+	tag, err := d.pool.Exec(ctx, `
+		UPDATE urls SET deleted_flag = TRUE, deleted_at = expires_at, expired_flag = TRUE
+		WHERE deleted_flag = FALSE AND expires_at <= $1;`, now)
+	if err != nil {
+		middleware.Logger(ctx).Error("Failed to delete expired URLs from database", zap.Error(err))
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// SaveDeleteJob creates or replaces a delete job
+// ctx is the request context
+// job is the delete job to save
+// Returns an error if saving failed
+func (d *DB) SaveDeleteJob(ctx context.Context, job DeleteJob) error {
+	_, err := d.pool.Exec(ctx, `
+		INSERT INTO delete_jobs (id, user_id, aliases, status, attempts, last_error, results, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			attempts = EXCLUDED.attempts,
+			last_error = EXCLUDED.last_error,
+			results = EXCLUDED.results,
+			updated_at = EXCLUDED.updated_at;`,
+		job.ID, job.UserID, job.Aliases, job.Status, job.Attempts, job.LastError, job.Results, job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		middleware.Logger(ctx).Error("Failed to save delete job to database", zap.Error(err))
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
+}
+
+// deleteJobColumns are the delete_jobs columns read by scanDeleteJob
+const deleteJobColumns = `id, user_id, aliases, status, attempts, last_error, results, created_at, updated_at`
+
+// scanDeleteJob reads a delete job selected with deleteJobColumns
+func scanDeleteJob(row pgx.Row) (DeleteJob, error) {
+	var job DeleteJob
+	err := row.Scan(&job.ID, &job.UserID, &job.Aliases, &job.Status, &job.Attempts, &job.LastError, &job.Results, &job.CreatedAt, &job.UpdatedAt)
+	return job, err
+}
+
+// GetDeleteJob gets a delete job by ID
+// ctx is the request context
+// id is the job identifier
+// Returns the job and ErrJobNotFound if it does not exist
+func (d *DB) GetDeleteJob(ctx context.Context, id string) (DeleteJob, error) {
+	job, err := scanDeleteJob(d.pool.QueryRow(ctx, `SELECT `+deleteJobColumns+` FROM delete_jobs WHERE id = $1;`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return DeleteJob{}, ErrJobNotFound
+		}
+		middleware.Logger(ctx).Error("Failed to get delete job from database", zap.Error(err))
+		return DeleteJob{}, fmt.Errorf("database error: %w", err)
+	}
+	return job, nil
+}
+
+// GetPendingDeleteJobs gets delete jobs that are not finished yet
+// ctx is the request context
+// Returns the pending jobs, oldest first, and an error if retrieval failed
+func (d *DB) GetPendingDeleteJobs(ctx context.Context) ([]DeleteJob, error) {
+	rows, err := d.pool.Query(ctx, `
+		SELECT `+deleteJobColumns+` FROM delete_jobs
+		WHERE status = $1
+		ORDER BY created_at, id;`, DeleteJobPending)
+	if err != nil {
+		middleware.Logger(ctx).Error("Failed to query delete jobs from database", zap.Error(err))
+		return nil, fmt.Errorf("database query error: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]DeleteJob, 0)
+	for rows.Next() {
+		job, err := scanDeleteJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		result = append(result, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return result, nil
+}
+
+// CreateAPIKey stores a new API key
+// ctx is the request context
+// key is the API key to store
+// Returns an error if storing failed
+func (d *DB) CreateAPIKey(ctx context.Context, key APIKey) error {
+	_, err := d.pool.Exec(ctx, `
+		INSERT INTO api_keys (id, user_id, name, prefix, hash, scopes, created_at, revoked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);`,
+		key.ID, key.UserID, key.Name, key.Prefix, key.Hash, key.Scopes, key.CreatedAt, key.RevokedAt)
+	if err != nil {
+		middleware.Logger(ctx).Error("Failed to create API key in database", zap.Error(err))
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
+}
+
+// apiKeyColumns are the api_keys columns read by scanAPIKey
+const apiKeyColumns = `id, user_id, name, prefix, hash, scopes, created_at, revoked_at`
+
+// scanAPIKey reads an API key selected with apiKeyColumns
+func scanAPIKey(row pgx.Row) (APIKey, error) {
+	var key APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Hash, &key.Scopes, &key.CreatedAt, &key.RevokedAt)
+	return key, err
+}
+
+// GetAPIKeys gets API keys of a user
+// ctx is the request context
+// userID is the user identifier
+// Returns the keys including revoked ones, oldest first, and an error if retrieval failed
+func (d *DB) GetAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	rows, err := d.pool.Query(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at, id;`, userID)
+	if err != nil {
+		middleware.Logger(ctx).Error("Failed to query API keys from database", zap.Error(err))
+		return nil, fmt.Errorf("database query error: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		result = append(result, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return result, nil
+}
+
+// GetAPIKeyByHash gets an API key by the hash of the key
+// ctx is the request context
+// hash is the hash of the key
+// Returns the key and ErrAPIKeyNotFound if it does not exist
+func (d *DB) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	key, err := scanAPIKey(d.pool.QueryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = $1;`, hash))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return APIKey{}, ErrAPIKeyNotFound
+		}
+		middleware.Logger(ctx).Error("Failed to get API key from database", zap.Error(err))
+		return APIKey{}, fmt.Errorf("database error: %w", err)
+	}
+	return key, nil
+}
+
+// RevokeAPIKey marks an API key of a user as revoked
+// ctx is the request context
+// userID is the user identifier
+// id is the key identifier
+// revokedAt is the revocation time, it is ignored for keys revoked before
+// Returns the key and ErrAPIKeyNotFound if it does not exist or belongs to another user
+func (d *DB) RevokeAPIKey(ctx context.Context, userID, id string, revokedAt time.Time) (APIKey, error) {
+	key, err := scanAPIKey(d.pool.QueryRow(ctx, `
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $3)
+		WHERE id = $1 AND user_id = $2
+		RETURNING `+apiKeyColumns+`;`, id, userID, revokedAt))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return APIKey{}, ErrAPIKeyNotFound
+		}
+		middleware.Logger(ctx).Error("Failed to revoke API key in database", zap.Error(err))
+		return APIKey{}, fmt.Errorf("database error: %w", err)
+	}
+	return key, nil
+}
+
+// AddClicks stores redirect events
+// ctx is the request context
+// clicks is the list of events to store
+// Returns an error if storing failed
+func (d *DB) AddClicks(ctx context.Context, clicks []Click) error {
+	if len(clicks) == 0 {
 		return nil
 	}
 
-	_, err := d.pool.Exec(ctx, `UPDATE urls SET deleted_flag = TRUE WHERE user_id = $1 AND alias = ANY($2);`, userID, aliases)
+	rows := make([][]any, 0, len(clicks))
+	for _, c := range clicks {
+		rows = append(rows, []any{string(c.Alias), c.Time, c.Referrer, c.UserAgent, c.IP})
+	}
+	_, err := d.pool.CopyFrom(ctx,
+		pgx.Identifier{"clicks"},
+		[]string{"alias", "clicked_at", "referrer", "user_agent", "ip"},
+		pgx.CopyFromRows(rows),
+	)
 	if err != nil {
-		log.Printf("Failed to delete URLs from database: %v", err)
+		middleware.Logger(ctx).Error("Failed to add clicks to database", zap.Error(err))
 		return fmt.Errorf("database error: %w", err)
 	}
 	return nil
 }
 
+// GetClickStats aggregates redirect events of a short URL
+// ctx is the request context
+// alias is the short URL alias
+// Returns the statistics and an error if aggregation failed
+func (d *DB) GetClickStats(ctx context.Context, alias Alias) (ClickStats, error) {
+	stats := ClickStats{Daily: make([]DailyClicks, 0)}
+	err := d.pool.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT (ip, user_agent)) FROM clicks WHERE alias = $1;`, alias).
+		Scan(&stats.Total, &stats.UniqueVisitors)
+	if err != nil {
+		middleware.Logger(ctx).Error("Failed to count clicks in database", zap.Error(err))
+		return ClickStats{}, fmt.Errorf("database error: %w", err)
+	}
+
+	rows, err := d.pool.Query(ctx, `
+		SELECT to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, COUNT(*) FROM clicks
+		WHERE alias = $1
+		GROUP BY day
+		ORDER BY day;`, alias)
+	if err != nil {
+		middleware.Logger(ctx).Error("Failed to query daily clicks from database", zap.Error(err))
+		return ClickStats{}, fmt.Errorf("database query error: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day DailyClicks
+		if err := rows.Scan(&day.Date, &day.Clicks); err != nil {
+			return ClickStats{}, fmt.Errorf("failed to scan row: %w", err)
+		}
+		stats.Daily = append(stats.Daily, day)
+	}
+	if err := rows.Err(); err != nil {
+		return ClickStats{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return stats, nil
+}
+
 // CloseStorage closes the database connection
 // ctx is the request context
 // Returns an error if closing failed
@@ -207,7 +1100,7 @@ func (d *DB) PingStorage(ctx context.Context) error {
 	}
 
 	if err := d.pool.Ping(ctx); err != nil {
-		log.Printf("Failed to ping database: %v", err)
+		middleware.Logger(ctx).Error("Failed to ping database", zap.Error(err))
 		return fmt.Errorf("database ping failed: %w", err)
 	}
 	return nil
@@ -222,9 +1115,9 @@ func (d *DB) GetUserByLogin(ctx context.Context, login string) (user *User, err
 	err = d.pool.QueryRow(ctx, `SELECT id, login, password, user_id FROM users WHERE login = $1;`, login).Scan(&user.ID, &user.Login, &user.Password, &user.UserID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, fmt.Errorf("user not found for login: %s", login)
+			return nil, fmt.Errorf("%w for login: %s", ErrUserNotFound, login)
 		}
-		log.Printf("Failed to get user from database: %v", err)
+		middleware.Logger(ctx).Error("Failed to get user from database", zap.Error(err))
 		return nil, fmt.Errorf("database error: %w", err)
 	}
 	return user, nil
@@ -237,7 +1130,11 @@ func (d *DB) GetUserByLogin(ctx context.Context, login string) (user *User, err
 func (d *DB) CreateUser(ctx context.Context, user *User) error {
 	_, err := d.pool.Exec(ctx, `INSERT INTO users (login, password, user_id) VALUES ($1, $2, $3);`, user.Login, user.Password, user.UserID)
 	if err != nil {
-		log.Printf("Failed to create user in database: %v", err)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return fmt.Errorf("%w with login: %s", ErrUserExists, user.Login)
+		}
+		middleware.Logger(ctx).Error("Failed to create user in database", zap.Error(err))
 		return fmt.Errorf("database error: %w", err)
 	}
 	return nil
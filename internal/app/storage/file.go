@@ -8,14 +8,68 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
 )
 
 // JSONFS represents the JSON structure for file storage
+// A record with DeletedFlag set is a tombstone that marks a previously added alias as deleted,
+// by the expiry sweeper if Expired is also set,
+// a record with RestoredAt set clears the deleted mark of a previously deleted alias,
+// a record with EditedAt set replaces the destination and expiration of a previously added alias,
+// a record with Reserved set keeps a purged alias from being used again
 type JSONFS struct {
-	UUID  string      `json:"id"`
-	Alias Alias       `json:"alias"`
-	URL   OriginalURL `json:"url"`
+	UUID        string      `json:"id"`
+	Alias       Alias       `json:"alias"`
+	URL         OriginalURL `json:"url"`
+	UserID      string      `json:"user_id,omitempty"`
+	ExpiresAt   *time.Time  `json:"expires_at,omitempty"`
+	DeletedFlag bool        `json:"is_deleted,omitempty"`
+	DeletedAt   *time.Time  `json:"deleted_at,omitempty"`
+	Expired     bool        `json:"is_expired,omitempty"`
+	EditedAt    *time.Time  `json:"edited_at,omitempty"`
+	RestoredAt  *time.Time  `json:"restored_at,omitempty"`
+	Reserved    bool        `json:"reserved,omitempty"`
+}
+
+// JSONClickFS represents the JSON structure of a redirect event in the clicks file
+type JSONClickFS struct {
+	Alias     Alias     `json:"alias"`
+	Time      time.Time `json:"time"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+}
+
+// JSONDeleteJobFS represents the JSON structure of a delete job state in the jobs file
+// The file is a log of states, the last state of a job wins
+type JSONDeleteJobFS struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"user_id"`
+	Aliases   []string          `json:"aliases"`
+	Status    string            `json:"status"`
+	Attempts  int               `json:"attempts,omitempty"`
+	LastError string            `json:"last_error,omitempty"`
+	Results   map[string]string `json:"results,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// JSONAPIKeyFS represents the JSON structure of an API key state in the keys file
+// The file is a log of states, the last state of a key wins
+type JSONAPIKeyFS struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"hash"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
 }
 
 // JSONUserFS represents the JSON structure for user file storage
@@ -29,8 +83,14 @@ type JSONUserFS struct {
 // FileStorage implements file-based data storage
 type FileStorage struct {
 	SyncMemoryStorage *SyncMemoryStorage
+	path              string
+	mu                sync.Mutex   // serializes writes to file
+	writeMu           sync.RWMutex // held by URL writers between changing memory and appending, taken exclusively by compaction
 	file              *os.File
 	usersFile         *os.File
+	clicksFile        *os.File
+	jobsFile          *os.File
+	keysFile          *os.File
 	users             map[string]*User // login -> user
 }
 
@@ -54,10 +114,29 @@ func NewFileStorage(FileStoragePath string) (*FileStorage, error) {
 		return nil, fmt.Errorf("can not open users file: %w", err)
 	}
 
-	fs := FileStorage{
+	clicksFile, err := os.OpenFile(FileStoragePath+".clicks", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("can not open clicks file: %w", err)
+	}
+
+	jobsFile, err := os.OpenFile(FileStoragePath+".jobs", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("can not open jobs file: %w", err)
+	}
+
+	keysFile, err := os.OpenFile(FileStoragePath+".keys", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("can not open API keys file: %w", err)
+	}
+
+	fs := &FileStorage{
 		SyncMemoryStorage: syncMem,
+		path:              FileStoragePath,
 		file:              file,
 		usersFile:         usersFile,
+		clicksFile:        clicksFile,
+		jobsFile:          jobsFile,
+		keysFile:          keysFile,
 		users:             make(map[string]*User),
 	}
 
@@ -69,7 +148,19 @@ func NewFileStorage(FileStoragePath string) (*FileStorage, error) {
 		return nil, fmt.Errorf("can not load users from file: %w", err)
 	}
 
-	return &fs, nil
+	if err := fs.loadClicksFromFile(); err != nil {
+		return nil, fmt.Errorf("can not load clicks from file: %w", err)
+	}
+
+	if err := fs.loadDeleteJobsFromFile(); err != nil {
+		return nil, fmt.Errorf("can not load delete jobs from file: %w", err)
+	}
+
+	if err := fs.loadAPIKeysFromFile(); err != nil {
+		return nil, fmt.Errorf("can not load API keys from file: %w", err)
+	}
+
+	return fs, nil
 }
 
 // loadUsersFromFile loads users from the file system
@@ -97,49 +188,118 @@ func (f *FileStorage) loadUsersFromFile() error {
 	return nil
 }
 
-// LoadJSONfromFS loads JSON data from the file system
+// loadClicksFromFile loads redirect events from the file system
 // Returns an error if loading failed
-func (f *FileStorage) LoadJSONfromFS() error {
-	if _, err := f.file.Seek(0, 0); err != nil {
+func (f *FileStorage) loadClicksFromFile() error {
+	if _, err := f.clicksFile.Seek(0, 0); err != nil {
 		return err
 	}
-	scanner := bufio.NewScanner(f.file)
-	data := make(map[Alias]OriginalURL)
+	var clicks []Click
+	scanner := bufio.NewScanner(f.clicksFile)
 	for scanner.Scan() {
-		var urls JSONFS
-		if err := json.Unmarshal(scanner.Bytes(), &urls); err != nil {
+		var click JSONClickFS
+		if err := json.Unmarshal(scanner.Bytes(), &click); err != nil {
 			return err
 		}
-		data[urls.Alias] = urls.URL
+		clicks = append(clicks, Click(click))
 	}
 	if err := scanner.Err(); err != nil {
 		return err
 	}
-	if err := f.SyncMemoryStorage.Add(data); err != nil {
+	return f.SyncMemoryStorage.AddClicks(context.Background(), clicks)
+}
+
+// loadDeleteJobsFromFile loads the last states of delete jobs from the file system
+// Returns an error if loading failed
+func (f *FileStorage) loadDeleteJobsFromFile() error {
+	if _, err := f.jobsFile.Seek(0, 0); err != nil {
 		return err
 	}
-	return nil
+	scanner := bufio.NewScanner(f.jobsFile)
+	for scanner.Scan() {
+		var job JSONDeleteJobFS
+		if err := json.Unmarshal(scanner.Bytes(), &job); err != nil {
+			return err
+		}
+		if err := f.SyncMemoryStorage.SaveDeleteJob(context.Background(), DeleteJob(job)); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
 }
 
-// Add adds new URLs to the file storage
-// ctx is the request context
-// batch is the map of alias -> OriginalURL to add
-// Returns an error if the addition failed
-func (f *FileStorage) Add(ctx context.Context, batch map[Alias]OriginalURL) error {
-	if err := f.SyncMemoryStorage.Add(batch); err != nil {
+// loadAPIKeysFromFile loads the last states of API keys from the file system
+// Returns an error if loading failed
+func (f *FileStorage) loadAPIKeysFromFile() error {
+	if _, err := f.keysFile.Seek(0, 0); err != nil {
 		return err
 	}
+	mem := f.SyncMemoryStorage
+	mem.Mu.Lock()
+	defer mem.Mu.Unlock()
+	scanner := bufio.NewScanner(f.keysFile)
+	for scanner.Scan() {
+		var key JSONAPIKeyFS
+		if err := json.Unmarshal(scanner.Bytes(), &key); err != nil {
+			return err
+		}
+		mem.saveAPIKey(APIKey(key))
+	}
+	return scanner.Err()
+}
+
+// LoadJSONfromFS loads JSON data from the file system
+// Records are replayed in order, so tombstones mark earlier records as deleted
+// Returns an error if loading failed
+func (f *FileStorage) LoadJSONfromFS() error {
+	if _, err := f.file.Seek(0, 0); err != nil {
+		return err
+	}
+	loadedAt := time.Now()
+	scanner := bufio.NewScanner(f.file)
+	for scanner.Scan() {
+		var urls JSONFS
+		if err := json.Unmarshal(scanner.Bytes(), &urls); err != nil {
+			return err
+		}
+		if urls.Reserved {
+			f.SyncMemoryStorage.reserveAliases([]Alias{urls.Alias})
+			continue
+		}
+		if urls.DeletedFlag {
+			// Records written before the deletion time was recorded count as deleted now, like in the database migration
+			deletedAt := loadedAt
+			if urls.DeletedAt != nil {
+				deletedAt = *urls.DeletedAt
+			}
+			f.SyncMemoryStorage.deleteAliases([]Alias{urls.Alias}, deletedAt, urls.Expired)
+			continue
+		}
+		if urls.RestoredAt != nil {
+			f.SyncMemoryStorage.restoreAliases([]Alias{urls.Alias})
+			continue
+		}
+		if urls.EditedAt != nil {
+			f.SyncMemoryStorage.replayEdit(urls.Alias, urls.URL, urls.ExpiresAt, *urls.EditedAt)
+			continue
+		}
+		f.SyncMemoryStorage.addUserURLs(urls.UserID, map[Alias]OriginalURL{urls.Alias: urls.URL}, urls.ExpiresAt)
+	}
+	return scanner.Err()
+}
+
+// appendRecords writes records to the end of the storage file
+// records is the list of records to write
+// Returns an error if writing failed
+func (f *FileStorage) appendRecords(records []JSONFS) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if f.file == nil {
 		return errors.New("file is not opened")
 	}
 
 	writter := bufio.NewWriter(f.file)
-	for alias, url := range batch {
-		entry := JSONFS{
-			UUID:  strconv.Itoa(len(f.SyncMemoryStorage.MemoryStorage.AliasKeysMap)),
-			Alias: alias,
-			URL:   url,
-		}
+	for _, entry := range records {
 		data, err := json.Marshal(entry)
 		if err != nil {
 			return err
@@ -151,26 +311,124 @@ func (f *FileStorage) Add(ctx context.Context, batch map[Alias]OriginalURL) erro
 			return err
 		}
 	}
-	if err := writter.Flush(); err != nil {
+	return writter.Flush()
+}
+
+// Add adds new URLs to the file storage
+// ctx is the request context
+// batch is the map of alias -> OriginalURL to add
+// Returns an error if the addition failed
+func (f *FileStorage) Add(ctx context.Context, batch map[Alias]OriginalURL) error {
+	f.writeMu.RLock()
+	defer f.writeMu.RUnlock()
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	added, taken := f.SyncMemoryStorage.addNew(userID, batch)
+
+	id := strconv.Itoa(f.SyncMemoryStorage.size())
+	records := make([]JSONFS, 0, len(added))
+	for alias, url := range added {
+		records = append(records, JSONFS{
+			UUID:   id,
+			Alias:  alias,
+			URL:    url,
+			UserID: userID,
+		})
+	}
+	if err := f.appendRecords(records); err != nil {
 		return err
 	}
+	if len(taken) > 0 {
+		return fmt.Errorf("%w: %v", ErrAliasTaken, taken)
+	}
 	return nil
 }
 
+// AddOrGet atomically stores URLs that the user has not shortened yet and persists the new ones
+// URLs whose new alias is already taken are left out of the result so that they can be retried with another alias
+// ctx is the request context
+// batch is the map of new alias -> OriginalURL
+// expiresAt is the expiration time of the new URLs, nil if they never expire
+// Returns a map of OriginalURL -> stored alias and ErrConflict if at least one URL already existed
+func (f *FileStorage) AddOrGet(ctx context.Context, batch map[Alias]OriginalURL, expiresAt *time.Time) (map[OriginalURL]Alias, error) {
+	f.writeMu.RLock()
+	defer f.writeMu.RUnlock()
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	result, added, conflict := f.SyncMemoryStorage.addOrGet(userID, batch, expiresAt)
+
+	id := strconv.Itoa(f.SyncMemoryStorage.size())
+	records := make([]JSONFS, 0, len(added))
+	for alias, url := range added {
+		records = append(records, JSONFS{
+			UUID:      id,
+			Alias:     alias,
+			URL:       url,
+			UserID:    userID,
+			ExpiresAt: expiresAt,
+		})
+	}
+	if err := f.appendRecords(records); err != nil {
+		return nil, err
+	}
+
+	if conflict {
+		return result, ErrConflict
+	}
+	return result, nil
+}
+
+// AddCustom atomically stores URLs under aliases chosen by the user and persists them
+// ctx is the request context
+// urls are the URLs with their aliases and expiration times
+// Returns the aliases of URLs the user has already shortened with ErrConflict,
+// or the taken aliases with ErrAliasTaken, nothing is stored in both cases
+func (f *FileStorage) AddCustom(ctx context.Context, urls []CustomURL) (map[OriginalURL]Alias, []Alias, error) {
+	f.writeMu.RLock()
+	defer f.writeMu.RUnlock()
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	existing, taken, err := f.SyncMemoryStorage.addCustom(userID, urls)
+	if err != nil {
+		return existing, taken, err
+	}
+
+	id := strconv.Itoa(f.SyncMemoryStorage.size())
+	records := make([]JSONFS, 0, len(urls))
+	for _, u := range urls {
+		records = append(records, JSONFS{
+			UUID:      id,
+			Alias:     u.Alias,
+			URL:       u.URL,
+			UserID:    userID,
+			ExpiresAt: u.ExpiresAt,
+		})
+	}
+	if err := f.appendRecords(records); err != nil {
+		return nil, nil, err
+	}
+	return nil, nil, nil
+}
+
 // GetURL retrieves the original URL by alias from file storage
 // ctx is the request context
 // alias is the short URL alias
 // Returns the original URL and an error if retrieval failed
 func (f *FileStorage) GetURL(ctx context.Context, alias Alias) (url OriginalURL, err error) {
-	return f.SyncMemoryStorage.GetURL(alias)
+	return f.SyncMemoryStorage.GetURL(ctx, alias)
 }
 
-// GetUserURLs retrieves all URLs for a user from file storage
+// GetURLRecord retrieves the short URL including deleted and expired ones from file storage
+// ctx is the request context
+// alias is the short URL alias
+// Returns the URL record and ErrNotFound if the alias does not exist
+func (f *FileStorage) GetURLRecord(ctx context.Context, alias Alias) (URLRecord, error) {
+	return f.SyncMemoryStorage.GetURLRecord(ctx, alias)
+}
+
+// GetUserURLs retrieves not deleted and expired URLs for a user from file storage
 // ctx is the request context
 // userID is the user identifier
-// Returns a map of alias -> OriginalURL and an error if retrieval failed
-func (f *FileStorage) GetUserURLs(ctx context.Context, userID string) (aliasKeysMap AliasKeysMap, err error) {
-	return nil, fmt.Errorf("can not get user urls from file storage")
+// Returns URLs sorted by alias and an error if retrieval failed
+func (f *FileStorage) GetUserURLs(ctx context.Context, userID string) (urls []URLRecord, err error) {
+	return f.SyncMemoryStorage.GetUserURLs(ctx, userID)
 }
 
 // GetAlias retrieves the alias for a given URL from file storage
@@ -178,16 +436,462 @@ func (f *FileStorage) GetUserURLs(ctx context.Context, userID string) (aliasKeys
 // url is the original URL
 // Returns the alias and an error if retrieval failed
 func (f *FileStorage) GetAlias(ctx context.Context, url OriginalURL) (alias Alias, err error) {
-	return f.SyncMemoryStorage.GetAlias(url)
+	return f.SyncMemoryStorage.GetAlias(ctx, url)
+}
+
+// UpdateUserURL changes the destination or expiration of a user URL and appends the edit record to file storage
+// ctx is the request context
+// userID is the user identifier
+// alias is the short URL alias
+// update is the change to apply
+// Returns the updated URL record and ErrNotFound, ErrNotOwner, ErrExpired, ErrDeleted or ErrConflict if the URL can not be changed
+func (f *FileStorage) UpdateUserURL(ctx context.Context, userID string, alias Alias, update URLUpdate) (URLRecord, error) {
+	f.writeMu.RLock()
+	defer f.writeMu.RUnlock()
+	record, edit, err := f.SyncMemoryStorage.updateUserURL(userID, alias, update, time.Now())
+	if err != nil || edit == nil {
+		return record, err
+	}
+
+	entry := JSONFS{
+		UUID:      strconv.Itoa(f.SyncMemoryStorage.size()),
+		Alias:     alias,
+		URL:       record.URL,
+		UserID:    userID,
+		ExpiresAt: record.ExpiresAt,
+		EditedAt:  &edit.EditedAt,
+	}
+	if err := f.appendRecords([]JSONFS{entry}); err != nil {
+		return URLRecord{}, err
+	}
+	return record, nil
+}
+
+// GetURLHistory retrieves previous states of a short URL from file storage
+// ctx is the request context
+// alias is the short URL alias
+// Returns the previous states, oldest first, and an error if retrieval failed
+func (f *FileStorage) GetURLHistory(ctx context.Context, alias Alias) ([]URLEdit, error) {
+	return f.SyncMemoryStorage.GetURLHistory(ctx, alias)
+}
+
+// DeleteUserURLs marks user URLs as deleted and appends tombstone records to file storage
+// ctx is the request context
+// userID is the user identifier
+// urls is the list of aliases to delete
+// Returns one of DeleteResult* values for every alias and an error if deletion failed
+func (f *FileStorage) DeleteUserURLs(ctx context.Context, userID string, urls []string) (map[string]string, error) {
+	if userID == "" {
+		return nil, ErrUserIDRequired
+	}
+
+	f.writeMu.RLock()
+	defer f.writeMu.RUnlock()
+	now := time.Now()
+	deleted, results := f.SyncMemoryStorage.deleteUserURLs(userID, urls, now)
+	if len(deleted) == 0 {
+		return results, nil
+	}
+
+	id := strconv.Itoa(f.SyncMemoryStorage.size())
+	records := make([]JSONFS, 0, len(deleted))
+	for _, alias := range deleted {
+		records = append(records, JSONFS{
+			UUID:        id,
+			Alias:       alias,
+			UserID:      userID,
+			DeletedFlag: true,
+			DeletedAt:   &now,
+		})
+	}
+	if err := f.appendRecords(records); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// RestoreUserURLs clears the deleted mark of user URLs deleted after the given time and appends restore records to file storage
+// ctx is the request context
+// userID is the user identifier
+// aliases is the list of aliases to restore
+// deletedAfter is the start of the grace period
+// Returns one of RestoreResult* values for every alias and an error if restoration failed
+func (f *FileStorage) RestoreUserURLs(ctx context.Context, userID string, aliases []string, deletedAfter time.Time) (map[string]string, error) {
+	if userID == "" {
+		return nil, ErrUserIDRequired
+	}
+
+	f.writeMu.RLock()
+	defer f.writeMu.RUnlock()
+	now := time.Now()
+	restored, results := f.SyncMemoryStorage.restoreUserURLs(userID, aliases, deletedAfter, now)
+	if len(restored) == 0 {
+		return results, nil
+	}
+
+	id := strconv.Itoa(f.SyncMemoryStorage.size())
+	records := make([]JSONFS, 0, len(restored))
+	for _, alias := range restored {
+		records = append(records, JSONFS{
+			UUID:       id,
+			Alias:      alias,
+			UserID:     userID,
+			RestoredAt: &now,
+		})
+	}
+	if err := f.appendRecords(records); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// DeleteExpiredURLs marks URLs expired at the given time as deleted and appends tombstone records to file storage
+// ctx is the request context
+// now is the current time
+// Returns the number of deleted URLs and an error if deletion failed
+func (f *FileStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (int, error) {
+	f.writeMu.RLock()
+	defer f.writeMu.RUnlock()
+	deleted := f.SyncMemoryStorage.deleteExpired(now)
+	if len(deleted) == 0 {
+		return 0, nil
+	}
+
+	id := strconv.Itoa(f.SyncMemoryStorage.size())
+	records := make([]JSONFS, 0, len(deleted))
+	for _, record := range deleted {
+		records = append(records, JSONFS{
+			UUID:        id,
+			Alias:       record.Alias,
+			UserID:      record.UserID,
+			DeletedFlag: true,
+			DeletedAt:   record.ExpiresAt,
+			Expired:     true,
+		})
+	}
+	if err := f.appendRecords(records); err != nil {
+		return 0, err
+	}
+	return len(deleted), nil
+}
+
+// PurgeDeletedURLs permanently removes URLs deleted before the given time and compacts the storage files
+// ctx is the request context
+// deletedBefore is the time before which deleted URLs are removed
+// releaseAliases allows the aliases to be used again, otherwise they stay reserved
+// Returns the number of removed URLs and an error if removal or compaction failed
+func (f *FileStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, releaseAliases bool) (int, error) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	count := f.SyncMemoryStorage.purgeDeleted(deletedBefore, releaseAliases)
+	if err := f.compact(); err != nil {
+		return count, fmt.Errorf("can not compact file storage: %w", err)
+	}
+	return count, nil
+}
+
+// compact rewrites the URLs, clicks and jobs files with the records of the current state only,
+// superseded job states and records of purged URLs are dropped. The caller must hold writeMu
+// Returns an error if a file could not be rewritten
+func (f *FileStorage) compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	records, clicks, jobs := f.snapshot()
+	if err := rewriteFile(&f.file, f.path, records); err != nil {
+		return err
+	}
+	if err := rewriteFile(&f.clicksFile, f.path+".clicks", clicks); err != nil {
+		return err
+	}
+	return rewriteFile(&f.jobsFile, f.path+".jobs", jobs)
+}
+
+// snapshot returns the records that rebuild the current in-memory state when replayed
+// Returns the URL records, the clicks and the last states of delete jobs
+func (f *FileStorage) snapshot() ([]JSONFS, []JSONClickFS, []JSONDeleteJobFS) {
+	mem := f.SyncMemoryStorage
+	mem.Mu.Lock()
+	defer mem.Mu.Unlock()
+	m := mem.MemoryStorage
+
+	records := make([]JSONFS, 0, len(m.Reserved)+len(m.AliasKeysMap))
+	reserved := make([]Alias, 0, len(m.Reserved))
+	for alias := range m.Reserved {
+		reserved = append(reserved, alias)
+	}
+	sort.Slice(reserved, func(i, j int) bool { return reserved[i] < reserved[j] })
+	for _, alias := range reserved {
+		records = append(records, JSONFS{Alias: alias, Reserved: true})
+	}
+
+	// Deleted aliases go first, so their tombstones do not free the URLs of live aliases
+	aliases := make([]Alias, 0, len(m.AliasKeysMap))
+	for alias := range m.AliasKeysMap {
+		aliases = append(aliases, alias)
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		_, deletedI := m.Deleted[aliases[i]]
+		_, deletedJ := m.Deleted[aliases[j]]
+		if deletedI != deletedJ {
+			return deletedI
+		}
+		return aliases[i] < aliases[j]
+	})
+
+	states := make(map[urlKey]int)
+	for _, alias := range aliases {
+		current := JSONFS{Alias: alias, URL: m.AliasKeysMap[alias], UserID: m.UserIDs[alias]}
+		if expiresAt, ok := m.Expires[alias]; ok {
+			current.ExpiresAt = &expiresAt
+		}
+
+		// The first record holds the oldest state, every edit record holds the state that replaced the previous one
+		history := m.History[alias]
+		first := current
+		if len(history) > 0 {
+			first.URL, first.ExpiresAt = history[0].URL, history[0].ExpiresAt
+		}
+		records = append(records, first)
+		states[urlKey{first.UserID, first.URL}]++
+		for k, edit := range history {
+			next := current
+			if k+1 < len(history) {
+				next.URL, next.ExpiresAt = history[k+1].URL, history[k+1].ExpiresAt
+			}
+			editedAt := edit.EditedAt
+			next.EditedAt = &editedAt
+			records = append(records, next)
+			states[urlKey{next.UserID, next.URL}]++
+		}
+
+		if deletedAt, ok := m.Deleted[alias]; ok {
+			_, expired := m.Expired[alias]
+			records = append(records, JSONFS{Alias: alias, UserID: current.UserID, DeletedFlag: true, DeletedAt: &deletedAt, Expired: expired})
+		}
+	}
+
+	// A URL used by several aliases may be remapped while replaying, restore records map it back to its alias
+	now := time.Now()
+	for key, alias := range m.URLKeysMap {
+		if _, deleted := m.Deleted[alias]; states[key] > 1 && !deleted {
+			records = append(records, JSONFS{Alias: alias, UserID: key.userID, RestoredAt: &now})
+		}
+	}
+	for i := range records {
+		records[i].UUID = strconv.Itoa(i)
+	}
+
+	clicks := make([]JSONClickFS, 0)
+	for _, alias := range aliases {
+		for _, click := range m.Clicks[alias] {
+			clicks = append(clicks, JSONClickFS(click))
+		}
+	}
+
+	jobs := make([]JSONDeleteJobFS, 0, len(m.DeleteJobs))
+	for _, job := range m.DeleteJobs {
+		jobs = append(jobs, JSONDeleteJobFS(job))
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return records, clicks, jobs
 }
 
-// DeleteUserURLs deletes user URLs from file storage
+// rewriteFile replaces the file with the given records through a temporary file and reopens it for appending
+// file is the opened file that is replaced, path is its path
+// records is the list of records to write, one JSON document per line
+// Returns an error if the file could not be replaced, the opened file is kept in this case
+func rewriteFile[T any](file **os.File, path string, records []T) error {
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("can not create temporary file: %w", err)
+	}
+	writer := bufio.NewWriter(tmp)
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err == nil {
+			_, err = writer.Write(append(data, '\n'))
+		}
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmpPath)
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("can not replace file: %w", err)
+	}
+
+	reopened, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("can not reopen file: %w", err)
+	}
+	if *file != nil {
+		_ = (*file).Close()
+	}
+	*file = reopened
+	return nil
+}
+
+// SaveDeleteJob creates or replaces a delete job in memory and appends its state to the jobs file
+// ctx is the request context
+// job is the delete job to save
+// Returns an error if saving failed
+func (f *FileStorage) SaveDeleteJob(ctx context.Context, job DeleteJob) error {
+	data, err := json.Marshal(JSONDeleteJobFS(job))
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.jobsFile == nil {
+		return errors.New("jobs file is not opened")
+	}
+	if _, err := f.jobsFile.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.SyncMemoryStorage.SaveDeleteJob(ctx, job)
+}
+
+// GetPendingDeleteJobs retrieves delete jobs that are not finished yet from file storage
+// ctx is the request context
+// Returns the pending jobs, oldest first, and an error if retrieval failed
+func (f *FileStorage) GetPendingDeleteJobs(ctx context.Context) ([]DeleteJob, error) {
+	return f.SyncMemoryStorage.GetPendingDeleteJobs(ctx)
+}
+
+// GetDeleteJob retrieves a delete job by ID from file storage
+// ctx is the request context
+// id is the job identifier
+// Returns the job and ErrJobNotFound if it does not exist
+func (f *FileStorage) GetDeleteJob(ctx context.Context, id string) (DeleteJob, error) {
+	return f.SyncMemoryStorage.GetDeleteJob(ctx, id)
+}
+
+// CreateAPIKey stores a new API key in memory and appends it to the keys file
+// ctx is the request context
+// key is the API key to store
+// Returns an error if storing failed
+func (f *FileStorage) CreateAPIKey(ctx context.Context, key APIKey) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.appendAPIKey(key); err != nil {
+		return err
+	}
+	return f.SyncMemoryStorage.CreateAPIKey(ctx, key)
+}
+
+// appendAPIKey appends the state of an API key to the keys file, the caller must hold mu
+// key is the API key state
+// Returns an error if writing failed
+func (f *FileStorage) appendAPIKey(key APIKey) error {
+	data, err := json.Marshal(JSONAPIKeyFS(key))
+	if err != nil {
+		return err
+	}
+	if f.keysFile == nil {
+		return errors.New("API keys file is not opened")
+	}
+	_, err = f.keysFile.Write(append(data, '\n'))
+	return err
+}
+
+// GetAPIKeys retrieves API keys of a user from file storage
 // ctx is the request context
 // userID is the user identifier
-// urls is the list of URLs to delete
-// Returns an error if deletion failed
-func (f *FileStorage) DeleteUserURLs(ctx context.Context, userID string, urls []string) error {
-	return fmt.Errorf("can not delete user urls from file storage")
+// Returns the keys including revoked ones, oldest first, and an error if retrieval failed
+func (f *FileStorage) GetAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	return f.SyncMemoryStorage.GetAPIKeys(ctx, userID)
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key from file storage
+// ctx is the request context
+// hash is the hash of the key
+// Returns the key and ErrAPIKeyNotFound if it does not exist
+func (f *FileStorage) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	return f.SyncMemoryStorage.GetAPIKeyByHash(ctx, hash)
+}
+
+// RevokeAPIKey marks an API key of a user as revoked in memory and appends the new state to the keys file
+// ctx is the request context
+// userID is the user identifier
+// id is the key identifier
+// revokedAt is the revocation time, it is ignored for keys revoked before
+// Returns the key and ErrAPIKeyNotFound if it does not exist or belongs to another user
+func (f *FileStorage) RevokeAPIKey(ctx context.Context, userID, id string, revokedAt time.Time) (APIKey, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, err := f.SyncMemoryStorage.RevokeAPIKey(ctx, userID, id, revokedAt)
+	if err != nil {
+		return APIKey{}, err
+	}
+	if err := f.appendAPIKey(key); err != nil {
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+// AddClicks stores redirect events in memory and appends them to the clicks file
+// ctx is the request context
+// clicks is the list of events to store
+// Returns an error if storing failed
+func (f *FileStorage) AddClicks(ctx context.Context, clicks []Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.clicksFile == nil {
+		return errors.New("clicks file is not opened")
+	}
+
+	writer := bufio.NewWriter(f.clicksFile)
+	for _, click := range clicks {
+		data, err := json.Marshal(JSONClickFS(click))
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(data); err != nil {
+			return err
+		}
+		if err := writer.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return f.SyncMemoryStorage.AddClicks(ctx, clicks)
+}
+
+// GetClickStats aggregates redirect events of a short URL from file storage
+// ctx is the request context
+// alias is the short URL alias
+// Returns the statistics and an error if aggregation failed
+func (f *FileStorage) GetClickStats(ctx context.Context, alias Alias) (ClickStats, error) {
+	return f.SyncMemoryStorage.GetClickStats(ctx, alias)
 }
 
 // CloseStorage closes the file storage
@@ -205,6 +909,21 @@ func (f *FileStorage) CloseStorage(ctx context.Context) error {
 			firstErr = err
 		}
 	}
+	if f.clicksFile != nil {
+		if err := f.clicksFile.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if f.jobsFile != nil {
+		if err := f.jobsFile.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if f.keysFile != nil {
+		if err := f.keysFile.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
 	return firstErr
 }
 
@@ -218,25 +937,28 @@ func (f *FileStorage) PingStorage(ctx context.Context) error { return nil }
 // login is the user login
 // Returns the user and an error if retrieval failed
 func (f *FileStorage) GetUserByLogin(ctx context.Context, login string) (user *User, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	if user, exists := f.users[login]; exists {
 		return user, nil
 	}
-	return nil, fmt.Errorf("user not found for login: %s", login)
+	return nil, fmt.Errorf("%w for login: %s", ErrUserNotFound, login)
 }
 
 // CreateUser creates a new user in file storage
+// The user is appended to the users file before it becomes visible, so a failed write does not register it
 // ctx is the request context
 // user is the user to create
 // Returns an error if creation failed
 func (f *FileStorage) CreateUser(ctx context.Context, user *User) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	// Check if user already exists
 	if _, exists := f.users[user.Login]; exists {
-		return fmt.Errorf("user already exists with login: %s", user.Login)
+		return fmt.Errorf("%w with login: %s", ErrUserExists, user.Login)
 	}
 
-	// Add to memory map
-	f.users[user.Login] = user
-
 	// Write to file
 	if f.usersFile == nil {
 		return errors.New("users file is not opened")
@@ -252,17 +974,11 @@ func (f *FileStorage) CreateUser(ctx context.Context, user *User) error {
 	if err != nil {
 		return err
 	}
-
-	writer := bufio.NewWriter(f.usersFile)
-	if _, err := writer.Write(data); err != nil {
-		return err
-	}
-	if err := writer.WriteByte('\n'); err != nil {
-		return err
-	}
-	if err := writer.Flush(); err != nil {
+	if _, err := f.usersFile.Write(append(data, '\n')); err != nil {
 		return err
 	}
 
+	// Add to memory map
+	f.users[user.Login] = user
 	return nil
 }
@@ -4,24 +4,45 @@ package storage
 import (
 	"context"
 	"fmt"
-	"log"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"go.uber.org/zap"
 )
 
 // AliasKeysMap is a map of alias to original URL
 type AliasKeysMap map[Alias]OriginalURL
 
-// urlKeysMap is a map of original URL to alias
-type urlKeysMap map[OriginalURL]Alias
+// urlKey identifies an original URL shortened by a user
+type urlKey struct {
+	userID string
+	url    OriginalURL
+}
+
+// urlKeysMap is a map of user's original URL to alias
+type urlKeysMap map[urlKey]Alias
 
 // MemoryStorage represents in-memory storage
 type MemoryStorage struct {
 	AliasKeysMap AliasKeysMap
 	URLKeysMap   urlKeysMap
-	Users        map[string]*User // login -> user
+	UserIDs      map[Alias]string     // alias -> owner user ID
+	Deleted      map[Alias]time.Time  // soft-deleted alias -> deletion time
+	Expired      map[Alias]struct{}   // aliases deleted by the expiry sweeper
+	Expires      map[Alias]time.Time  // alias -> expiration time
+	Clicks       map[Alias][]Click    // alias -> redirect events
+	History      map[Alias][]URLEdit  // alias -> previous states, oldest first
+	DeleteJobs   map[string]DeleteJob // job ID -> delete job
+	APIKeys      map[string]APIKey    // key ID -> API key
+	APIKeyHashes map[string]string    // key hash -> key ID
+	Reserved     map[Alias]struct{}   // purged aliases that can not be used again
+	Users        map[string]*User     // login -> user
 }
 
 // SyncMemoryStorage represents thread-safe in-memory storage
+// It implements the Storage interface and is also used as a cache by FileStorage
 type SyncMemoryStorage struct {
 	Mu            sync.Mutex
 	MemoryStorage *MemoryStorage
@@ -33,53 +54,814 @@ func NewMemoryStorage() *SyncMemoryStorage {
 		Mu: sync.Mutex{},
 		MemoryStorage: &MemoryStorage{
 			AliasKeysMap: make(map[Alias]OriginalURL),
-			URLKeysMap:   make(map[OriginalURL]Alias),
+			URLKeysMap:   make(urlKeysMap),
+			UserIDs:      make(map[Alias]string),
+			Deleted:      make(map[Alias]time.Time),
+			Expired:      make(map[Alias]struct{}),
+			Expires:      make(map[Alias]time.Time),
+			Clicks:       make(map[Alias][]Click),
+			History:      make(map[Alias][]URLEdit),
+			DeleteJobs:   make(map[string]DeleteJob),
+			APIKeys:      make(map[string]APIKey),
+			APIKeyHashes: make(map[string]string),
+			Reserved:     make(map[Alias]struct{}),
 			Users:        make(map[string]*User),
 		},
 	}
 }
 
 // Add adds new URLs to the in-memory storage
+// ctx is the request context
 // batch is the map of alias -> OriginalURL to add
 // Returns an error if the addition failed
-func (s *SyncMemoryStorage) Add(batch map[Alias]OriginalURL) error {
+func (s *SyncMemoryStorage) Add(ctx context.Context, batch map[Alias]OriginalURL) error {
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	_, taken := s.addNew(userID, batch)
+	if len(taken) > 0 {
+		return fmt.Errorf("%w: %v", ErrAliasTaken, taken)
+	}
+	return nil
+}
+
+// addNew adds URLs whose aliases are not taken yet, existing aliases are never overwritten
+// userID is the owner user identifier, empty for anonymous URLs
+// batch is the map of alias -> OriginalURL to add
+// Returns the actually added aliases and the aliases that were already taken
+func (s *SyncMemoryStorage) addNew(userID string, batch map[Alias]OriginalURL) (map[Alias]OriginalURL, []Alias) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	added := make(map[Alias]OriginalURL, len(batch))
+	var taken []Alias
+	for alias, url := range batch {
+		if s.taken(alias) {
+			taken = append(taken, alias)
+			continue
+		}
+		s.store(userID, alias, url, nil)
+		added[alias] = url
+	}
+	return added, taken
+}
+
+// addUserURLs adds URLs owned by a user, replacing existing aliases
+// It is used to replay the file storage log
+// userID is the owner user identifier, empty for anonymous URLs
+// batch is the map of alias -> OriginalURL to add
+// expiresAt is the expiration time of the URLs, nil if they never expire
+func (s *SyncMemoryStorage) addUserURLs(userID string, batch map[Alias]OriginalURL, expiresAt *time.Time) {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 	for k, v := range batch {
-		s.MemoryStorage.AliasKeysMap[k] = v
-		s.MemoryStorage.URLKeysMap[v] = k
+		s.store(userID, k, v, expiresAt)
 	}
-	return nil
+}
+
+// store saves a single alias, the caller must hold the lock
+func (s *SyncMemoryStorage) store(userID string, alias Alias, url OriginalURL, expiresAt *time.Time) {
+	s.MemoryStorage.AliasKeysMap[alias] = url
+	s.MemoryStorage.URLKeysMap[urlKey{userID, url}] = alias
+	delete(s.MemoryStorage.Deleted, alias)
+	delete(s.MemoryStorage.Expired, alias)
+	if userID != "" {
+		s.MemoryStorage.UserIDs[alias] = userID
+	} else {
+		delete(s.MemoryStorage.UserIDs, alias)
+	}
+	if expiresAt != nil {
+		s.MemoryStorage.Expires[alias] = *expiresAt
+	} else {
+		delete(s.MemoryStorage.Expires, alias)
+	}
+}
+
+// taken reports whether the alias is used or reserved, the caller must hold the lock
+func (s *SyncMemoryStorage) taken(alias Alias) bool {
+	if _, ok := s.MemoryStorage.AliasKeysMap[alias]; ok {
+		return true
+	}
+	_, reserved := s.MemoryStorage.Reserved[alias]
+	return reserved
+}
+
+// expired reports whether the alias is expired at the given time, the caller must hold the lock
+func (s *SyncMemoryStorage) expired(alias Alias, now time.Time) bool {
+	expiresAt, ok := s.MemoryStorage.Expires[alias]
+	return ok && !expiresAt.After(now)
+}
+
+// markDeleted marks the alias as deleted and frees its URL for the owner, the caller must hold the lock
+// at is the deletion time
+// Returns false if the alias does not exist or is already deleted
+func (s *SyncMemoryStorage) markDeleted(alias Alias, at time.Time) bool {
+	url, ok := s.MemoryStorage.AliasKeysMap[alias]
+	if !ok {
+		return false
+	}
+	if _, ok := s.MemoryStorage.Deleted[alias]; ok {
+		return false
+	}
+	s.MemoryStorage.Deleted[alias] = at
+	key := urlKey{s.MemoryStorage.UserIDs[alias], url}
+	if s.MemoryStorage.URLKeysMap[key] == alias {
+		delete(s.MemoryStorage.URLKeysMap, key)
+	}
+	return true
+}
+
+// deleteAliases marks aliases as deleted regardless of the owner
+// It is used to replay tombstones of the file storage log
+// aliases is the list of aliases to delete
+// at is the deletion time
+// expired marks the aliases as deleted by the expiry sweeper
+func (s *SyncMemoryStorage) deleteAliases(aliases []Alias, at time.Time, expired bool) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	for _, alias := range aliases {
+		if s.markDeleted(alias, at) && expired {
+			s.MemoryStorage.Expired[alias] = struct{}{}
+		}
+	}
+}
+
+// listed reports whether a user URL is shown in the user URLs list, the caller must hold the lock
+// Expired URLs are listed even after the sweeper marked them as deleted, URLs deleted by the user are not
+func (s *SyncMemoryStorage) listed(alias Alias) bool {
+	if _, deleted := s.MemoryStorage.Deleted[alias]; !deleted {
+		return true
+	}
+	_, expired := s.MemoryStorage.Expired[alias]
+	return expired
+}
+
+// AddOrGet atomically stores URLs that the user has not shortened yet
+// URLs whose new alias is already taken are left out of the result so that they can be retried with another alias
+// ctx is the request context
+// batch is the map of new alias -> OriginalURL
+// expiresAt is the expiration time of the new URLs, nil if they never expire
+// Returns a map of OriginalURL -> stored alias and ErrConflict if at least one URL already existed
+func (s *SyncMemoryStorage) AddOrGet(ctx context.Context, batch map[Alias]OriginalURL, expiresAt *time.Time) (map[OriginalURL]Alias, error) {
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	result, _, conflict := s.addOrGet(userID, batch, expiresAt)
+	if conflict {
+		return result, ErrConflict
+	}
+	return result, nil
+}
+
+// addOrGet stores URLs that the user has not shortened yet while holding the lock
+// An expired URL does not prevent the user from shortening it again
+// userID is the owner user identifier, empty for anonymous URLs
+// batch is the map of new alias -> OriginalURL
+// expiresAt is the expiration time of the new URLs, nil if they never expire
+// Returns a map of OriginalURL -> stored alias, the actually added aliases and whether any URL already existed
+func (s *SyncMemoryStorage) addOrGet(userID string, batch map[Alias]OriginalURL, expiresAt *time.Time) (map[OriginalURL]Alias, map[Alias]OriginalURL, bool) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	now := time.Now()
+	result := make(map[OriginalURL]Alias, len(batch))
+	added := make(map[Alias]OriginalURL, len(batch))
+	conflict := false
+	for alias, url := range batch {
+		if existing, ok := s.MemoryStorage.URLKeysMap[urlKey{userID, url}]; ok && !s.expired(existing, now) {
+			if _, isNew := added[existing]; !isNew {
+				conflict = true
+			}
+			result[url] = existing
+			continue
+		}
+		if s.taken(alias) {
+			continue
+		}
+		s.store(userID, alias, url, expiresAt)
+		added[alias] = url
+		result[url] = alias
+	}
+	return result, added, conflict
+}
+
+// AddCustom atomically stores URLs under aliases chosen by the user in in-memory storage
+// ctx is the request context
+// urls are the URLs with their aliases and expiration times
+// Returns the aliases of URLs the user has already shortened with ErrConflict,
+// or the taken aliases with ErrAliasTaken, nothing is stored in both cases
+func (s *SyncMemoryStorage) AddCustom(ctx context.Context, urls []CustomURL) (map[OriginalURL]Alias, []Alias, error) {
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
+	return s.addCustom(userID, urls)
+}
+
+// addCustom stores URLs under aliases chosen by the user while holding the lock, all or none of them
+// An expired URL does not prevent the user from shortening it again
+// userID is the owner user identifier, empty for anonymous URLs
+// urls are the URLs with their aliases and expiration times
+// Returns the aliases of URLs the user has already shortened with ErrConflict,
+// or the taken aliases with ErrAliasTaken
+func (s *SyncMemoryStorage) addCustom(userID string, urls []CustomURL) (map[OriginalURL]Alias, []Alias, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	now := time.Now()
+	existing := make(map[OriginalURL]Alias)
+	for _, u := range urls {
+		if alias, ok := s.MemoryStorage.URLKeysMap[urlKey{userID, u.URL}]; ok && !s.expired(alias, now) {
+			existing[u.URL] = alias
+		}
+	}
+	if len(existing) > 0 {
+		return existing, nil, ErrConflict
+	}
+
+	var taken []Alias
+	for _, u := range urls {
+		if s.taken(u.Alias) {
+			taken = append(taken, u.Alias)
+		}
+	}
+	if len(taken) > 0 {
+		sort.Slice(taken, func(i, j int) bool {
+			return taken[i] < taken[j]
+		})
+		return nil, taken, fmt.Errorf("%w: %v", ErrAliasTaken, taken)
+	}
+
+	for _, u := range urls {
+		s.store(userID, u.Alias, u.URL, u.ExpiresAt)
+	}
+	return nil, nil, nil
+}
+
+// size returns the number of stored aliases
+func (s *SyncMemoryStorage) size() int {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	return len(s.MemoryStorage.AliasKeysMap)
 }
 
 // GetURL retrieves the original URL by alias from in-memory storage
+// ctx is the request context
 // alias is the short URL alias
 // Returns the original URL and an error if retrieval failed
-func (s *SyncMemoryStorage) GetURL(alias Alias) (url OriginalURL, err error) {
+func (s *SyncMemoryStorage) GetURL(ctx context.Context, alias Alias) (url OriginalURL, err error) {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
 	if url, ok := s.MemoryStorage.AliasKeysMap[alias]; !ok {
-		log.Println("URL by alias " + alias + " is not exists")
+		middleware.Logger(ctx).Debug("URL by alias is not exists", zap.String("alias", string(alias)))
 		return "", fmt.Errorf("url by alias %s is not exists", alias)
+	} else if s.expired(alias, time.Now()) {
+		return "", ErrExpired
+	} else if _, deleted := s.MemoryStorage.Deleted[alias]; deleted {
+		return "", ErrDeleted
 	} else {
 		return url, nil
 	}
 }
 
+// GetURLRecord retrieves the short URL including deleted and expired ones from in-memory storage
+// ctx is the request context
+// alias is the short URL alias
+// Returns the URL record and ErrNotFound if the alias does not exist
+func (s *SyncMemoryStorage) GetURLRecord(ctx context.Context, alias Alias) (URLRecord, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	url, ok := s.MemoryStorage.AliasKeysMap[alias]
+	if !ok {
+		return URLRecord{}, ErrNotFound
+	}
+	record := URLRecord{Alias: alias, URL: url, UserID: s.MemoryStorage.UserIDs[alias]}
+	if expiresAt, ok := s.MemoryStorage.Expires[alias]; ok {
+		record.ExpiresAt = &expiresAt
+	}
+	return record, nil
+}
+
 // GetAlias retrieves the alias for a given URL from in-memory storage
+// ctx is the request context
 // url is the original URL
 // Returns the alias and an error if retrieval failed
-func (s *SyncMemoryStorage) GetAlias(url OriginalURL) (alias Alias, err error) {
+func (s *SyncMemoryStorage) GetAlias(ctx context.Context, url OriginalURL) (alias Alias, err error) {
+	userID, _ := ctx.Value(middleware.UserIDKey).(string)
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
-	if alias, ok := s.MemoryStorage.URLKeysMap[url]; !ok {
-		log.Println("Alias by URL " + url + " is not exists")
+	if alias, ok := s.MemoryStorage.URLKeysMap[urlKey{userID, url}]; !ok {
+		middleware.Logger(ctx).Debug("Alias by URL is not exists", zap.String("url", string(url)))
 		return "", fmt.Errorf("alias by URL %s is not exists", url)
 	} else {
 		return alias, nil
 	}
 }
 
+// GetUserURLs retrieves not deleted and expired URLs owned by a user from in-memory storage
+// ctx is the request context
+// userID is the user identifier
+// Returns URLs sorted by alias and an error if retrieval failed
+func (s *SyncMemoryStorage) GetUserURLs(ctx context.Context, userID string) (urls []URLRecord, err error) {
+	if userID == "" {
+		return nil, ErrUserIDRequired
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	result := make([]URLRecord, 0)
+	for alias, owner := range s.MemoryStorage.UserIDs {
+		if owner != userID || !s.listed(alias) {
+			continue
+		}
+		record := URLRecord{Alias: alias, URL: s.MemoryStorage.AliasKeysMap[alias], UserID: owner}
+		if expiresAt, ok := s.MemoryStorage.Expires[alias]; ok {
+			record.ExpiresAt = &expiresAt
+		}
+		result = append(result, record)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Alias < result[j].Alias
+	})
+	return result, nil
+}
+
+// UpdateUserURL changes the destination or expiration of a user URL in in-memory storage
+// ctx is the request context
+// userID is the user identifier
+// alias is the short URL alias
+// update is the change to apply
+// Returns the updated URL record and ErrNotFound, ErrNotOwner, ErrExpired, ErrDeleted or ErrConflict if the URL can not be changed
+func (s *SyncMemoryStorage) UpdateUserURL(ctx context.Context, userID string, alias Alias, update URLUpdate) (URLRecord, error) {
+	record, _, err := s.updateUserURL(userID, alias, update, time.Now())
+	return record, err
+}
+
+// updateUserURL changes a user URL and records its previous state
+// userID is the user identifier
+// alias is the short URL alias
+// update is the change to apply
+// now is the edit time
+// Returns the updated URL record, the recorded previous state, nil if nothing changed, and an error if the URL can not be changed
+func (s *SyncMemoryStorage) updateUserURL(userID string, alias Alias, update URLUpdate, now time.Time) (URLRecord, *URLEdit, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	url, ok := s.MemoryStorage.AliasKeysMap[alias]
+	if !ok {
+		return URLRecord{}, nil, ErrNotFound
+	}
+	if userID == "" || s.MemoryStorage.UserIDs[alias] != userID {
+		return URLRecord{}, nil, ErrNotOwner
+	}
+	if s.expired(alias, now) {
+		return URLRecord{}, nil, ErrExpired
+	}
+	if _, deleted := s.MemoryStorage.Deleted[alias]; deleted {
+		return URLRecord{}, nil, ErrDeleted
+	}
+
+	record := URLRecord{Alias: alias, URL: url, UserID: userID}
+	if expiresAt, ok := s.MemoryStorage.Expires[alias]; ok {
+		record.ExpiresAt = &expiresAt
+	}
+	updated := update.apply(record)
+	if updated.URL == record.URL && sameTime(updated.ExpiresAt, record.ExpiresAt) {
+		return record, nil, nil
+	}
+	if updated.URL != record.URL {
+		existing, ok := s.MemoryStorage.URLKeysMap[urlKey{userID, updated.URL}]
+		if ok && !s.expired(existing, now) {
+			return URLRecord{}, nil, ErrConflict
+		}
+	}
+
+	edit := URLEdit{URL: record.URL, ExpiresAt: record.ExpiresAt, EditedAt: now}
+	s.edit(alias, updated.URL, updated.ExpiresAt, edit)
+	return updated, &edit, nil
+}
+
+// replayEdit applies an edit of a URL
+// It is used to replay the file storage log
+// alias is the short URL alias
+// url is the new destination
+// expiresAt is the new expiration time, nil if the URL never expires
+// editedAt is the edit time
+func (s *SyncMemoryStorage) replayEdit(alias Alias, url OriginalURL, expiresAt *time.Time, editedAt time.Time) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	previous, ok := s.MemoryStorage.AliasKeysMap[alias]
+	if !ok {
+		return
+	}
+	edit := URLEdit{URL: previous, EditedAt: editedAt}
+	if previousExpiresAt, ok := s.MemoryStorage.Expires[alias]; ok {
+		edit.ExpiresAt = &previousExpiresAt
+	}
+	s.edit(alias, url, expiresAt, edit)
+}
+
+// edit replaces the state of an existing alias and appends the previous state to the history, the caller must hold the lock
+func (s *SyncMemoryStorage) edit(alias Alias, url OriginalURL, expiresAt *time.Time, previous URLEdit) {
+	userID := s.MemoryStorage.UserIDs[alias]
+	key := urlKey{userID, previous.URL}
+	if s.MemoryStorage.URLKeysMap[key] == alias {
+		delete(s.MemoryStorage.URLKeysMap, key)
+	}
+	s.MemoryStorage.History[alias] = append(s.MemoryStorage.History[alias], previous)
+	s.store(userID, alias, url, expiresAt)
+}
+
+// GetURLHistory retrieves previous states of a short URL from in-memory storage
+// ctx is the request context
+// alias is the short URL alias
+// Returns the previous states, oldest first, and an error if retrieval failed
+func (s *SyncMemoryStorage) GetURLHistory(ctx context.Context, alias Alias) ([]URLEdit, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	history := s.MemoryStorage.History[alias]
+	result := make([]URLEdit, len(history))
+	copy(result, history)
+	return result, nil
+}
+
+// DeleteUserURLs marks URLs owned by a user as deleted in in-memory storage
+// ctx is the request context
+// userID is the user identifier
+// urls is the list of aliases to delete
+// Returns one of DeleteResult* values for every alias and an error if deletion failed
+func (s *SyncMemoryStorage) DeleteUserURLs(ctx context.Context, userID string, urls []string) (map[string]string, error) {
+	if userID == "" {
+		return nil, ErrUserIDRequired
+	}
+	_, results := s.deleteUserURLs(userID, urls, time.Now())
+	return results, nil
+}
+
+// deleteUserURLs marks URLs owned by a user as deleted
+// userID is the user identifier
+// aliases is the list of aliases to delete
+// at is the deletion time
+// Returns the aliases that were actually marked as deleted and one of DeleteResult* values for every alias
+func (s *SyncMemoryStorage) deleteUserURLs(userID string, aliases []string, at time.Time) ([]Alias, map[string]string) {
+	if userID == "" {
+		return nil, nil
+	}
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	deleted := make([]Alias, 0, len(aliases))
+	results := make(map[string]string, len(aliases))
+	for _, a := range aliases {
+		alias := Alias(a)
+		_, exists := s.MemoryStorage.AliasKeysMap[alias]
+		switch {
+		case !exists:
+			results[a] = DeleteResultNotFound
+		case s.MemoryStorage.UserIDs[alias] != userID:
+			results[a] = DeleteResultNotOwner
+		case s.markDeleted(alias, at):
+			results[a] = DeleteResultDeleted
+			deleted = append(deleted, alias)
+		case results[a] == "":
+			results[a] = DeleteResultAlreadyDeleted
+		}
+	}
+	return deleted, results
+}
+
+// RestoreUserURLs clears the deleted mark of user URLs deleted after the given time in in-memory storage
+// ctx is the request context
+// userID is the user identifier
+// aliases is the list of aliases to restore
+// deletedAfter is the start of the grace period
+// Returns one of RestoreResult* values for every alias and an error if restoration failed
+func (s *SyncMemoryStorage) RestoreUserURLs(ctx context.Context, userID string, aliases []string, deletedAfter time.Time) (map[string]string, error) {
+	if userID == "" {
+		return nil, ErrUserIDRequired
+	}
+	_, results := s.restoreUserURLs(userID, aliases, deletedAfter, time.Now())
+	return results, nil
+}
+
+// restoreUserURLs clears the deleted mark of user URLs deleted after the given time
+// userID is the user identifier
+// aliases is the list of aliases to restore
+// deletedAfter is the start of the grace period
+// now is the current time
+// Returns the aliases that were actually restored and one of RestoreResult* values for every alias
+func (s *SyncMemoryStorage) restoreUserURLs(userID string, aliases []string, deletedAfter, now time.Time) ([]Alias, map[string]string) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	restored := make([]Alias, 0, len(aliases))
+	results := make(map[string]string, len(aliases))
+	for _, a := range aliases {
+		if results[a] != "" {
+			continue
+		}
+		alias := Alias(a)
+		url, ok := s.MemoryStorage.AliasKeysMap[alias]
+		if !ok {
+			results[a] = RestoreResultNotFound
+			continue
+		}
+		record := URLRecord{Alias: alias, URL: url, UserID: s.MemoryStorage.UserIDs[alias]}
+		if expiresAt, ok := s.MemoryStorage.Expires[alias]; ok {
+			record.ExpiresAt = &expiresAt
+		}
+		var deletedAt *time.Time
+		if at, ok := s.MemoryStorage.Deleted[alias]; ok {
+			deletedAt = &at
+		}
+		results[a] = restoreResult(record, userID, deletedAt, deletedAfter, now)
+		if results[a] != RestoreResultRestored {
+			continue
+		}
+		if existing, ok := s.MemoryStorage.URLKeysMap[urlKey{userID, url}]; ok && !s.expired(existing, now) {
+			results[a] = RestoreResultConflict
+			continue
+		}
+		s.unmarkDeleted(alias)
+		restored = append(restored, alias)
+	}
+	return restored, results
+}
+
+// restoreAliases clears the deleted mark of aliases regardless of the owner
+// It is used to replay restore records of the file storage log
+// aliases is the list of aliases to restore
+func (s *SyncMemoryStorage) restoreAliases(aliases []Alias) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	for _, alias := range aliases {
+		s.unmarkDeleted(alias)
+	}
+}
+
+// unmarkDeleted clears the deleted mark of the alias and takes its URL for the owner again, the caller must hold the lock
+func (s *SyncMemoryStorage) unmarkDeleted(alias Alias) {
+	url, ok := s.MemoryStorage.AliasKeysMap[alias]
+	if !ok {
+		return
+	}
+	delete(s.MemoryStorage.Deleted, alias)
+	delete(s.MemoryStorage.Expired, alias)
+	s.MemoryStorage.URLKeysMap[urlKey{s.MemoryStorage.UserIDs[alias], url}] = alias
+}
+
+// DeleteExpiredURLs marks URLs expired at the given time as deleted in in-memory storage
+// ctx is the request context
+// now is the current time
+// Returns the number of deleted URLs and an error if deletion failed
+func (s *SyncMemoryStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (int, error) {
+	return len(s.deleteExpired(now)), nil
+}
+
+// deleteExpired marks URLs expired at the given time as deleted as of their expiration time
+// now is the current time
+// Returns the URLs that were actually marked as deleted
+func (s *SyncMemoryStorage) deleteExpired(now time.Time) []URLRecord {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	var deleted []URLRecord
+	for alias, expiresAt := range s.MemoryStorage.Expires {
+		if s.expired(alias, now) && s.markDeleted(alias, expiresAt) {
+			s.MemoryStorage.Expired[alias] = struct{}{}
+			deleted = append(deleted, URLRecord{
+				Alias:     alias,
+				URL:       s.MemoryStorage.AliasKeysMap[alias],
+				UserID:    s.MemoryStorage.UserIDs[alias],
+				ExpiresAt: &expiresAt,
+			})
+		}
+	}
+	return deleted
+}
+
+// PurgeDeletedURLs permanently removes URLs deleted before the given time from in-memory storage
+// ctx is the request context
+// deletedBefore is the time before which deleted URLs are removed
+// releaseAliases allows the aliases to be used again, otherwise they stay reserved
+// Returns the number of removed URLs and an error if removal failed
+func (s *SyncMemoryStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, releaseAliases bool) (int, error) {
+	return s.purgeDeleted(deletedBefore, releaseAliases), nil
+}
+
+// purgeDeleted removes URLs deleted before the given time together with their clicks and edit history
+// deletedBefore is the time before which deleted URLs are removed
+// releaseAliases allows the aliases to be used again, otherwise they stay reserved
+// Returns the number of removed URLs
+func (s *SyncMemoryStorage) purgeDeleted(deletedBefore time.Time, releaseAliases bool) int {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	count := 0
+	for alias, deletedAt := range s.MemoryStorage.Deleted {
+		if !deletedAt.Before(deletedBefore) {
+			continue
+		}
+		key := urlKey{s.MemoryStorage.UserIDs[alias], s.MemoryStorage.AliasKeysMap[alias]}
+		if s.MemoryStorage.URLKeysMap[key] == alias {
+			delete(s.MemoryStorage.URLKeysMap, key)
+		}
+		delete(s.MemoryStorage.AliasKeysMap, alias)
+		delete(s.MemoryStorage.UserIDs, alias)
+		delete(s.MemoryStorage.Deleted, alias)
+		delete(s.MemoryStorage.Expired, alias)
+		delete(s.MemoryStorage.Expires, alias)
+		delete(s.MemoryStorage.Clicks, alias)
+		delete(s.MemoryStorage.History, alias)
+		if !releaseAliases {
+			s.MemoryStorage.Reserved[alias] = struct{}{}
+		}
+		count++
+	}
+	return count
+}
+
+// reserveAliases marks aliases as reserved
+// It is used to replay the file storage log
+// aliases is the list of aliases to reserve
+func (s *SyncMemoryStorage) reserveAliases(aliases []Alias) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	for _, alias := range aliases {
+		s.MemoryStorage.Reserved[alias] = struct{}{}
+	}
+}
+
+// SaveDeleteJob creates or replaces a delete job in in-memory storage
+// ctx is the request context
+// job is the delete job to save
+// Returns an error if saving failed
+func (s *SyncMemoryStorage) SaveDeleteJob(ctx context.Context, job DeleteJob) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	job.Aliases = append([]string(nil), job.Aliases...)
+	job.Results = copyResults(job.Results)
+	s.MemoryStorage.DeleteJobs[job.ID] = job
+	return nil
+}
+
+// GetPendingDeleteJobs retrieves delete jobs that are not finished yet from in-memory storage
+// ctx is the request context
+// Returns the pending jobs, oldest first, and an error if retrieval failed
+func (s *SyncMemoryStorage) GetPendingDeleteJobs(ctx context.Context) ([]DeleteJob, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	result := make([]DeleteJob, 0)
+	for _, job := range s.MemoryStorage.DeleteJobs {
+		if job.Status == DeleteJobPending {
+			job.Aliases = append([]string(nil), job.Aliases...)
+			job.Results = copyResults(job.Results)
+			result = append(result, job)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// GetDeleteJob retrieves a delete job by ID from in-memory storage
+// ctx is the request context
+// id is the job identifier
+// Returns the job and ErrJobNotFound if it does not exist
+func (s *SyncMemoryStorage) GetDeleteJob(ctx context.Context, id string) (DeleteJob, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	job, ok := s.MemoryStorage.DeleteJobs[id]
+	if !ok {
+		return DeleteJob{}, ErrJobNotFound
+	}
+	job.Aliases = append([]string(nil), job.Aliases...)
+	job.Results = copyResults(job.Results)
+	return job, nil
+}
+
+// copyResults returns a copy of per-alias results
+func copyResults(results map[string]string) map[string]string {
+	if results == nil {
+		return nil
+	}
+	c := make(map[string]string, len(results))
+	for alias, result := range results {
+		c[alias] = result
+	}
+	return c
+}
+
+// AddClicks stores redirect events in in-memory storage
+// ctx is the request context
+// clicks is the list of events to store
+// Returns an error if storing failed
+func (s *SyncMemoryStorage) AddClicks(ctx context.Context, clicks []Click) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	for _, c := range clicks {
+		s.MemoryStorage.Clicks[c.Alias] = append(s.MemoryStorage.Clicks[c.Alias], c)
+	}
+	return nil
+}
+
+// GetClickStats aggregates redirect events of a short URL from in-memory storage
+// ctx is the request context
+// alias is the short URL alias
+// Returns the statistics and an error if aggregation failed
+func (s *SyncMemoryStorage) GetClickStats(ctx context.Context, alias Alias) (ClickStats, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	clicks := s.MemoryStorage.Clicks[alias]
+
+	stats := ClickStats{Total: len(clicks), Daily: make([]DailyClicks, 0)}
+	visitors := make(map[[2]string]struct{})
+	daily := make(map[string]int)
+	for _, c := range clicks {
+		visitors[[2]string{c.IP, c.UserAgent}] = struct{}{}
+		daily[c.Time.UTC().Format(time.DateOnly)]++
+	}
+	stats.UniqueVisitors = len(visitors)
+	for date, count := range daily {
+		stats.Daily = append(stats.Daily, DailyClicks{Date: date, Clicks: count})
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool {
+		return stats.Daily[i].Date < stats.Daily[j].Date
+	})
+	return stats, nil
+}
+
+// CreateAPIKey stores a new API key in in-memory storage
+// ctx is the request context
+// key is the API key to store
+// Returns an error if storing failed
+func (s *SyncMemoryStorage) CreateAPIKey(ctx context.Context, key APIKey) error {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	if _, exists := s.MemoryStorage.APIKeys[key.ID]; exists {
+		return fmt.Errorf("api key already exists with ID: %s", key.ID)
+	}
+	s.saveAPIKey(key)
+	return nil
+}
+
+// saveAPIKey creates or replaces an API key, the caller must hold Mu
+// It is also used to replay the file storage log
+// key is the API key to save
+func (s *SyncMemoryStorage) saveAPIKey(key APIKey) {
+	key.Scopes = append([]string(nil), key.Scopes...)
+	s.MemoryStorage.APIKeys[key.ID] = key
+	s.MemoryStorage.APIKeyHashes[key.Hash] = key.ID
+}
+
+// GetAPIKeys retrieves API keys of a user from in-memory storage
+// ctx is the request context
+// userID is the user identifier
+// Returns the keys including revoked ones, oldest first, and an error if retrieval failed
+func (s *SyncMemoryStorage) GetAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	result := make([]APIKey, 0)
+	for _, key := range s.MemoryStorage.APIKeys {
+		if key.UserID == userID {
+			key.Scopes = append([]string(nil), key.Scopes...)
+			result = append(result, key)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.Before(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key from in-memory storage
+// ctx is the request context
+// hash is the hash of the key
+// Returns the key and ErrAPIKeyNotFound if it does not exist
+func (s *SyncMemoryStorage) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	key, ok := s.MemoryStorage.APIKeys[s.MemoryStorage.APIKeyHashes[hash]]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	key.Scopes = append([]string(nil), key.Scopes...)
+	return key, nil
+}
+
+// RevokeAPIKey marks an API key of a user as revoked in in-memory storage
+// ctx is the request context
+// userID is the user identifier
+// id is the key identifier
+// revokedAt is the revocation time, it is ignored for keys revoked before
+// Returns the key and ErrAPIKeyNotFound if it does not exist or belongs to another user
+func (s *SyncMemoryStorage) RevokeAPIKey(ctx context.Context, userID, id string, revokedAt time.Time) (APIKey, error) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+	key, ok := s.MemoryStorage.APIKeys[id]
+	if !ok || key.UserID != userID {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &revokedAt
+		s.MemoryStorage.APIKeys[id] = key
+	}
+	key.Scopes = append([]string(nil), key.Scopes...)
+	return key, nil
+}
+
 // GetUserByLogin retrieves a user by login from in-memory storage
 // ctx is the request context
 // login is the user login
@@ -90,7 +872,7 @@ func (s *SyncMemoryStorage) GetUserByLogin(ctx context.Context, login string) (u
 	if user, exists := s.MemoryStorage.Users[login]; exists {
 		return user, nil
 	}
-	return nil, fmt.Errorf("user not found for login: %s", login)
+	return nil, fmt.Errorf("%w for login: %s", ErrUserNotFound, login)
 }
 
 // CreateUser creates a new user in in-memory storage
@@ -102,9 +884,19 @@ func (s *SyncMemoryStorage) CreateUser(ctx context.Context, user *User) error {
 	defer s.Mu.Unlock()
 	// Check if user already exists
 	if _, exists := s.MemoryStorage.Users[user.Login]; exists {
-		return fmt.Errorf("user already exists with login: %s", user.Login)
+		return fmt.Errorf("%w with login: %s", ErrUserExists, user.Login)
 	}
 	// Add to memory map
 	s.MemoryStorage.Users[user.Login] = user
 	return nil
 }
+
+// CloseStorage closes the in-memory storage
+// ctx is the request context
+// Returns an error if closing failed
+func (s *SyncMemoryStorage) CloseStorage(ctx context.Context) error { return nil }
+
+// PingStorage checks the in-memory storage connection
+// ctx is the request context
+// Returns an error if connection check failed
+func (s *SyncMemoryStorage) PingStorage(ctx context.Context) error { return nil }
@@ -0,0 +1,298 @@
+// Package storage provides versioned SQL schema migrations for PostgreSQL storage
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationsTable is the table that stores applied migration versions
+const migrationsTable = "schema_migrations"
+
+// migrationsLockID is the advisory lock key that serializes concurrent migrators
+const migrationsLockID = 7243001
+
+// Migration is a single versioned schema change
+type Migration struct {
+	// Version is the migration number taken from the file name prefix
+	Version int64
+
+	// Name is the migration description taken from the file name
+	Name string
+
+	// Up is the SQL that applies the migration
+	Up string
+
+	// Down is the SQL that reverts the migration
+	Down string
+}
+
+// MigrationStatus describes whether a migration has been applied
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+// querier is implemented by both the connection pool and a transaction
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Migrator applies and reverts migrations and tracks them in the schema_migrations table
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+}
+
+// NewMigrator creates a new migrator
+// pool is the database connection pool
+// fsys is the file system with *.up.sql and *.down.sql files
+// Returns a pointer to Migrator and an error if migrations could not be loaded
+func NewMigrator(pool *pgxpool.Pool, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{pool: pool, migrations: migrations}, nil
+}
+
+// LoadMigrations reads migrations from the root of a file system
+// fsys is the file system with NNN_name.up.sql and NNN_name.down.sql files
+// Returns migrations sorted by version and an error if file names are invalid
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("can not read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || path.Ext(fileName) != ".sql" {
+			continue
+		}
+
+		base := strings.TrimSuffix(fileName, ".sql")
+		direction := path.Ext(base)
+		if direction != ".up" && direction != ".down" {
+			return nil, fmt.Errorf("migration %s must end with .up.sql or .down.sql", fileName)
+		}
+		base = strings.TrimSuffix(base, direction)
+
+		versionPart, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(versionPart, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must start with a positive version number", fileName)
+		}
+
+		data, err := fs.ReadFile(fsys, fileName)
+		if err != nil {
+			return nil, fmt.Errorf("can not read migration %s: %w", fileName, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by %q and %q", version, m.Name, name)
+		}
+		if direction == ".up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// ensureTable creates the schema_migrations table if it doesn't exist
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS `+migrationsTable+` (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);`)
+	if err != nil {
+		return fmt.Errorf("can not create %s table: %w", migrationsTable, err)
+	}
+	return nil
+}
+
+// applied returns the applied migration versions with their application time
+func (m *Migrator) applied(ctx context.Context, q querier) (map[int64]time.Time, error) {
+	rows, err := q.Query(ctx, `SELECT version, applied_at FROM `+migrationsTable+`;`)
+	if err != nil {
+		return nil, fmt.Errorf("can not read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		result[version] = appliedAt
+	}
+	return result, rows.Err()
+}
+
+// Up applies all pending migrations in version order
+// ctx is the request context
+// Returns the number of applied migrations and an error if a migration failed
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range m.migrations {
+		done, err := m.run(ctx, migration, true)
+		if err != nil {
+			return count, err
+		}
+		if done {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Down reverts the latest applied migrations
+// ctx is the request context
+// steps is the number of migrations to revert
+// Returns the number of reverted migrations and an error if a migration failed
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+		done, err := m.run(ctx, m.migrations[i], false)
+		if err != nil {
+			return count, err
+		}
+		if done {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Status returns all known migrations with their application time
+// ctx is the request context
+// Returns the migration statuses and an error if they could not be read
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(ctx, m.pool)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// Pending returns the number of known migrations that are not applied
+// Unlike Status it does not create the migrations table, so it fails on a database that was never migrated
+// ctx is the request context
+// Returns the number of pending migrations and an error if applied migrations could not be read
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	applied, err := m.applied(ctx, m.pool)
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// run applies or reverts a single migration in its own transaction
+// The advisory lock makes concurrent instances wait instead of applying the same migration twice
+// Returns true if the migration was applied or reverted, false if there was nothing to do
+func (m *Migrator) run(ctx context.Context, migration Migration, up bool) (bool, error) {
+	tx, err := m.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("can not begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1);`, migrationsLockID); err != nil {
+		return false, fmt.Errorf("can not lock migrations: %w", err)
+	}
+
+	applied, err := m.applied(ctx, tx)
+	if err != nil {
+		return false, err
+	}
+	// Nothing to do if the migration is already in the requested state
+	if _, isApplied := applied[migration.Version]; isApplied == up {
+		return false, nil
+	}
+
+	if up {
+		if _, err := tx.Exec(ctx, migration.Up); err != nil {
+			return false, fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO `+migrationsTable+` (version, name) VALUES ($1, $2);`, migration.Version, migration.Name)
+	} else {
+		if migration.Down == "" {
+			return false, fmt.Errorf("migration %d_%s can not be reverted: %w", migration.Version, migration.Name, errors.ErrUnsupported)
+		}
+		if _, err := tx.Exec(ctx, migration.Down); err != nil {
+			return false, fmt.Errorf("revert of migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM `+migrationsTable+` WHERE version = $1;`, migration.Version)
+	}
+	if err != nil {
+		return false, fmt.Errorf("can not record migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("can not commit migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return true, nil
+}
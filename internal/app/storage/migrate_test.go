@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/vitalykrupin/url-shortener/migrations"
+)
+
+func TestLoadMigrations_Embedded(t *testing.T) {
+	list, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(list) == 0 {
+		t.Fatal("Expected embedded migrations")
+	}
+
+	for i, m := range list {
+		if m.Version != int64(i+1) {
+			t.Errorf("Expected migration #%d to have version %d, got %d", i, i+1, m.Version)
+		}
+		if m.Up == "" || m.Down == "" {
+			t.Errorf("Expected migration %d_%s to have up and down SQL", m.Version, m.Name)
+		}
+	}
+	if list[0].Name != "create_urls_table" {
+		t.Errorf("Expected first migration to create urls table, got %s", list[0].Name)
+	}
+}
+
+func TestLoadMigrations_Sorted(t *testing.T) {
+	fsys := fstest.MapFS{
+		"010_second.up.sql":  {Data: []byte("SELECT 2;")},
+		"002_first.up.sql":   {Data: []byte("SELECT 1;")},
+		"002_first.down.sql": {Data: []byte("SELECT -1;")},
+		"README.md":          {Data: []byte("not a migration")},
+	}
+
+	list, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(list) != 2 || list[0].Version != 2 || list[1].Version != 10 {
+		t.Fatalf("Expected migrations 2 and 10 in order, got %+v", list)
+	}
+	if list[0].Down != "SELECT -1;" || list[1].Down != "" {
+		t.Errorf("Expected down SQL to be matched by version, got %+v", list)
+	}
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{"no direction", fstest.MapFS{"001_init.sql": {Data: []byte("SELECT 1;")}}},
+		{"no version", fstest.MapFS{"init.up.sql": {Data: []byte("SELECT 1;")}}},
+		{"down only", fstest.MapFS{"001_init.down.sql": {Data: []byte("SELECT 1;")}}},
+		{"duplicate version", fstest.MapFS{
+			"001_init.up.sql":  {Data: []byte("SELECT 1;")},
+			"001_other.up.sql": {Data: []byte("SELECT 1;")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadMigrations(tt.fsys); err == nil {
+				t.Error("Expected error for invalid migrations")
+			}
+		})
+	}
+}
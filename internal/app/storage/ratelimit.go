@@ -0,0 +1,77 @@
+// Package storage provides the PostgreSQL rate limit store shared by service instances
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+	"github.com/vitalykrupin/url-shortener/internal/app/middleware"
+	"go.uber.org/zap"
+)
+
+// rateLimitSweepInterval is the interval between removals of full buckets from the database
+const rateLimitSweepInterval = time.Minute
+
+// takeTokenQuery takes a token from a bucket stored as the time it is full again
+// $1 is the bucket key, $2 is the bucket size and $3 is the number of tokens added per second
+// A token is taken if the bucket refilled up to now has one, then the full time moves by one token
+const takeTokenQuery = `
+	INSERT INTO rate_limits AS r (key, full_at, allowed)
+	VALUES ($1, now() + make_interval(secs => 1 / $3::float8), TRUE)
+	ON CONFLICT (key) DO UPDATE SET
+		allowed = $2::float8 - EXTRACT(EPOCH FROM GREATEST(r.full_at, now()) - now())::float8 * $3::float8 >= 1,
+		full_at = GREATEST(r.full_at, now()) + CASE
+			WHEN $2::float8 - EXTRACT(EPOCH FROM GREATEST(r.full_at, now()) - now())::float8 * $3::float8 >= 1
+			THEN make_interval(secs => 1 / $3::float8)
+			ELSE interval '0'
+		END
+	RETURNING allowed, EXTRACT(EPOCH FROM full_at - now())::float8;`
+
+// RateLimits keeps token buckets in PostgreSQL, so that all instances share the limits
+type RateLimits struct {
+	pool      *pgxpool.Pool
+	lastSweep atomic.Int64
+}
+
+// RateLimits creates a rate limit store in the database
+// Returns a pointer to RateLimits
+func (d *DB) RateLimits() *RateLimits {
+	return &RateLimits{pool: d.pool}
+}
+
+// Take refills the bucket of key for the time since the previous request and takes a token if there is one
+// Time is taken from the database, so that instances with different clocks agree
+// ctx is the request context
+// key identifies the bucket
+// limit is the limit of the bucket
+// Returns the state of the bucket and an error if the database failed
+func (r *RateLimits) Take(ctx context.Context, key string, limit config.RateLimit) (middleware.RateLimitResult, error) {
+	r.sweep(ctx)
+
+	var result middleware.RateLimitResult
+	var untilFull float64
+	err := r.pool.QueryRow(ctx, takeTokenQuery, key, float64(limit.Requests), limit.Rate()).Scan(&result.Allowed, &untilFull)
+	if err != nil {
+		return middleware.RateLimitResult{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+	result.Tokens = max(0, float64(limit.Requests)-untilFull*limit.Rate())
+	return result, nil
+}
+
+// sweep removes full buckets, they are the same as missing ones
+// Only one call per interval does the removal, errors are logged because they do not affect limiting
+// ctx is the request context
+func (r *RateLimits) sweep(ctx context.Context) {
+	now := time.Now().UnixNano()
+	last := r.lastSweep.Load()
+	if now-last < int64(rateLimitSweepInterval) || !r.lastSweep.CompareAndSwap(last, now) {
+		return
+	}
+	if _, err := r.pool.Exec(ctx, `DELETE FROM rate_limits WHERE full_at < now();`); err != nil {
+		middleware.Logger(ctx).Warn("Failed to remove full rate limit buckets", zap.Error(err))
+	}
+}
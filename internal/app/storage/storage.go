@@ -3,6 +3,8 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
 )
@@ -13,6 +15,212 @@ type Alias string
 // OriginalURL represents an original URL
 type OriginalURL string
 
+// URLRecord describes a stored short URL
+type URLRecord struct {
+	Alias Alias
+	URL   OriginalURL
+
+	// UserID is the owner user identifier, empty for anonymous URLs
+	UserID string
+
+	// ExpiresAt is the time after which the URL is no longer redirected, nil for URLs without expiration
+	ExpiresAt *time.Time
+}
+
+// Expired reports whether the URL is expired at the given time
+func (r URLRecord) Expired(now time.Time) bool {
+	return r.ExpiresAt != nil && !r.ExpiresAt.After(now)
+}
+
+// CustomURL is a URL to store under an alias chosen by the user
+type CustomURL struct {
+	Alias     Alias
+	URL       OriginalURL
+	ExpiresAt *time.Time
+}
+
+// URLUpdate describes changes of a short URL, unset fields are left unchanged
+type URLUpdate struct {
+	// URL is the new destination, nil to keep the current one
+	URL *OriginalURL
+
+	// ExpiresAt is the new expiration time, nil to keep the current one
+	ExpiresAt *time.Time
+
+	// ClearExpiry removes the expiration time so that the URL never expires
+	ClearExpiry bool
+}
+
+// apply returns the record with the update applied
+func (u URLUpdate) apply(r URLRecord) URLRecord {
+	if u.URL != nil {
+		r.URL = *u.URL
+	}
+	if u.ClearExpiry {
+		r.ExpiresAt = nil
+	} else if u.ExpiresAt != nil {
+		r.ExpiresAt = u.ExpiresAt
+	}
+	return r
+}
+
+// sameTime reports whether two optional times are equal
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// URLEdit is a previous state of an edited short URL
+type URLEdit struct {
+	URL       OriginalURL
+	ExpiresAt *time.Time
+
+	// EditedAt is the time the state was replaced
+	EditedAt time.Time
+}
+
+// Delete job statuses
+const (
+	// DeleteJobPending is the status of a job that is queued or waiting for a retry
+	DeleteJobPending = "pending"
+
+	// DeleteJobDone is the status of a completed job
+	DeleteJobDone = "done"
+
+	// DeleteJobFailed is the status of a job that ran out of attempts, it is kept as a dead-letter record
+	DeleteJobFailed = "failed"
+)
+
+// Per-alias results of a deletion
+const (
+	// DeleteResultDeleted means the alias was marked as deleted
+	DeleteResultDeleted = "deleted"
+
+	// DeleteResultAlreadyDeleted means the alias had been deleted before
+	DeleteResultAlreadyDeleted = "already_deleted"
+
+	// DeleteResultNotFound means the alias does not exist
+	DeleteResultNotFound = "not_found"
+
+	// DeleteResultNotOwner means the alias belongs to another user and was left intact
+	DeleteResultNotOwner = "not_owner"
+)
+
+// Per-alias results of a restoration
+const (
+	// RestoreResultRestored means the deleted alias works again
+	RestoreResultRestored = "restored"
+
+	// RestoreResultNotDeleted means the alias is not deleted
+	RestoreResultNotDeleted = "not_deleted"
+
+	// RestoreResultNotFound means the alias does not exist
+	RestoreResultNotFound = "not_found"
+
+	// RestoreResultNotOwner means the alias belongs to another user and was left intact
+	RestoreResultNotOwner = "not_owner"
+
+	// RestoreResultExpired means the alias expired, expired aliases are not restored
+	RestoreResultExpired = "expired"
+
+	// RestoreResultGracePeriodOver means the alias was deleted before the restore grace period
+	RestoreResultGracePeriodOver = "grace_period_over"
+
+	// RestoreResultConflict means the user shortened the same URL again after the deletion
+	RestoreResultConflict = "conflict"
+)
+
+// restoreResult checks whether a user URL can be restored
+// record is the stored URL, userID is the user identifier
+// deletedAt is the deletion time, nil if the URL is not deleted
+// deletedAfter is the start of the grace period, now is the current time
+// Returns RestoreResultRestored if the URL can be restored, otherwise the reason it can not
+func restoreResult(record URLRecord, userID string, deletedAt *time.Time, deletedAfter, now time.Time) string {
+	switch {
+	case record.UserID != userID:
+		return RestoreResultNotOwner
+	case deletedAt == nil:
+		return RestoreResultNotDeleted
+	case record.Expired(now):
+		return RestoreResultExpired
+	case deletedAt.Before(deletedAfter):
+		return RestoreResultGracePeriodOver
+	}
+	return RestoreResultRestored
+}
+
+// DeleteJob is a queued deletion of user URLs
+type DeleteJob struct {
+	ID      string
+	UserID  string
+	Aliases []string
+
+	// Status is one of DeleteJob* statuses
+	Status string
+
+	// Attempts is the number of finished attempts
+	Attempts int
+
+	// LastError is the error of the last failed attempt
+	LastError string
+
+	// Results maps each alias to one of DeleteResult* values once the job is done
+	Results map[string]string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Click is a redirect of a short URL
+type Click struct {
+	Alias     Alias
+	Time      time.Time
+	Referrer  string
+	UserAgent string
+	IP        string
+}
+
+// DailyClicks is the number of clicks during a UTC day
+type DailyClicks struct {
+	// Date is the day in YYYY-MM-DD format
+	Date   string
+	Clicks int
+}
+
+// ClickStats is the aggregated click statistics of a short URL
+type ClickStats struct {
+	Total int
+
+	// UniqueVisitors is the number of distinct IP and user agent pairs
+	UniqueVisitors int
+
+	// Daily is the number of clicks per day sorted by date, days without clicks are omitted
+	Daily []DailyClicks
+}
+
+// APIKey is a long-lived credential of a user, only the hash of the key itself is stored
+type APIKey struct {
+	ID     string
+	UserID string
+	Name   string
+
+	// Prefix is the beginning of the key that lets the user recognize it
+	Prefix string
+
+	// Hash is the hex-encoded SHA-256 hash of the key
+	Hash string
+
+	// Scopes are the operations allowed with the key
+	Scopes []string
+
+	CreatedAt time.Time
+
+	// RevokedAt is the time the key was revoked, nil for active keys
+	RevokedAt *time.Time
+}
+
 // User represents a user in the system
 type User struct {
 	ID       int    `json:"id"`
@@ -26,18 +234,78 @@ type Storage interface {
 	// Add adds new URLs to the storage
 	Add(ctx context.Context, batch map[Alias]OriginalURL) error
 	
+	// AddOrGet atomically stores URLs that the user has not shortened yet
+	// and returns the aliases already stored for the others together with ErrConflict
+	// expiresAt is the expiration time of the new URLs, nil if they never expire
+	AddOrGet(ctx context.Context, batch map[Alias]OriginalURL, expiresAt *time.Time) (aliases map[OriginalURL]Alias, err error)
+
+	// AddCustom atomically stores URLs under aliases chosen by the user, nothing is stored unless all of them can be
+	// Returns the aliases already stored for URLs the user has shortened together with ErrConflict,
+	// otherwise the aliases that are already taken together with ErrAliasTaken
+	AddCustom(ctx context.Context, urls []CustomURL) (existing map[OriginalURL]Alias, taken []Alias, err error)
+
 	// GetURL retrieves the original URL by alias
 	GetURL(ctx context.Context, alias Alias) (url OriginalURL, err error)
 	
+	// GetURLRecord retrieves the stored short URL including deleted and expired ones, ErrNotFound if it does not exist
+	GetURLRecord(ctx context.Context, alias Alias) (record URLRecord, err error)
+
 	// GetAlias retrieves the alias for a given URL
 	GetAlias(ctx context.Context, url OriginalURL) (alias Alias, err error)
 	
-	// GetUserURLs retrieves all URLs for a user
-	GetUserURLs(ctx context.Context, userID string) (aliasKeysMap AliasKeysMap, err error)
+	// GetUserURLs retrieves not deleted and expired URLs for a user sorted by alias
+	GetUserURLs(ctx context.Context, userID string) (urls []URLRecord, err error)
 	
+	// UpdateUserURL changes the destination or expiration of a user URL and keeps the previous state in the edit history
+	// Returns ErrNotFound, ErrNotOwner, ErrExpired, ErrDeleted, or ErrConflict if the user already shortened the new URL
+	UpdateUserURL(ctx context.Context, userID string, alias Alias, update URLUpdate) (record URLRecord, err error)
+
+	// GetURLHistory retrieves previous states of a short URL, oldest first
+	GetURLHistory(ctx context.Context, alias Alias) (edits []URLEdit, err error)
+
 	// DeleteUserURLs marks user URLs as deleted
-	DeleteUserURLs(ctx context.Context, userID string, urls []string) error
+	// Returns one of DeleteResult* values for every requested alias
+	DeleteUserURLs(ctx context.Context, userID string, urls []string) (results map[string]string, err error)
+
+	// RestoreUserURLs clears the deleted mark of user URLs deleted after the given time
+	// Returns one of RestoreResult* values for every requested alias
+	RestoreUserURLs(ctx context.Context, userID string, aliases []string, deletedAfter time.Time) (results map[string]string, err error)
+
+	// PurgeDeletedURLs permanently removes URLs deleted before the given time together with their clicks and edit history
+	// releaseAliases allows the aliases to be used again, otherwise they stay reserved
+	PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, releaseAliases bool) (count int, err error)
+
+	// DeleteExpiredURLs marks URLs expired at the given time as deleted
+	DeleteExpiredURLs(ctx context.Context, now time.Time) (count int, err error)
+
+	// SaveDeleteJob creates or replaces a delete job with the same ID
+	SaveDeleteJob(ctx context.Context, job DeleteJob) error
+
+	// GetPendingDeleteJobs retrieves delete jobs that are not finished yet, oldest first
+	GetPendingDeleteJobs(ctx context.Context) (jobs []DeleteJob, err error)
+
+	// GetDeleteJob retrieves a delete job by ID, ErrJobNotFound if it does not exist
+	GetDeleteJob(ctx context.Context, id string) (job DeleteJob, err error)
 	
+	// AddClicks stores redirect events
+	AddClicks(ctx context.Context, clicks []Click) error
+
+	// GetClickStats aggregates redirect events of a short URL
+	GetClickStats(ctx context.Context, alias Alias) (stats ClickStats, err error)
+
+	// CreateAPIKey stores a new API key
+	CreateAPIKey(ctx context.Context, key APIKey) error
+
+	// GetAPIKeys retrieves API keys of a user including revoked ones, oldest first
+	GetAPIKeys(ctx context.Context, userID string) (keys []APIKey, err error)
+
+	// GetAPIKeyByHash retrieves an API key by the hash of the key, ErrAPIKeyNotFound if it does not exist
+	GetAPIKeyByHash(ctx context.Context, hash string) (key APIKey, err error)
+
+	// RevokeAPIKey marks an API key of a user as revoked, a revoked key keeps its first revocation time
+	// Returns the key, ErrAPIKeyNotFound if it does not exist or belongs to another user
+	RevokeAPIKey(ctx context.Context, userID, id string, revokedAt time.Time) (key APIKey, err error)
+
 	// User methods
 	// GetUserByLogin retrieves a user by login
 	GetUserByLogin(ctx context.Context, login string) (user *User, err error)
@@ -53,10 +321,42 @@ type Storage interface {
 }
 
 // NewStorage creates a new storage instance based on configuration
+// Without an explicit storage mode PostgreSQL is preferred, then file storage, then in-memory storage
 func NewStorage(conf *config.Config) (Storage, error) {
+	switch conf.StorageMode {
+	case config.StorageMemory:
+		return NewMemoryStorage(), nil
+	case config.StorageFile:
+		return NewFileStorage(conf.FileStorePath)
+	case config.StorageDB:
+		return newMigratedDB(conf)
+	}
+
 	if conf.DBDSN != "" {
-		return NewDB(conf.DBDSN)
-	} else {
+		return newMigratedDB(conf)
+	} else if conf.FileStorePath != "" {
 		return NewFileStorage(conf.FileStorePath)
 	}
+	return NewMemoryStorage(), nil
+}
+
+// newMigratedDB connects to PostgreSQL and applies pending migrations unless they are skipped
+func newMigratedDB(conf *config.Config) (*DB, error) {
+	db, err := NewDB(conf)
+	if err != nil {
+		return nil, err
+	}
+	if conf.SkipMigrations {
+		return db, nil
+	}
+
+	migrator, err := db.Migrator()
+	if err == nil {
+		_, err = migrator.Up(context.Background())
+	}
+	if err != nil {
+		_ = db.CloseStorage(context.Background())
+		return nil, fmt.Errorf("can not apply migrations: %w", err)
+	}
+	return db, nil
 }
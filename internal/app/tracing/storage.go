@@ -0,0 +1,268 @@
+// Package tracing provides tracing of the data storage
+package tracing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attributes of storage calls
+const (
+	// BackendKey is the storage backend: memory, file or postgres
+	BackendKey = attribute.Key("storage.backend")
+
+	// AliasKey is the short URL alias of a single-URL call
+	AliasKey = attribute.Key("shortener.alias")
+
+	// AliasCountKey is the number of aliases or URLs of a batch call
+	AliasCountKey = attribute.Key("shortener.alias_count")
+)
+
+// expectedErrors are storage errors that are valid answers, they do not mark spans as failed
+var expectedErrors = []error{
+	storage.ErrNotFound,
+	storage.ErrDeleted,
+	storage.ErrExpired,
+	storage.ErrNotOwner,
+	storage.ErrConflict,
+	storage.ErrAliasTaken,
+	storage.ErrJobNotFound,
+	storage.ErrAPIKeyNotFound,
+}
+
+// tracedStorage starts a child span for every storage call
+type tracedStorage struct {
+	storage.Storage
+	backend string
+}
+
+// Backend returns the name of the storage backend
+// store is the data storage
+// Returns memory, file, postgres or unknown
+func Backend(store storage.Storage) string {
+	switch store.(type) {
+	case *storage.SyncMemoryStorage:
+		return "memory"
+	case *storage.FileStorage:
+		return "file"
+	case *storage.DB:
+		return "postgres"
+	default:
+		return "unknown"
+	}
+}
+
+// InstrumentStorage wraps the storage so that every call is traced as a child span of the context span
+// store is the data storage
+// Returns the traced storage
+func InstrumentStorage(store storage.Storage) storage.Storage {
+	return &tracedStorage{Storage: store, backend: Backend(store)}
+}
+
+// start starts the span of a storage call
+// ctx is the context of the call
+// method is the storage method name
+// attrs are the call specific attributes
+// Returns the context with the span and the span
+func (s *tracedStorage) start(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, BackendKey.String(s.backend))
+	return Tracer().Start(ctx, "storage."+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// end records the error of a storage call and ends its span
+// span is the span of the call
+// err is the error returned by the call
+func end(span trace.Span, err error) {
+	defer span.End()
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	for _, expected := range expectedErrors {
+		if errors.Is(err, expected) {
+			return
+		}
+	}
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Add adds new URLs to the storage
+func (s *tracedStorage) Add(ctx context.Context, batch map[storage.Alias]storage.OriginalURL) (err error) {
+	ctx, span := s.start(ctx, "Add", AliasCountKey.Int(len(batch)))
+	defer func() { end(span, err) }()
+	return s.Storage.Add(ctx, batch)
+}
+
+// AddOrGet stores new URLs and returns aliases of already stored ones
+func (s *tracedStorage) AddOrGet(ctx context.Context, batch map[storage.Alias]storage.OriginalURL, expiresAt *time.Time) (aliases map[storage.OriginalURL]storage.Alias, err error) {
+	ctx, span := s.start(ctx, "AddOrGet", AliasCountKey.Int(len(batch)))
+	defer func() { end(span, err) }()
+	return s.Storage.AddOrGet(ctx, batch, expiresAt)
+}
+
+// AddCustom stores URLs under aliases chosen by the user, all or none of them
+func (s *tracedStorage) AddCustom(ctx context.Context, urls []storage.CustomURL) (existing map[storage.OriginalURL]storage.Alias, taken []storage.Alias, err error) {
+	ctx, span := s.start(ctx, "AddCustom", AliasCountKey.Int(len(urls)))
+	defer func() { end(span, err) }()
+	return s.Storage.AddCustom(ctx, urls)
+}
+
+// GetURL retrieves the original URL by alias
+func (s *tracedStorage) GetURL(ctx context.Context, alias storage.Alias) (url storage.OriginalURL, err error) {
+	ctx, span := s.start(ctx, "GetURL", AliasKey.String(string(alias)))
+	defer func() { end(span, err) }()
+	return s.Storage.GetURL(ctx, alias)
+}
+
+// GetURLRecord retrieves the stored short URL
+func (s *tracedStorage) GetURLRecord(ctx context.Context, alias storage.Alias) (record storage.URLRecord, err error) {
+	ctx, span := s.start(ctx, "GetURLRecord", AliasKey.String(string(alias)))
+	defer func() { end(span, err) }()
+	return s.Storage.GetURLRecord(ctx, alias)
+}
+
+// GetAlias retrieves the alias for a given URL
+func (s *tracedStorage) GetAlias(ctx context.Context, url storage.OriginalURL) (alias storage.Alias, err error) {
+	ctx, span := s.start(ctx, "GetAlias")
+	defer func() { end(span, err) }()
+	return s.Storage.GetAlias(ctx, url)
+}
+
+// GetUserURLs retrieves URLs of a user
+func (s *tracedStorage) GetUserURLs(ctx context.Context, userID string) (urls []storage.URLRecord, err error) {
+	ctx, span := s.start(ctx, "GetUserURLs")
+	defer func() { end(span, err) }()
+	return s.Storage.GetUserURLs(ctx, userID)
+}
+
+// UpdateUserURL changes a user URL
+func (s *tracedStorage) UpdateUserURL(ctx context.Context, userID string, alias storage.Alias, update storage.URLUpdate) (record storage.URLRecord, err error) {
+	ctx, span := s.start(ctx, "UpdateUserURL", AliasKey.String(string(alias)))
+	defer func() { end(span, err) }()
+	return s.Storage.UpdateUserURL(ctx, userID, alias, update)
+}
+
+// GetURLHistory retrieves previous states of a short URL
+func (s *tracedStorage) GetURLHistory(ctx context.Context, alias storage.Alias) (edits []storage.URLEdit, err error) {
+	ctx, span := s.start(ctx, "GetURLHistory", AliasKey.String(string(alias)))
+	defer func() { end(span, err) }()
+	return s.Storage.GetURLHistory(ctx, alias)
+}
+
+// DeleteUserURLs marks user URLs as deleted
+func (s *tracedStorage) DeleteUserURLs(ctx context.Context, userID string, urls []string) (results map[string]string, err error) {
+	ctx, span := s.start(ctx, "DeleteUserURLs", AliasCountKey.Int(len(urls)))
+	defer func() { end(span, err) }()
+	return s.Storage.DeleteUserURLs(ctx, userID, urls)
+}
+
+// RestoreUserURLs clears the deleted mark of user URLs
+func (s *tracedStorage) RestoreUserURLs(ctx context.Context, userID string, aliases []string, deletedAfter time.Time) (results map[string]string, err error) {
+	ctx, span := s.start(ctx, "RestoreUserURLs", AliasCountKey.Int(len(aliases)))
+	defer func() { end(span, err) }()
+	return s.Storage.RestoreUserURLs(ctx, userID, aliases, deletedAfter)
+}
+
+// PurgeDeletedURLs permanently removes old deleted URLs
+func (s *tracedStorage) PurgeDeletedURLs(ctx context.Context, deletedBefore time.Time, releaseAliases bool) (count int, err error) {
+	ctx, span := s.start(ctx, "PurgeDeletedURLs")
+	defer func() { end(span, err) }()
+	return s.Storage.PurgeDeletedURLs(ctx, deletedBefore, releaseAliases)
+}
+
+// DeleteExpiredURLs marks expired URLs as deleted
+func (s *tracedStorage) DeleteExpiredURLs(ctx context.Context, now time.Time) (count int, err error) {
+	ctx, span := s.start(ctx, "DeleteExpiredURLs")
+	defer func() { end(span, err) }()
+	return s.Storage.DeleteExpiredURLs(ctx, now)
+}
+
+// SaveDeleteJob creates or replaces a delete job
+func (s *tracedStorage) SaveDeleteJob(ctx context.Context, job storage.DeleteJob) (err error) {
+	ctx, span := s.start(ctx, "SaveDeleteJob", AliasCountKey.Int(len(job.Aliases)))
+	defer func() { end(span, err) }()
+	return s.Storage.SaveDeleteJob(ctx, job)
+}
+
+// GetPendingDeleteJobs retrieves delete jobs that are not finished yet
+func (s *tracedStorage) GetPendingDeleteJobs(ctx context.Context) (jobs []storage.DeleteJob, err error) {
+	ctx, span := s.start(ctx, "GetPendingDeleteJobs")
+	defer func() { end(span, err) }()
+	return s.Storage.GetPendingDeleteJobs(ctx)
+}
+
+// GetDeleteJob retrieves a delete job by ID
+func (s *tracedStorage) GetDeleteJob(ctx context.Context, id string) (job storage.DeleteJob, err error) {
+	ctx, span := s.start(ctx, "GetDeleteJob")
+	defer func() { end(span, err) }()
+	return s.Storage.GetDeleteJob(ctx, id)
+}
+
+// CreateAPIKey stores a new API key
+func (s *tracedStorage) CreateAPIKey(ctx context.Context, key storage.APIKey) (err error) {
+	ctx, span := s.start(ctx, "CreateAPIKey")
+	defer func() { end(span, err) }()
+	return s.Storage.CreateAPIKey(ctx, key)
+}
+
+// GetAPIKeys retrieves API keys of a user
+func (s *tracedStorage) GetAPIKeys(ctx context.Context, userID string) (keys []storage.APIKey, err error) {
+	ctx, span := s.start(ctx, "GetAPIKeys")
+	defer func() { end(span, err) }()
+	return s.Storage.GetAPIKeys(ctx, userID)
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of the key
+func (s *tracedStorage) GetAPIKeyByHash(ctx context.Context, hash string) (key storage.APIKey, err error) {
+	ctx, span := s.start(ctx, "GetAPIKeyByHash")
+	defer func() { end(span, err) }()
+	return s.Storage.GetAPIKeyByHash(ctx, hash)
+}
+
+// RevokeAPIKey marks an API key of a user as revoked
+func (s *tracedStorage) RevokeAPIKey(ctx context.Context, userID, id string, revokedAt time.Time) (key storage.APIKey, err error) {
+	ctx, span := s.start(ctx, "RevokeAPIKey")
+	defer func() { end(span, err) }()
+	return s.Storage.RevokeAPIKey(ctx, userID, id, revokedAt)
+}
+
+// AddClicks stores redirect events
+func (s *tracedStorage) AddClicks(ctx context.Context, clicks []storage.Click) (err error) {
+	ctx, span := s.start(ctx, "AddClicks", AliasCountKey.Int(len(clicks)))
+	defer func() { end(span, err) }()
+	return s.Storage.AddClicks(ctx, clicks)
+}
+
+// GetClickStats aggregates redirect events of a short URL
+func (s *tracedStorage) GetClickStats(ctx context.Context, alias storage.Alias) (stats storage.ClickStats, err error) {
+	ctx, span := s.start(ctx, "GetClickStats", AliasKey.String(string(alias)))
+	defer func() { end(span, err) }()
+	return s.Storage.GetClickStats(ctx, alias)
+}
+
+// GetUserByLogin retrieves a user by login
+func (s *tracedStorage) GetUserByLogin(ctx context.Context, login string) (user *storage.User, err error) {
+	ctx, span := s.start(ctx, "GetUserByLogin")
+	defer func() { end(span, err) }()
+	return s.Storage.GetUserByLogin(ctx, login)
+}
+
+// CreateUser creates a new user
+func (s *tracedStorage) CreateUser(ctx context.Context, user *storage.User) (err error) {
+	ctx, span := s.start(ctx, "CreateUser")
+	defer func() { end(span, err) }()
+	return s.Storage.CreateUser(ctx, user)
+}
+
+// PingStorage checks the storage connection
+func (s *tracedStorage) PingStorage(ctx context.Context) (err error) {
+	ctx, span := s.start(ctx, "PingStorage")
+	defer func() { end(span, err) }()
+	return s.Storage.PingStorage(ctx)
+}
@@ -0,0 +1,152 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vitalykrupin/url-shortener/cmd/shortener/config"
+	"github.com/vitalykrupin/url-shortener/internal/app/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// record installs a tracer provider that keeps ended spans in memory
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		_ = provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+// attributes returns the span attributes as a map
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+
+	r := chi.NewRouter()
+	r.Use(Middleware)
+	r.Get("/{id}", func(w http.ResponseWriter, req *http.Request) {
+		_, span := Tracer().Start(req.Context(), "handler")
+		span.End()
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	handler, server := spans[0], spans[1]
+	if server.Name() != "GET /{id}" {
+		t.Errorf("Expected span named after the route, got %q", server.Name())
+	}
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected trace of the caller to be continued, got %s", got)
+	}
+	if handler.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("Expected handler span to be a child of the request span")
+	}
+	attrs := attributes(server)
+	if attrs["http.route"].AsString() != "/{id}" || attrs["http.response.status_code"].AsInt64() != http.StatusTemporaryRedirect {
+		t.Errorf("Unexpected attributes %v", attrs)
+	}
+}
+
+func TestInstrumentStorage(t *testing.T) {
+	recorder := record(t)
+	store := InstrumentStorage(storage.NewMemoryStorage())
+
+	ctx, parent := Tracer().Start(context.Background(), "request")
+	if err := store.Add(ctx, map[storage.Alias]storage.OriginalURL{"abc": "https://a.com"}); err != nil {
+		t.Fatalf("Expected no error on Add, got %v", err)
+	}
+	if _, err := store.GetURLRecord(ctx, "missing"); err == nil {
+		t.Fatal("Expected error for missing alias")
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+	add, get := spans[0], spans[1]
+	if add.Name() != "storage.Add" || get.Name() != "storage.GetURLRecord" {
+		t.Errorf("Unexpected span names %q, %q", add.Name(), get.Name())
+	}
+	if get.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Expected storage span to be a child of the request span")
+	}
+	attrs := attributes(get)
+	if attrs[BackendKey].AsString() != "memory" || attrs[AliasKey].AsString() != "missing" {
+		t.Errorf("Unexpected attributes %v", attrs)
+	}
+	if attributes(add)[AliasCountKey].AsInt64() != 1 {
+		t.Errorf("Expected alias count on batch span, got %v", attributes(add))
+	}
+	// A missing alias is a valid answer, so the span is not failed but the error is recorded
+	if get.Status().Code == codes.Error || len(get.Events()) != 1 {
+		t.Errorf("Expected recorded error without failed status, got %v with %d events", get.Status(), len(get.Events()))
+	}
+}
+
+func TestSetup(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+
+	// Tracing is off by default
+	shutdown, err := Setup(context.Background(), config.NewConfig())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Expected no error on shutdown, got %v", err)
+	}
+
+	conf := config.NewConfig()
+	conf.TracingExporter = config.TracingFile
+	conf.TracingFile = filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err = Setup(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	_, span := Tracer().Start(context.Background(), "exported")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Expected no error on shutdown, got %v", err)
+	}
+
+	data, err := os.ReadFile(conf.TracingFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Name":"exported"`) || !strings.Contains(string(data), ServiceName) {
+		t.Errorf("Expected exported span in file, got %s", data)
+	}
+}
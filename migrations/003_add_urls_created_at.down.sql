@@ -0,0 +1 @@
+-- Откат миграции 003 не удаляет created_at, так как колонка создается миграцией 001
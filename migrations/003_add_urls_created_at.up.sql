@@ -0,0 +1,3 @@
+-- Миграция для добавления created_at в таблицы urls, созданные без него
+
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
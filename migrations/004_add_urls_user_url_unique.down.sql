@@ -0,0 +1,3 @@
+-- Откат миграции для уникальности URL среди неудаленных ссылок пользователя
+
+DROP INDEX IF EXISTS idx_urls_user_url_active;
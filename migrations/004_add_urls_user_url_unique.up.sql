@@ -0,0 +1,24 @@
+-- Миграция для уникальности URL среди неудаленных ссылок пользователя
+
+-- Дубликаты, созданные параллельными запросами, не удаляются автоматически, чтобы не сломать ссылки пользователей:
+-- миграция прерывается, и оператор решает, какие из ссылок оставить
+DO $$
+DECLARE
+    duplicates BIGINT;
+BEGIN
+    SELECT COUNT(*) INTO duplicates FROM (
+        SELECT 1 FROM urls
+        WHERE deleted_flag = FALSE
+        GROUP BY COALESCE(user_id, ''), url
+        HAVING COUNT(*) > 1
+    ) AS dup;
+    IF duplicates > 0 THEN
+        RAISE EXCEPTION 'urls: % URLs have several live aliases of the same user', duplicates
+            USING HINT = 'List them with: SELECT user_id, url, array_agg(alias ORDER BY id) FROM urls WHERE deleted_flag = FALSE '
+                || 'GROUP BY user_id, url HAVING COUNT(*) > 1; '
+                || 'keep one alias per URL live (e.g. UPDATE urls SET deleted_flag = TRUE WHERE alias = ANY(...)) and run the migration again';
+    END IF;
+END $$;
+
+-- Создание уникального индекса для INSERT ... ON CONFLICT
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_user_url_active ON urls (COALESCE(user_id, ''), url) WHERE deleted_flag = FALSE;
@@ -0,0 +1,9 @@
+-- Откат миграции для срока действия ссылок
+
+DROP INDEX IF EXISTS idx_urls_expires_at;
+
+ALTER TABLE urls DROP COLUMN IF EXISTS expired_flag;
+
+ALTER TABLE urls DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE urls DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,17 @@
+-- Миграция для срока действия ссылок
+
+-- Время, после которого ссылка перестает работать, NULL для бессрочных ссылок
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+
+-- Время удаления ссылки пользователем или по истечении срока действия
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Признак удаления ссылки по истечении срока действия, такие ссылки остаются в списке ссылок пользователя
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS expired_flag BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Ссылки, удаленные до появления столбца, считаем удаленными в момент миграции,
+-- чтобы они хранились весь срок восстановления и не удалялись окончательно при первой очистке
+UPDATE urls SET deleted_at = CURRENT_TIMESTAMP WHERE deleted_flag AND deleted_at IS NULL;
+
+-- Индекс для поиска истекших ссылок фоновой очисткой
+CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls (expires_at) WHERE deleted_flag = FALSE AND expires_at IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Откат миграции для таблицы переходов по коротким ссылкам
+
+DROP INDEX IF EXISTS idx_clicks_alias_clicked_at;
+
+DROP TABLE IF EXISTS clicks;
@@ -0,0 +1,13 @@
+-- Миграция для таблицы переходов по коротким ссылкам
+
+CREATE TABLE IF NOT EXISTS clicks (
+    id BIGSERIAL PRIMARY KEY,
+    alias TEXT NOT NULL,
+    clicked_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    referrer TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT ''
+);
+
+-- Индекс для подсчета статистики по ссылке
+CREATE INDEX IF NOT EXISTS idx_clicks_alias_clicked_at ON clicks (alias, clicked_at);
@@ -0,0 +1,5 @@
+-- Откат миграции для истории изменений коротких ссылок
+
+DROP INDEX IF EXISTS idx_url_edits_alias;
+
+DROP TABLE IF EXISTS url_edits;
@@ -0,0 +1,13 @@
+-- Миграция для истории изменений коротких ссылок
+
+-- Предыдущие состояния ссылки, запись добавляется при каждом изменении
+CREATE TABLE IF NOT EXISTS url_edits (
+    id BIGSERIAL PRIMARY KEY,
+    alias TEXT NOT NULL,
+    url TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    edited_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Индекс для получения истории ссылки
+CREATE INDEX IF NOT EXISTS idx_url_edits_alias ON url_edits (alias, id);
@@ -0,0 +1,5 @@
+-- Откат миграции для очереди удаления ссылок
+
+DROP INDEX IF EXISTS idx_delete_jobs_pending;
+
+DROP TABLE IF EXISTS delete_jobs;
@@ -0,0 +1,16 @@
+-- Миграция для очереди удаления ссылок
+
+-- Задания на удаление сохраняются до ответа клиенту, чтобы не потерять их при перезапуске
+CREATE TABLE IF NOT EXISTS delete_jobs (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    aliases TEXT[] NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Индекс для восстановления незавершенных заданий при запуске
+CREATE INDEX IF NOT EXISTS idx_delete_jobs_pending ON delete_jobs (created_at) WHERE status = 'pending';
@@ -0,0 +1,3 @@
+-- Откат миграции для результатов удаления по каждому алиасу
+
+ALTER TABLE delete_jobs DROP COLUMN IF EXISTS results;
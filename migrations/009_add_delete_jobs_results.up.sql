@@ -0,0 +1,4 @@
+-- Миграция для результатов удаления по каждому алиасу
+
+-- Результат для каждого алиаса задания: deleted, already_deleted, not_found или not_owner
+ALTER TABLE delete_jobs ADD COLUMN IF NOT EXISTS results JSONB;
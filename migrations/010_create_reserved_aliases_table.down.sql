@@ -0,0 +1,5 @@
+-- Откат миграции для зарезервированных алиасов
+
+DROP INDEX IF EXISTS idx_urls_deleted_at;
+
+DROP TABLE IF EXISTS reserved_aliases;
@@ -0,0 +1,10 @@
+-- Миграция для алиасов, зарезервированных после окончательного удаления ссылок
+
+-- Алиасы удаленных ссылок, которые нельзя использовать повторно
+CREATE TABLE IF NOT EXISTS reserved_aliases (
+    alias TEXT PRIMARY KEY,
+    reserved_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Индекс для поиска удаленных ссылок, срок хранения которых истек
+CREATE INDEX IF NOT EXISTS idx_urls_deleted_at ON urls (deleted_at) WHERE deleted_flag = TRUE;
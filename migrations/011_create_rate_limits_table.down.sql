@@ -0,0 +1,5 @@
+-- Откат миграции для ограничения частоты запросов
+
+DROP INDEX IF EXISTS idx_rate_limits_full_at;
+
+DROP TABLE IF EXISTS rate_limits;
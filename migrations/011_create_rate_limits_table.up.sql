@@ -0,0 +1,12 @@
+-- Миграция для общего состояния ограничения частоты запросов
+
+-- Корзины токенов всех экземпляров сервиса, корзина хранится как время, когда она снова заполнится.
+-- При сбое базы состояние можно потерять, поэтому таблица не журналируется
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+    key TEXT PRIMARY KEY,
+    full_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    allowed BOOLEAN NOT NULL
+);
+
+-- Индекс для удаления заполненных корзин, они не отличаются от отсутствующих
+CREATE INDEX IF NOT EXISTS idx_rate_limits_full_at ON rate_limits (full_at);
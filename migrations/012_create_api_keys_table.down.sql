@@ -0,0 +1,5 @@
+-- Откат миграции для API-ключей пользователей
+
+DROP INDEX IF EXISTS idx_api_keys_user_id;
+
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,16 @@
+-- Миграция для API-ключей пользователей
+
+-- Хранится только хеш ключа, сам ключ показывается пользователю один раз при создании
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Индекс для получения ключей пользователя
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id, created_at);
@@ -0,0 +1,12 @@
+// Package migrations embeds versioned SQL schema migrations
+//
+// Files are named NNN_description.up.sql and NNN_description.down.sql,
+// where NNN is the migration version
+package migrations
+
+import "embed"
+
+// FS contains all migration files
+//
+//go:embed *.sql
+var FS embed.FS